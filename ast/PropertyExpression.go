@@ -0,0 +1,25 @@
+package ast
+
+import (
+	"TroInterpreter/token"
+	"bytes"
+)
+
+// 属性表达式，value.name
+type PropertyExpression struct {
+	Token    token.Token // .
+	Object   Expression
+	Property *Identifier
+}
+
+func (pe *PropertyExpression) expressionNode()      {}
+func (pe *PropertyExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PropertyExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(pe.Object.String())
+	out.WriteString(".")
+	out.WriteString(pe.Property.String())
+
+	return out.String()
+}
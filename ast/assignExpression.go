@@ -0,0 +1,27 @@
+package ast
+
+import (
+	"TroInterpreter/token"
+	"bytes"
+)
+
+// 赋值表达式，p.x = 1
+type AssignExpression struct {
+	Token  token.Token // =
+	Target *PropertyExpression
+	Value  Expression
+}
+
+func (ae *AssignExpression) expressionNode()      {}
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ae.Target.String())
+	out.WriteString(" = ")
+	out.WriteString(ae.Value.String())
+	out.WriteString(")")
+
+	return out.String()
+}
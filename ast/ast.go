@@ -1,7 +1,9 @@
 package ast
 
 import (
+	"TroInterpreter/token"
 	"bytes"
+	"reflect"
 )
 
 // ast节点都应实现Node接口
@@ -44,3 +46,20 @@ func (p *Program) String() string {
 
 	return out.String()
 }
+
+// Position 返回节点在源码中的位置，即节点Token的行列号，没有Token的节点返回0, 0
+func Position(node Node) (line, column int) {
+	v := reflect.ValueOf(node)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return 0, 0
+	}
+	field := v.Elem().FieldByName("Token")
+	if !field.IsValid() {
+		return 0, 0
+	}
+	tok, ok := field.Interface().(token.Token)
+	if !ok {
+		return 0, 0
+	}
+	return tok.Line, tok.Column
+}
@@ -2,6 +2,7 @@ package ast
 
 import (
 	"TroInterpreter/token"
+	"reflect"
 	"testing"
 )
 
@@ -26,3 +27,260 @@ func TestString(t *testing.T) {
 		t.Errorf("program.String() wrong. got=%q", program.String())
 	}
 }
+
+func TestModify(t *testing.T) {
+	one := func() Expression { return &IntegerLiteral{Value: 1} }
+	two := func() Expression { return &IntegerLiteral{Value: 2} }
+
+	turnOneIntoTwo := func(node Node) Node {
+		integer, ok := node.(*IntegerLiteral)
+		if !ok {
+			return node
+		}
+
+		if integer.Value != 1 {
+			return node
+		}
+
+		integer.Value = 2
+		return integer
+	}
+
+	tests := []struct {
+		input    Node
+		expected Node
+	}{
+		{
+			one(),
+			two(),
+		},
+		{
+			&Program{
+				Statements: []Statement{
+					&ExpressionStatement{Expression: one()},
+				},
+			},
+			&Program{
+				Statements: []Statement{
+					&ExpressionStatement{Expression: two()},
+				},
+			},
+		},
+		{
+			&InfixExpression{Left: one(), Operator: "+", Right: two()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&InfixExpression{Left: two(), Operator: "+", Right: one()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&PrefixExpression{Operator: "-", Right: one()},
+			&PrefixExpression{Operator: "-", Right: two()},
+		},
+		{
+			&IndexExpression{Left: one(), Index: one()},
+			&IndexExpression{Left: two(), Index: two()},
+		},
+		{
+			&IfExpression{
+				Condition: one(),
+				Consequence: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: one()},
+					},
+				},
+				Alternative: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: one()},
+					},
+				},
+			},
+			&IfExpression{
+				Condition: two(),
+				Consequence: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: two()},
+					},
+				},
+				Alternative: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: two()},
+					},
+				},
+			},
+		},
+		{
+			&ReturnStatement{ReturnValue: one()},
+			&ReturnStatement{ReturnValue: two()},
+		},
+		{
+			&LetStatement{Value: one()},
+			&LetStatement{Value: two()},
+		},
+		{
+			&FunctionExpression{
+				Parameters: []*Identifier{},
+				Body: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: one()},
+					},
+				},
+			},
+			&FunctionExpression{
+				Parameters: []*Identifier{},
+				Body: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: two()},
+					},
+				},
+			},
+		},
+		{
+			&ArrayLiteral{Elements: []Expression{one(), one()}},
+			&ArrayLiteral{Elements: []Expression{two(), two()}},
+		},
+	}
+
+	for _, tt := range tests {
+		modified := Modify(tt.input, turnOneIntoTwo)
+
+		if !reflect.DeepEqual(modified, tt.expected) {
+			t.Errorf("not equal. got=%#v, want=%#v", modified, tt.expected)
+		}
+	}
+}
+
+func TestClone(t *testing.T) {
+	one := func() Expression { return &IntegerLiteral{Value: 1} }
+	block := func() *BlockStatement {
+		return &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}}
+	}
+	param := func() *Identifier {
+		return &Identifier{Value: "a", Type: &TypeName{Name: "int"}, Resolution: Local, Slot: 1}
+	}
+
+	nodes := []func() Node{
+		func() Node {
+			return &Program{Statements: []Statement{
+				&LetStatement{Name: param(), Value: &ArrayLiteral{Elements: []Expression{one(), one()}}},
+				&ReturnStatement{ReturnValue: &PrefixExpression{Operator: "-", Right: one()}},
+				&ThrowStatement{Value: &IndexExpression{Left: one(), Index: one()}},
+			}}
+		},
+		func() Node {
+			return &IfExpression{Condition: one(), Consequence: block(), Alternative: block()}
+		},
+		func() Node {
+			return &TryExpression{Body: block(), Param: param(), Catch: block(), Finally: block(), CatchScope: &Scope{Names: []string{"e"}}}
+		},
+		func() Node {
+			return &FunctionExpression{
+				Parameters: []*Identifier{param()},
+				Body:       block(),
+				ReturnType: &TypeName{Name: "int"},
+				Scope:      &Scope{Names: []string{"a"}},
+			}
+		},
+		func() Node {
+			call := &CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{one()}}
+			return &SpawnExpression{Call: call}
+		},
+		func() Node {
+			target := &PropertyExpression{Object: one(), Property: &Identifier{Value: "x"}}
+			return &AssignExpression{Target: target, Value: &YieldExpression{Value: one()}}
+		},
+		func() Node {
+			return &EnumStatement{Name: &Identifier{Value: "E"}, Variants: []*EnumVariant{{Name: &Identifier{Value: "V"}, Fields: []*Identifier{param()}}}}
+		},
+	}
+
+	turnOneIntoTwo := func(node Node) Node {
+		if integer, ok := node.(*IntegerLiteral); ok && integer.Value == 1 {
+			integer.Value = 2
+		}
+		if ident, ok := node.(*Identifier); ok && ident.Type != nil {
+			ident.Type.Name = "string"
+		}
+		return node
+	}
+
+	for _, node := range nodes {
+		original := node()
+		cloned := Clone(original)
+		if !reflect.DeepEqual(cloned, node()) {
+			t.Errorf("clone not equal. got=%#v, want=%#v", cloned, node())
+		}
+
+		//修改拷贝不影响原来的节点
+		Modify(cloned, turnOneIntoTwo)
+		if fn, ok := cloned.(*FunctionExpression); ok {
+			fn.Scope.Names[0] = "changed"
+		}
+		if !reflect.DeepEqual(original, node()) {
+			t.Errorf("original modified. got=%#v", original)
+		}
+	}
+}
+
+func TestEncodeJSON(t *testing.T) {
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Token: token.Token{Type: token.LET, Literal: "let", Line: 1, Column: 1},
+				Name: &Identifier{
+					Token: token.Token{Type: token.IDENT, Literal: "x", Line: 1, Column: 5},
+					Value: "x",
+				},
+				Value: &IntegerLiteral{
+					Token: token.Token{Type: token.NUMBER, Literal: "5", Line: 1, Column: 9},
+					Value: 5,
+				},
+			},
+		},
+	}
+
+	data, err := EncodeJSON(program)
+	if err != nil {
+		t.Fatalf("EncodeJSON returned error: %s", err)
+	}
+
+	expected := `{"kind":"Program","statements":[{"kind":"LetStatement",` +
+		`"name":{"kind":"Identifier","pos":{"line":1,"column":5},"token":{"type":"IDENT","literal":"x"},"value":"x"},` +
+		`"pos":{"line":1,"column":1},"token":{"type":"LET","literal":"let"},` +
+		`"value":{"kind":"IntegerLiteral","pos":{"line":1,"column":9},"token":{"type":"NUMBER","literal":"5"},"value":5}}]}`
+	if string(data) != expected {
+		t.Fatalf("wrong json.\nwant=%s\ngot= %s", expected, data)
+	}
+
+	decoded, err := DecodeJSON(data)
+	if err != nil {
+		t.Fatalf("DecodeJSON returned error: %s", err)
+	}
+
+	if !reflect.DeepEqual(decoded, program) {
+		t.Errorf("decoded program not equal. got=%#v", decoded)
+	}
+}
+
+func TestDecodeJSONErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"kind":"Unknown"}`, `未知的节点类型 "Unknown"`},
+		{`{"kind":"Identifier","value":"x"}`, `json根节点得是 Program,却是 *ast.Identifier`},
+		{`{"kind":"Program","statements":[{"kind":"Identifier"}]}`, `Program.statements 不能是 Identifier`},
+	}
+
+	for _, tt := range tests {
+		_, err := DecodeJSON([]byte(tt.input))
+		if err == nil {
+			t.Errorf("expected error %q, got none", tt.expected)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
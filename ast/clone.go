@@ -0,0 +1,266 @@
+package ast
+
+import "math/big"
+
+// Clone 深拷贝ast节点，修改拷贝不会影响原来的节点
+// 新增ast节点时需要在这里处理
+func Clone(node Node) Node {
+	switch node := node.(type) {
+	case *Program:
+		c := *node
+		c.Statements = cloneStatements(node.Statements)
+		return &c
+
+	case *LetStatement:
+		c := *node
+		c.Name = cloneIdentifier(node.Name)
+		c.Value = cloneExpression(node.Value)
+		return &c
+
+	case *ReturnStatement:
+		c := *node
+		c.ReturnValue = cloneExpression(node.ReturnValue)
+		return &c
+
+	case *ThrowStatement:
+		c := *node
+		c.Value = cloneExpression(node.Value)
+		return &c
+
+	case *ExpressionStatement:
+		c := *node
+		c.Expression = cloneExpression(node.Expression)
+		return &c
+
+	case *BlockStatement:
+		return cloneBlock(node)
+
+	case *StructStatement:
+		c := *node
+		c.Name = cloneIdentifier(node.Name)
+		c.Fields = cloneIdentifiers(node.Fields)
+		return &c
+
+	case *EnumStatement:
+		c := *node
+		c.Name = cloneIdentifier(node.Name)
+		c.Variants = nil
+		for _, v := range node.Variants {
+			c.Variants = append(c.Variants, Clone(v).(*EnumVariant))
+		}
+		return &c
+
+	case *EnumVariant:
+		c := *node
+		c.Name = cloneIdentifier(node.Name)
+		c.Fields = cloneIdentifiers(node.Fields)
+		return &c
+
+	case *ImportStatement:
+		c := *node
+		if node.Path != nil {
+			c.Path = Clone(node.Path).(*StringLiteral)
+		}
+		c.Alias = cloneIdentifier(node.Alias)
+		return &c
+
+	case *ExportStatement:
+		c := *node
+		if node.Statement != nil {
+			c.Statement = Clone(node.Statement).(Statement)
+		}
+		return &c
+
+	case *Identifier:
+		return cloneIdentifier(node)
+
+	case *TypeName:
+		return cloneTypeName(node)
+
+	case *IntegerLiteral:
+		c := *node
+		if node.Big != nil {
+			c.Big = new(big.Int).Set(node.Big)
+		}
+		return &c
+
+	case *StringLiteral:
+		c := *node
+		return &c
+
+	case *Boolean:
+		c := *node
+		return &c
+
+	case *ArrayLiteral:
+		c := *node
+		c.Elements = cloneExpressions(node.Elements)
+		return &c
+
+	case *IndexExpression:
+		c := *node
+		c.Left = cloneExpression(node.Left)
+		c.Index = cloneExpression(node.Index)
+		return &c
+
+	case *PrefixExpression:
+		c := *node
+		c.Right = cloneExpression(node.Right)
+		return &c
+
+	case *InfixExpression:
+		c := *node
+		c.Left = cloneExpression(node.Left)
+		c.Right = cloneExpression(node.Right)
+		return &c
+
+	case *IfExpression:
+		c := *node
+		c.Condition = cloneExpression(node.Condition)
+		c.Consequence = cloneBlock(node.Consequence)
+		c.Alternative = cloneBlock(node.Alternative)
+		return &c
+
+	case *TryExpression:
+		c := *node
+		c.Body = cloneBlock(node.Body)
+		c.Param = cloneIdentifier(node.Param)
+		c.Catch = cloneBlock(node.Catch)
+		c.Finally = cloneBlock(node.Finally)
+		c.CatchScope = cloneScope(node.CatchScope)
+		return &c
+
+	case *FunctionExpression:
+		c := *node
+		c.Parameters = cloneIdentifiers(node.Parameters)
+		c.Body = cloneBlock(node.Body)
+		c.ReturnType = cloneTypeName(node.ReturnType)
+		c.Scope = cloneScope(node.Scope)
+		return &c
+
+	case *MacroLiteral:
+		c := *node
+		c.Parameters = cloneIdentifiers(node.Parameters)
+		c.Body = cloneBlock(node.Body)
+		return &c
+
+	case *CallExpression:
+		return cloneCall(node)
+
+	case *PropertyExpression:
+		return cloneProperty(node)
+
+	case *AssignExpression:
+		c := *node
+		c.Target = cloneProperty(node.Target)
+		c.Value = cloneExpression(node.Value)
+		return &c
+
+	case *YieldExpression:
+		c := *node
+		c.Value = cloneExpression(node.Value)
+		return &c
+
+	case *SpawnExpression:
+		c := *node
+		c.Call = cloneCall(node.Call)
+		return &c
+	}
+
+	return node
+}
+
+func cloneExpression(exp Expression) Expression {
+	if exp == nil {
+		return nil
+	}
+	return Clone(exp).(Expression)
+}
+
+func cloneExpressions(list []Expression) []Expression {
+	if list == nil {
+		return nil
+	}
+	c := make([]Expression, len(list))
+	for i, exp := range list {
+		c[i] = cloneExpression(exp)
+	}
+	return c
+}
+
+func cloneStatements(list []Statement) []Statement {
+	if list == nil {
+		return nil
+	}
+	c := make([]Statement, len(list))
+	for i, stmt := range list {
+		if stmt != nil {
+			c[i] = Clone(stmt).(Statement)
+		}
+	}
+	return c
+}
+
+func cloneBlock(block *BlockStatement) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+	c := *block
+	c.Statements = cloneStatements(block.Statements)
+	return &c
+}
+
+func cloneIdentifier(ident *Identifier) *Identifier {
+	if ident == nil {
+		return nil
+	}
+	c := *ident
+	c.Type = cloneTypeName(ident.Type)
+	return &c
+}
+
+func cloneIdentifiers(list []*Identifier) []*Identifier {
+	if list == nil {
+		return nil
+	}
+	c := make([]*Identifier, len(list))
+	for i, ident := range list {
+		c[i] = cloneIdentifier(ident)
+	}
+	return c
+}
+
+func cloneTypeName(name *TypeName) *TypeName {
+	if name == nil {
+		return nil
+	}
+	c := *name
+	return &c
+}
+
+func cloneCall(call *CallExpression) *CallExpression {
+	if call == nil {
+		return nil
+	}
+	c := *call
+	c.Function = cloneExpression(call.Function)
+	c.Arguments = cloneExpressions(call.Arguments)
+	return &c
+}
+
+func cloneProperty(property *PropertyExpression) *PropertyExpression {
+	if property == nil {
+		return nil
+	}
+	c := *property
+	c.Object = cloneExpression(property.Object)
+	c.Property = cloneIdentifier(property.Property)
+	return &c
+}
+
+func cloneScope(scope *Scope) *Scope {
+	if scope == nil {
+		return nil
+	}
+	return &Scope{Names: append([]string(nil), scope.Names...)}
+}
@@ -7,6 +7,9 @@ type FunctionExpression struct {
 	Token      token.Token
 	Parameters []*Identifier
 	Body       *BlockStatement
+	ReturnType *TypeName `json:",omitempty"` // 返回类型注解，没有注解时为nil
+	Generator  bool      `json:",omitempty"` // gen fn，调用时返回生成器
+	Scope      *Scope    `json:"-"`          // 函数体的静态作用域，没有解析时为nil
 }
 
 func (fe *FunctionExpression) expressionNode() {}
@@ -16,6 +19,9 @@ func (fe *FunctionExpression) TokenLiteral() string {
 func (fe *FunctionExpression) String() string {
 	var out string
 
+	if fe.Generator {
+		out += "gen "
+	}
 	out += "func("
 	for i, p := range fe.Parameters {
 		if i != 0 {
@@ -24,6 +30,9 @@ func (fe *FunctionExpression) String() string {
 		out += p.String()
 	}
 	out += ") "
+	if fe.ReturnType != nil {
+		out += "-> " + fe.ReturnType.String() + " "
+	}
 	out += fe.Body.String()
 
 	return out
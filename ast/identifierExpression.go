@@ -6,6 +6,12 @@ import "TroInterpreter/token"
 type Identifier struct {
 	Token token.Token // token.IDENT
 	Value string      // 标识符的值
+	Type  *TypeName   `json:",omitempty"` // let和函数参数的类型注解，没有注解时为nil
+
+	// 静态解析的结果，不参与序列化
+	Resolution Resolution `json:"-"`
+	Depth      int        `json:"-"`
+	Slot       int        `json:"-"`
 }
 
 func (i *Identifier) expressionNode() {}
@@ -13,5 +19,8 @@ func (i *Identifier) TokenLiteral() string {
 	return i.Token.Literal
 }
 func (i *Identifier) String() string {
+	if i.Type != nil {
+		return i.Value + ": " + i.Type.String()
+	}
 	return i.Value
 }
@@ -1,11 +1,15 @@
 package ast
 
-import "TroInterpreter/token"
+import (
+	"TroInterpreter/token"
+	"math/big"
+)
 
 // 整型字面量
 type IntegerLiteral struct {
 	Token token.Token
 	Value int64
+	Big   *big.Int `json:",omitempty"` // 超出int64范围的字面量，此时Value为0
 }
 
 func (i *IntegerLiteral) expressionNode() {}
@@ -0,0 +1,275 @@
+package ast
+
+import (
+	"TroInterpreter/token"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 节点类型名与构造函数的映射，解码时根据kind创建节点
+// 新增ast节点时需要在这里注册
+var nodeKinds = map[string]func() Node{
+	"Program":             func() Node { return &Program{} },
+	"LetStatement":        func() Node { return &LetStatement{} },
+	"ReturnStatement":     func() Node { return &ReturnStatement{} },
+	"ExpressionStatement": func() Node { return &ExpressionStatement{} },
+	"BlockStatement":      func() Node { return &BlockStatement{} },
+	"Identifier":          func() Node { return &Identifier{} },
+	"IntegerLiteral":      func() Node { return &IntegerLiteral{} },
+	"StringLiteral":       func() Node { return &StringLiteral{} },
+	"Boolean":             func() Node { return &Boolean{} },
+	"ArrayLiteral":        func() Node { return &ArrayLiteral{} },
+	"IndexExpression":     func() Node { return &IndexExpression{} },
+	"PrefixExpression":    func() Node { return &PrefixExpression{} },
+	"InfixExpression":     func() Node { return &InfixExpression{} },
+	"IfExpression":        func() Node { return &IfExpression{} },
+	"FunctionExpression":  func() Node { return &FunctionExpression{} },
+	"CallExpression":      func() Node { return &CallExpression{} },
+	"MacroLiteral":        func() Node { return &MacroLiteral{} },
+	"PropertyExpression":  func() Node { return &PropertyExpression{} },
+	"AssignExpression":    func() Node { return &AssignExpression{} },
+	"StructStatement":     func() Node { return &StructStatement{} },
+	"EnumStatement":       func() Node { return &EnumStatement{} },
+	"EnumVariant":         func() Node { return &EnumVariant{} },
+	"ImportStatement":     func() Node { return &ImportStatement{} },
+	"ExportStatement":     func() Node { return &ExportStatement{} },
+	"ThrowStatement":      func() Node { return &ThrowStatement{} },
+	"TryExpression":       func() Node { return &TryExpression{} },
+	"TypeName":            func() Node { return &TypeName{} },
+	"YieldExpression":     func() Node { return &YieldExpression{} },
+	"SpawnExpression":     func() Node { return &SpawnExpression{} },
+}
+
+var (
+	nodeType  = reflect.TypeOf((*Node)(nil)).Elem()
+	tokenType = reflect.TypeOf(token.Token{})
+)
+
+// json中的源码位置
+type jsonPosition struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// json中的token
+type jsonToken struct {
+	Type    token.TypeToken `json:"type"`
+	Literal string          `json:"literal"`
+}
+
+// EncodeJSON 把ast节点编码为json
+// 每个节点都是一个对象，包含kind(节点类型)、pos(源码位置)、token以及各个字段，字段名为首字母小写的结构体字段名
+// 标记了json:",omitempty"的字段为零值时省略
+func EncodeJSON(node Node) ([]byte, error) {
+	value, err := encodeNode(reflect.ValueOf(node))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+// DecodeJSON 把EncodeJSON生成的json解码为程序
+func DecodeJSON(data []byte) (*Program, error) {
+	node, err := DecodeNodeJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	program, ok := node.(*Program)
+	if !ok {
+		return nil, fmt.Errorf("json根节点得是 Program,却是 %T", node)
+	}
+	return program, nil
+}
+
+// DecodeNodeJSON 把EncodeJSON生成的json解码为任意ast节点
+func DecodeNodeJSON(data []byte) (Node, error) {
+	return decodeNode(data)
+}
+
+// 编码节点
+func encodeNode(v reflect.Value) (interface{}, error) {
+	if !v.IsValid() || (v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr) && v.IsNil() {
+		return nil, nil
+	}
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+
+	kind := v.Elem().Type().Name()
+	if _, ok := nodeKinds[kind]; !ok {
+		return nil, fmt.Errorf("无法编码节点 %s", v.Type())
+	}
+
+	out := map[string]interface{}{"kind": kind}
+
+	s := v.Elem()
+	for i := 0; i < s.NumField(); i++ {
+		field := s.Type().Field(i)
+		if !field.IsExported() || field.Tag.Get("json") == "-" {
+			continue
+		}
+
+		fv := s.Field(i)
+		if strings.Contains(field.Tag.Get("json"), "omitempty") && fv.IsZero() {
+			continue
+		}
+
+		switch {
+		case field.Type == tokenType:
+			tok := fv.Interface().(token.Token)
+			out["token"] = jsonToken{Type: tok.Type, Literal: tok.Literal}
+			out["pos"] = jsonPosition{Line: tok.Line, Column: tok.Column}
+
+		case field.Type.Implements(nodeType):
+			child, err := encodeNode(fv)
+			if err != nil {
+				return nil, err
+			}
+			out[jsonFieldName(field.Name)] = child
+
+		case field.Type.Kind() == reflect.Slice && field.Type.Elem().Implements(nodeType):
+			if fv.IsNil() {
+				out[jsonFieldName(field.Name)] = nil
+				continue
+			}
+			list := make([]interface{}, fv.Len())
+			for j := 0; j < fv.Len(); j++ {
+				child, err := encodeNode(fv.Index(j))
+				if err != nil {
+					return nil, err
+				}
+				list[j] = child
+			}
+			out[jsonFieldName(field.Name)] = list
+
+		default:
+			out[jsonFieldName(field.Name)] = fv.Interface()
+		}
+	}
+
+	return out, nil
+}
+
+// 解码节点，null解码为nil
+func decodeNode(data []byte) (Node, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	if fields == nil {
+		return nil, nil
+	}
+
+	var kind string
+	if err := json.Unmarshal(fields["kind"], &kind); err != nil {
+		return nil, fmt.Errorf("节点缺少kind: %s", err)
+	}
+	newNode, ok := nodeKinds[kind]
+	if !ok {
+		return nil, fmt.Errorf("未知的节点类型 %q", kind)
+	}
+
+	node := newNode()
+	s := reflect.ValueOf(node).Elem()
+	for i := 0; i < s.NumField(); i++ {
+		field := s.Type().Field(i)
+		if !field.IsExported() || field.Tag.Get("json") == "-" {
+			continue
+		}
+
+		fv := s.Field(i)
+		switch {
+		case field.Type == tokenType:
+			var tok jsonToken
+			var pos jsonPosition
+			if raw, ok := fields["token"]; ok {
+				if err := json.Unmarshal(raw, &tok); err != nil {
+					return nil, fmt.Errorf("%s.token: %s", kind, err)
+				}
+			}
+			if raw, ok := fields["pos"]; ok {
+				if err := json.Unmarshal(raw, &pos); err != nil {
+					return nil, fmt.Errorf("%s.pos: %s", kind, err)
+				}
+			}
+			fv.Set(reflect.ValueOf(token.Token{
+				Type:    tok.Type,
+				Literal: tok.Literal,
+				Line:    pos.Line,
+				Column:  pos.Column,
+			}))
+
+		case field.Type.Implements(nodeType):
+			raw, ok := fields[jsonFieldName(field.Name)]
+			if !ok {
+				continue
+			}
+			child, err := decodeNode(raw)
+			if err != nil {
+				return nil, err
+			}
+			if err := setNode(fv, child, kind, field.Name); err != nil {
+				return nil, err
+			}
+
+		case field.Type.Kind() == reflect.Slice && field.Type.Elem().Implements(nodeType):
+			raw, ok := fields[jsonFieldName(field.Name)]
+			if !ok {
+				continue
+			}
+			var list []json.RawMessage
+			if err := json.Unmarshal(raw, &list); err != nil {
+				return nil, fmt.Errorf("%s.%s: %s", kind, jsonFieldName(field.Name), err)
+			}
+			if list == nil {
+				continue
+			}
+			slice := reflect.MakeSlice(field.Type, len(list), len(list))
+			for j, item := range list {
+				child, err := decodeNode(item)
+				if err != nil {
+					return nil, err
+				}
+				if err := setNode(slice.Index(j), child, kind, field.Name); err != nil {
+					return nil, err
+				}
+			}
+			fv.Set(slice)
+
+		default:
+			raw, ok := fields[jsonFieldName(field.Name)]
+			if !ok {
+				continue
+			}
+			if err := json.Unmarshal(raw, fv.Addr().Interface()); err != nil {
+				return nil, fmt.Errorf("%s.%s: %s", kind, jsonFieldName(field.Name), err)
+			}
+		}
+	}
+
+	return node, nil
+}
+
+// 把解码出的子节点赋值给字段，检查类型是否匹配
+func setNode(fv reflect.Value, child Node, kind, name string) error {
+	if child == nil {
+		return nil
+	}
+	cv := reflect.ValueOf(child)
+	if !cv.Type().AssignableTo(fv.Type()) {
+		return fmt.Errorf("%s.%s 不能是 %s", kind, jsonFieldName(name), cv.Elem().Type().Name())
+	}
+	fv.Set(cv)
+	return nil
+}
+
+// 结构体字段名转为json字段名，首字母小写
+func jsonFieldName(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToLower(r)) + name[size:]
+}
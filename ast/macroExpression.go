@@ -0,0 +1,31 @@
+package ast
+
+import "TroInterpreter/token"
+
+// 宏字面量
+type MacroLiteral struct {
+	Token      token.Token // macro
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+func (ml *MacroLiteral) expressionNode() {}
+func (ml *MacroLiteral) TokenLiteral() string {
+	return ml.Token.Literal
+}
+func (ml *MacroLiteral) String() string {
+	var out string
+
+	out += ml.TokenLiteral()
+	out += "("
+	for i, p := range ml.Parameters {
+		if i != 0 {
+			out += ", "
+		}
+		out += p.String()
+	}
+	out += ") "
+	out += ml.Body.String()
+
+	return out
+}
@@ -0,0 +1,65 @@
+package ast
+
+import (
+	"TroInterpreter/token"
+	"bytes"
+	"path"
+	"strings"
+)
+
+// 导入模块，import "lib/math.tro" as math
+type ImportStatement struct {
+	Token token.Token // import
+	Path  *StringLiteral
+	Alias *Identifier // 省略as时为nil
+}
+
+func (is *ImportStatement) statementNode()       {}
+func (is *ImportStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *ImportStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(is.TokenLiteral() + " ")
+	out.WriteString(`"` + is.Path.Value + `"`)
+	if is.Alias != nil {
+		out.WriteString(" as ")
+		out.WriteString(is.Alias.String())
+	}
+	out.WriteString(";")
+
+	return out.String()
+}
+
+// Name 返回模块绑定的名称，省略as时使用去掉扩展名的文件名
+func (is *ImportStatement) Name() string {
+	if is.Alias != nil {
+		return is.Alias.Value
+	}
+	base := path.Base(is.Path.Value)
+	return strings.TrimSuffix(base, path.Ext(base))
+}
+
+// 导出，export let x = 1;
+type ExportStatement struct {
+	Token     token.Token // export
+	Statement Statement   // let、struct或enum语句
+}
+
+func (es *ExportStatement) statementNode()       {}
+func (es *ExportStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExportStatement) String() string {
+	return es.TokenLiteral() + " " + es.Statement.String()
+}
+
+// Names 返回导出的名称
+func (es *ExportStatement) Names() []string {
+	switch stmt := es.Statement.(type) {
+	case *LetStatement:
+		return []string{stmt.Name.Value}
+	case *StructStatement:
+		return []string{stmt.Name.Value}
+	case *EnumStatement:
+		return []string{stmt.Name.Value}
+	}
+	return nil
+}
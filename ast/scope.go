@@ -0,0 +1,26 @@
+package ast
+
+// 标识符的静态解析结果，由evaluator.Resolve填写
+type Resolution int
+
+const (
+	Unresolved Resolution = iota // 没有解析，按名称在环境中逐层查找
+	Local                        // 向外第Depth层静态作用域中的第Slot个变量
+	Global                       // 顶层环境中的变量或内置函数，按名称查找，顶层环境在向外第Depth层
+)
+
+// Scope 函数体或catch块的静态作用域，Names按槽的顺序记录其中声明的变量(包括参数)
+// 块不产生新的作用域，if和try中声明的变量属于所在的函数
+type Scope struct {
+	Names []string
+}
+
+// Slot 返回变量在作用域中的槽，没有声明时返回-1
+func (s *Scope) Slot(name string) int {
+	for i, n := range s.Names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,15 @@
+package ast
+
+import "TroInterpreter/token"
+
+// spawn表达式，在新的任务中求值函数调用，表达式的值为任务，函数和参数在当前任务中求值
+type SpawnExpression struct {
+	Token token.Token // spawn
+	Call  *CallExpression
+}
+
+func (se *SpawnExpression) expressionNode()      {}
+func (se *SpawnExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SpawnExpression) String() string {
+	return se.TokenLiteral() + " " + se.Call.String()
+}
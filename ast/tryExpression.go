@@ -0,0 +1,48 @@
+package ast
+
+import (
+	"TroInterpreter/token"
+	"bytes"
+)
+
+// try表达式，try { } catch (e) { } finally { }
+type TryExpression struct {
+	Token   token.Token // try
+	Body    *BlockStatement
+	Param   *Identifier     // catch绑定的错误，没有catch时为nil
+	Catch   *BlockStatement // 没有catch时为nil
+	Finally *BlockStatement // 没有finally时为nil
+
+	CatchScope *Scope `json:"-"` // catch块的静态作用域，没有解析时为nil
+}
+
+func (te *TryExpression) expressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try ")
+	out.WriteString(te.Body.String())
+	if te.Catch != nil {
+		out.WriteString(" catch (" + te.Param.String() + ") ")
+		out.WriteString(te.Catch.String())
+	}
+	if te.Finally != nil {
+		out.WriteString(" finally ")
+		out.WriteString(te.Finally.String())
+	}
+
+	return out.String()
+}
+
+// 抛出异常，throw 表达式;
+type ThrowStatement struct {
+	Token token.Token // throw
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode()       {}
+func (ts *ThrowStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *ThrowStatement) String() string {
+	return ts.TokenLiteral() + " " + ts.Value.String() + ";"
+}
@@ -0,0 +1,17 @@
+package ast
+
+import "TroInterpreter/token"
+
+// 类型注解，如 let n: int 中的int、fn() -> bool 中的bool
+// 内置的类型有int、string、bool、array、fn、null和any，其余的名称是结构体或枚举
+type TypeName struct {
+	Token token.Token // token.IDENT，fn类型为token.FUNCTION
+	Name  string
+}
+
+func (tn *TypeName) TokenLiteral() string {
+	return tn.Token.Literal
+}
+func (tn *TypeName) String() string {
+	return tn.Name
+}
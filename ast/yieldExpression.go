@@ -0,0 +1,15 @@
+package ast
+
+import "TroInterpreter/token"
+
+// yield表达式，只能出现在生成器函数中，交出值并挂起生成器，恢复后表达式的值为null
+type YieldExpression struct {
+	Token token.Token // yield
+	Value Expression
+}
+
+func (ye *YieldExpression) expressionNode()      {}
+func (ye *YieldExpression) TokenLiteral() string { return ye.Token.Literal }
+func (ye *YieldExpression) String() string {
+	return ye.TokenLiteral() + " " + ye.Value.String()
+}
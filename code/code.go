@@ -0,0 +1,238 @@
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// 字节码指令序列
+type Instructions []byte
+
+// 操作码
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota //常量池中的常量入栈
+	OpPop                    //弹出栈顶
+	OpNull                   //null入栈
+	OpNone                   //没有值的语句(let等)的结果入栈，与求值器的nil对应
+	OpTrue                   //true入栈
+	OpFalse                  //false入栈
+
+	OpAdd         //+
+	OpSub         //-
+	OpMul         //*
+	OpDiv         ///
+	OpEqual       //==
+	OpNotEqual    //!=
+	OpLessThan    //<
+	OpGreaterThan //>
+	OpMinus       //前缀-
+	OpBang        //前缀!
+
+	OpJump          //无条件跳转到操作数所指的位置
+	OpJumpNotTruthy //弹出栈顶，条件不成立时跳转
+
+	OpGetGlobal    //读取全局变量，未定义时报错
+	OpLookupGlobal //读取全局变量，未定义时为nil，用于方法调用的备选函数
+	OpSetGlobal    //弹出栈顶，赋给全局变量
+	OpGetLocal     //读取当前调用的局部变量
+	OpSetLocal     //弹出栈顶，赋给当前调用的局部变量
+	OpGetOuter     //读取外层函数的局部变量，操作数为向外的层数和下标
+	OpLookupLocal  //读取当前调用的局部变量，未定义时为nil，之后读取外层的同名变量作为备选
+	OpLookupOuter  //读取外层函数的局部变量，未定义时为nil，之后读取外层的同名变量作为备选
+	OpJumpNotNil   //栈顶不为nil时跳转，否则弹出栈顶
+
+	OpArray       //用栈顶的n个值创建数组
+	OpIndex       //索引
+	OpGetProperty //读取属性，操作数为属性名在常量池中的下标
+	OpSetProperty //给属性赋值，栈上依次为接收者和值
+
+	OpClosure     //用常量池中的编译后函数创建闭包
+	OpCall        //调用函数，栈上依次为函数和n个参数
+	OpTailCall    //尾调用，用被调用的函数替换当前的调用
+	OpMethodCall  //方法调用，栈上依次为接收者、n个参数和备选函数
+	OpSpawn       //在新的任务中调用，操作数为方法名在常量池中的下标(不是方法调用时为NoOffset)和参数个数
+	OpReturnValue //从当前调用返回栈顶的值
+
+	OpThrow  //弹出栈顶并抛出
+	OpTry    //执行try，操作数为catch、finally和结束的位置，没有时为NoOffset
+	OpEndTry //try的主体、catch或finally执行结束
+	OpYield  //弹出栈顶交给生成器，恢复后null入栈
+
+	OpDeclare //执行struct或enum声明，操作数为包裹声明的引用在常量池中的下标
+	OpImport  //导入模块，操作数为模块路径在常量池中的下标
+	OpQuote   //创建引用，操作数为包裹quote调用的引用在常量池中的下标和unquote的个数
+)
+
+// NoOffset 表示try没有catch或finally，或者spawn调用的不是方法
+const NoOffset = 0xFFFF
+
+// 操作码的定义
+type Definition struct {
+	Name          string
+	OperandWidths []int //每个操作数的字节数
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+	OpNull:     {"OpNull", []int{}},
+	OpNone:     {"OpNone", []int{}},
+	OpTrue:     {"OpTrue", []int{}},
+	OpFalse:    {"OpFalse", []int{}},
+
+	OpAdd:         {"OpAdd", []int{}},
+	OpSub:         {"OpSub", []int{}},
+	OpMul:         {"OpMul", []int{}},
+	OpDiv:         {"OpDiv", []int{}},
+	OpEqual:       {"OpEqual", []int{}},
+	OpNotEqual:    {"OpNotEqual", []int{}},
+	OpLessThan:    {"OpLessThan", []int{}},
+	OpGreaterThan: {"OpGreaterThan", []int{}},
+	OpMinus:       {"OpMinus", []int{}},
+	OpBang:        {"OpBang", []int{}},
+
+	OpJump:          {"OpJump", []int{2}},
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+
+	OpGetGlobal:    {"OpGetGlobal", []int{2}},
+	OpLookupGlobal: {"OpLookupGlobal", []int{2}},
+	OpSetGlobal:    {"OpSetGlobal", []int{2}},
+	OpGetLocal:     {"OpGetLocal", []int{2}},
+	OpSetLocal:     {"OpSetLocal", []int{2}},
+	OpGetOuter:     {"OpGetOuter", []int{1, 2}},
+	OpLookupLocal:  {"OpLookupLocal", []int{2}},
+	OpLookupOuter:  {"OpLookupOuter", []int{1, 2}},
+	OpJumpNotNil:   {"OpJumpNotNil", []int{2}},
+
+	OpArray:       {"OpArray", []int{2}},
+	OpIndex:       {"OpIndex", []int{}},
+	OpGetProperty: {"OpGetProperty", []int{2}},
+	OpSetProperty: {"OpSetProperty", []int{2}},
+
+	OpClosure:     {"OpClosure", []int{2}},
+	OpCall:        {"OpCall", []int{1}},
+	OpTailCall:    {"OpTailCall", []int{1}},
+	OpMethodCall:  {"OpMethodCall", []int{2, 1}},
+	OpSpawn:       {"OpSpawn", []int{2, 1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+
+	OpThrow:  {"OpThrow", []int{}},
+	OpTry:    {"OpTry", []int{2, 2, 2}},
+	OpEndTry: {"OpEndTry", []int{}},
+	OpYield:  {"OpYield", []int{}},
+
+	OpDeclare: {"OpDeclare", []int{2}},
+	OpImport:  {"OpImport", []int{2}},
+	OpQuote:   {"OpQuote", []int{2, 1}},
+}
+
+// Lookup 查找操作码的定义
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("未定义的操作码 %d", op)
+	}
+	return def, nil
+}
+
+// Make 把操作码和操作数编码为一条指令，操作数按大端序存放
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	length := 1
+	for _, w := range def.OperandWidths {
+		length += w
+	}
+
+	instruction := make([]byte, length)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// ReadOperands 按定义解码指令的操作数，返回操作数和读取的字节数
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
+
+// String 反汇编，每行一条指令，格式为 位置 操作码 操作数
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: 操作数个数错误，期望=%d，实际=%d\n", operandCount, len(operands))
+	}
+
+	out := def.Name
+	for _, operand := range operands {
+		out += fmt.Sprintf(" %d", operand)
+	}
+	return out
+}
+
+// Source 指令对应的源码信息，用于报错
+type Source struct {
+	Line   int
+	Column int
+	Name   string // 读取的标识符或被调用的函数名
+}
@@ -0,0 +1,699 @@
+package compiler
+
+import (
+	"TroInterpreter/ast"
+	"TroInterpreter/code"
+	"TroInterpreter/evaluator"
+	"TroInterpreter/object"
+	"fmt"
+)
+
+// 编译器，把宏展开后的程序编译为字节码
+type Compiler struct {
+	constants   []object.Object
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+}
+
+// 正在编译的函数(或顶层程序)
+type CompilationScope struct {
+	instructions code.Instructions
+	sources      map[int]code.Source
+	branches     int // 正在编译的if和try的分支的层数
+}
+
+// 编译的结果
+type Bytecode struct {
+	Main      *object.CompiledFunction // 顶层程序
+	Constants []object.Object
+}
+
+func New() *Compiler {
+	return NewWithState(NewSymbolTable(), []object.Object{})
+}
+
+// NewWithState 使用已有的符号表和常量池创建编译器，交互式环境中每次输入都在之前的基础上编译
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	return &Compiler{
+		constants:   constants,
+		symbolTable: s,
+		scopes:      []CompilationScope{{sources: map[int]code.Source{}}},
+	}
+}
+
+// Compile 编译程序，程序的值为最后一条语句的值，与求值器一致
+func (c *Compiler) Compile(program *ast.Program) error {
+	if err := c.compileStatements(program.Statements); err != nil {
+		return err
+	}
+	c.emit(code.OpReturnValue)
+
+	if len(c.currentInstructions()) >= code.NoOffset {
+		return fmt.Errorf("程序的字节码超出%d字节", code.NoOffset)
+	}
+	if len(c.constants) > code.NoOffset || c.symbolTable.NumGlobals() > code.NoOffset {
+		return fmt.Errorf("常量或全局变量超出%d个", code.NoOffset)
+	}
+	return nil
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Main: &object.CompiledFunction{
+			Instructions: c.currentInstructions(),
+			NumLocals:    c.symbolTable.NumLocals(),
+			Sources:      c.scopes[c.scopeIndex].sources,
+		},
+		Constants: c.constants,
+	}
+}
+
+// 编译语句序列，在栈上留下最后一条语句的值，let等没有值的语句留下nil
+func (c *Compiler) compileStatements(statements []ast.Statement) error {
+	if len(statements) == 0 {
+		c.emit(code.OpNone)
+		return nil
+	}
+
+	for i, statement := range statements {
+		pushed, err := c.compileStatement(statement)
+		if err != nil {
+			return err
+		}
+		c.endStatement(pushed, i == len(statements)-1)
+	}
+	return nil
+}
+
+// 语句结束：中间语句的值出栈，最后一条语句没有值时留下nil
+func (c *Compiler) endStatement(pushed, last bool) {
+	if pushed && !last {
+		c.emit(code.OpPop)
+	}
+	if !pushed && last {
+		c.emit(code.OpNone)
+	}
+}
+
+// 编译语句，返回语句是否在栈上留下了值
+func (c *Compiler) compileStatement(statement ast.Statement) (bool, error) {
+	switch node := statement.(type) {
+	case *ast.ExpressionStatement:
+		return true, c.compileExpression(node.Expression)
+
+	case *ast.LetStatement:
+		//先编译值，值中的同名变量是外层的变量
+		if err := c.compileExpression(node.Value); err != nil {
+			return false, err
+		}
+		c.setSymbol(c.define(node.Name.Value))
+		return false, nil
+
+	case *ast.ReturnStatement:
+		if err := c.compileExpression(node.ReturnValue); err != nil {
+			return false, err
+		}
+		c.emit(code.OpReturnValue)
+		return true, nil
+
+	case *ast.ThrowStatement:
+		if err := c.compileExpression(node.Value); err != nil {
+			return false, err
+		}
+		c.emitAt(node, "", code.OpThrow)
+		return true, nil
+
+	case *ast.StructStatement:
+		c.emitAt(node, "", code.OpDeclare, c.addConstant(&object.Quote{Node: node}))
+		c.setSymbol(c.define(node.Name.Value))
+		return false, nil
+
+	case *ast.EnumStatement:
+		c.emitAt(node, "", code.OpDeclare, c.addConstant(&object.Quote{Node: node}))
+		c.setSymbol(c.define(node.Name.Value))
+		return false, nil
+
+	case *ast.ImportStatement:
+		c.emitAt(node, "", code.OpImport, c.addConstant(&object.String{Value: node.Path.Value}))
+		c.setSymbol(c.define(node.Name()))
+		return false, nil
+
+	case *ast.ExportStatement:
+		//导出的名称在加载模块时收集
+		return c.compileStatement(node.Statement)
+	}
+
+	return false, fmt.Errorf("无法编译语句 %T", statement)
+}
+
+// 编译表达式，在栈上留下表达式的值
+func (c *Compiler) compileExpression(expression ast.Expression) error {
+	switch node := expression.(type) {
+	case *ast.IntegerLiteral:
+		var integer object.Object = &object.Integer{Value: node.Value}
+		if node.Big != nil {
+			integer = &object.BigInteger{Value: node.Big}
+		}
+		c.emit(code.OpConstant, c.addConstant(integer))
+
+	case *ast.StringLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: node.Value}))
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.Identifier:
+		c.loadIdentifier(node)
+
+	case *ast.ArrayLiteral:
+		for _, element := range node.Elements {
+			if err := c.compileExpression(element); err != nil {
+				return err
+			}
+		}
+		c.emitAt(node, "", code.OpArray, len(node.Elements))
+
+	case *ast.IndexExpression:
+		if err := c.compileExpression(node.Left); err != nil {
+			return err
+		}
+		if err := c.compileExpression(node.Index); err != nil {
+			return err
+		}
+		c.emitAt(node, "", code.OpIndex)
+
+	case *ast.PropertyExpression:
+		if err := c.compileExpression(node.Object); err != nil {
+			return err
+		}
+		c.emitAt(node, "", code.OpGetProperty, c.addConstant(&object.String{Value: node.Property.Value}))
+
+	case *ast.AssignExpression:
+		if err := c.compileExpression(node.Target.Object); err != nil {
+			return err
+		}
+		if err := c.compileExpression(node.Value); err != nil {
+			return err
+		}
+		c.emitAt(node, "", code.OpSetProperty, c.addConstant(&object.String{Value: node.Target.Property.Value}))
+
+	case *ast.PrefixExpression:
+		if err := c.compileExpression(node.Right); err != nil {
+			return err
+		}
+		switch node.Operator {
+		case "-":
+			c.emitAt(node, "", code.OpMinus)
+		case "!":
+			c.emitAt(node, "", code.OpBang)
+		default:
+			return fmt.Errorf("未知的前缀运算符 %s", node.Operator)
+		}
+
+	case *ast.InfixExpression:
+		if err := c.compileExpression(node.Left); err != nil {
+			return err
+		}
+		if err := c.compileExpression(node.Right); err != nil {
+			return err
+		}
+		op, ok := infixOperators[node.Operator]
+		if !ok {
+			return fmt.Errorf("未知的中缀运算符 %s", node.Operator)
+		}
+		c.emitAt(node, "", op)
+
+	case *ast.IfExpression:
+		return c.compileIf(node, func(block *ast.BlockStatement) error {
+			return c.compileStatements(block.Statements)
+		})
+
+	case *ast.TryExpression:
+		return c.compileTry(node)
+
+	case *ast.FunctionExpression:
+		return c.compileFunction(node)
+
+	case *ast.CallExpression:
+		return c.compileCall(node, false)
+
+	case *ast.YieldExpression:
+		if err := c.compileExpression(node.Value); err != nil {
+			return err
+		}
+		c.emitAt(node, "", code.OpYield)
+
+	case *ast.SpawnExpression:
+		return c.compileSpawn(node)
+
+	case *ast.MacroLiteral:
+		//宏已经展开，留在函数中的宏定义没有值
+		c.emit(code.OpNone)
+
+	default:
+		return fmt.Errorf("无法编译表达式 %T", expression)
+	}
+
+	return nil
+}
+
+// 中缀运算符对应的操作码
+var infixOperators = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	"<":  code.OpLessThan,
+	">":  code.OpGreaterThan,
+}
+
+// 编译if表达式，branch编译各个分支，没有else时值为null
+func (c *Compiler) compileIf(node *ast.IfExpression, branch func(block *ast.BlockStatement) error) error {
+	if err := c.compileExpression(node.Condition); err != nil {
+		return err
+	}
+	jumpNotTruthy := c.emit(code.OpJumpNotTruthy, code.NoOffset)
+
+	if err := c.inBranch(func() error { return branch(node.Consequence) }); err != nil {
+		return err
+	}
+	jump := c.emit(code.OpJump, code.NoOffset)
+
+	c.changeOperand(jumpNotTruthy, len(c.currentInstructions()))
+	if node.Alternative == nil {
+		c.emit(code.OpNull)
+	} else if err := c.inBranch(func() error { return branch(node.Alternative) }); err != nil {
+		return err
+	}
+	c.changeOperand(jump, len(c.currentInstructions()))
+	return nil
+}
+
+// 编译try表达式
+// 主体、catch和finally依次排列，各自以OpEndTry结束，由虚拟机决定执行哪些部分
+// catch开始时错误值在栈顶，赋给catch块中的参数
+func (c *Compiler) compileTry(node *ast.TryExpression) error {
+	try := c.emit(code.OpTry, code.NoOffset, code.NoOffset, code.NoOffset)
+	catchPos, finallyPos := code.NoOffset, code.NoOffset
+
+	//主体可能在定义变量之前出错，各个部分都是分支
+	if err := c.inBranch(func() error { return c.compileStatements(node.Body.Statements) }); err != nil {
+		return err
+	}
+	c.emit(code.OpEndTry)
+
+	if node.Catch != nil {
+		catchPos = len(c.currentInstructions())
+		c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+		c.setSymbol(c.symbolTable.DefineParameter(node.Param.Value))
+		c.hoist(node.Catch)
+		err := c.inBranch(func() error { return c.compileStatements(node.Catch.Statements) })
+		c.symbolTable = c.symbolTable.Outer
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpEndTry)
+	}
+
+	if node.Finally != nil {
+		finallyPos = len(c.currentInstructions())
+		if err := c.inBranch(func() error { return c.compileStatements(node.Finally.Statements) }); err != nil {
+			return err
+		}
+		c.emit(code.OpEndTry)
+	}
+
+	c.replaceInstruction(try, code.Make(code.OpTry, catchPos, finallyPos, len(c.currentInstructions())))
+	return nil
+}
+
+// 编译分支，其中定义的变量在运行时不一定有值
+func (c *Compiler) inBranch(compile func() error) error {
+	c.scopes[c.scopeIndex].branches++
+	defer func() { c.scopes[c.scopeIndex].branches-- }()
+	return compile()
+}
+
+// 定义变量，分支中定义的变量读取时需要外层的同名变量作为备选，见SymbolTable.ResolveAll
+func (c *Compiler) define(name string) Symbol {
+	if c.scopes[c.scopeIndex].branches > 0 {
+		return c.symbolTable.DefineInBranch(name)
+	}
+	return c.symbolTable.Define(name)
+}
+
+// 编译函数，函数体中的变量提前声明
+func (c *Compiler) compileFunction(node *ast.FunctionExpression) error {
+	c.enterScope()
+	for _, param := range node.Parameters {
+		c.symbolTable.DefineParameter(param.Value)
+	}
+	c.hoist(node.Body)
+
+	//生成器函数体与求值器一样不做尾调用优化
+	var err error
+	if node.Generator {
+		err = c.compileStatements(node.Body.Statements)
+	} else {
+		err = c.compileTailStatements(node.Body.Statements, true)
+	}
+	if err != nil {
+		c.leaveScope()
+		return err
+	}
+	c.emit(code.OpReturnValue)
+
+	numLocals := c.symbolTable.NumLocals()
+	instructions, sources := c.leaveScope()
+	if len(instructions) >= code.NoOffset {
+		return fmt.Errorf("函数的字节码超出%d字节", code.NoOffset)
+	}
+
+	fn := &object.CompiledFunction{
+		Instructions:  instructions,
+		NumLocals:     numLocals,
+		NumParameters: len(node.Parameters),
+		Sources:       sources,
+		Parameters:    node.Parameters,
+		Body:          node.Body,
+		ReturnType:    node.ReturnType,
+		Generator:     node.Generator,
+	}
+	c.emit(code.OpClosure, c.addConstant(fn))
+	return nil
+}
+
+// 编译函数体中的语句，尾部位置与求值器相同：return的值、函数体最后一个表达式，以及if分支中处于这些位置的表达式
+func (c *Compiler) compileTailStatements(statements []ast.Statement, last bool) error {
+	if len(statements) == 0 {
+		c.emit(code.OpNone)
+		return nil
+	}
+
+	for i, statement := range statements {
+		tail := last && i == len(statements)-1
+		var err error
+		pushed := true
+
+		switch node := statement.(type) {
+		case *ast.ReturnStatement:
+			if err = c.compileTailExpression(node.ReturnValue, true); err == nil {
+				c.emit(code.OpReturnValue)
+			}
+		case *ast.ExpressionStatement:
+			err = c.compileTailExpression(node.Expression, tail)
+		default:
+			pushed, err = c.compileStatement(statement)
+		}
+		if err != nil {
+			return err
+		}
+		c.endStatement(pushed, i == len(statements)-1)
+	}
+	return nil
+}
+
+// 编译函数体中的表达式，tail时调用编译为尾调用
+func (c *Compiler) compileTailExpression(expression ast.Expression, tail bool) error {
+	switch node := expression.(type) {
+	case *ast.IfExpression:
+		//分支中的return仍然处于尾部位置
+		return c.compileIf(node, func(block *ast.BlockStatement) error {
+			return c.compileTailStatements(block.Statements, tail)
+		})
+	case *ast.CallExpression:
+		return c.compileCall(node, tail)
+	}
+	return c.compileExpression(expression)
+}
+
+// 编译调用，quote和方法调用不做尾调用优化
+func (c *Compiler) compileCall(node *ast.CallExpression, tail bool) error {
+	if node.Function.TokenLiteral() == "quote" {
+		return c.compileQuote(node)
+	}
+	if property, ok := node.Function.(*ast.PropertyExpression); ok {
+		return c.compileMethodCall(node, property)
+	}
+
+	if err := c.compileExpression(node.Function); err != nil {
+		return err
+	}
+	if err := c.compileArguments(node.Arguments); err != nil {
+		return err
+	}
+
+	op := code.OpCall
+	if tail {
+		op = code.OpTailCall
+	}
+	c.emitAt(node.Function, frameName(node), op, len(node.Arguments))
+	return nil
+}
+
+// 编译方法调用，接收者和参数之后是调用处名为方法名的变量，作为找不到属性和内置方法时的备选
+func (c *Compiler) compileMethodCall(node *ast.CallExpression, property *ast.PropertyExpression) error {
+	if err := c.compileMethodCallee(node, property); err != nil {
+		return err
+	}
+	c.emitAt(node.Function, frameName(node), code.OpMethodCall, c.addConstant(&object.String{Value: property.Property.Value}), len(node.Arguments))
+	return nil
+}
+
+// 依次编译方法调用的接收者、参数和备选函数
+func (c *Compiler) compileMethodCallee(node *ast.CallExpression, property *ast.PropertyExpression) error {
+	if err := c.compileExpression(property.Object); err != nil {
+		return err
+	}
+	if err := c.compileArguments(node.Arguments); err != nil {
+		return err
+	}
+
+	symbol := c.symbolTable.ResolveOrReserve(property.Property.Value)
+	if symbol.Scope == GlobalScope {
+		c.emit(code.OpLookupGlobal, symbol.Index)
+	} else {
+		c.loadSymbol(property.Property, symbol)
+	}
+	return nil
+}
+
+// 编译spawn，栈上的内容与调用或方法调用相同，quote在求值器中也不能spawn，按普通的函数编译
+func (c *Compiler) compileSpawn(node *ast.SpawnExpression) error {
+	call := node.Call
+	name := code.NoOffset
+	if property, ok := call.Function.(*ast.PropertyExpression); ok {
+		if err := c.compileMethodCallee(call, property); err != nil {
+			return err
+		}
+		name = c.addConstant(&object.String{Value: property.Property.Value})
+	} else {
+		if err := c.compileExpression(call.Function); err != nil {
+			return err
+		}
+		if err := c.compileArguments(call.Arguments); err != nil {
+			return err
+		}
+	}
+
+	c.emitAt(call.Function, frameName(call), code.OpSpawn, name, len(call.Arguments))
+	return nil
+}
+
+func (c *Compiler) compileArguments(arguments []ast.Expression) error {
+	if len(arguments) > 0xFF {
+		return fmt.Errorf("参数超出%d个", 0xFF)
+	}
+	for _, arg := range arguments {
+		if err := c.compileExpression(arg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 编译quote调用，其中unquote的参数在当前作用域中求值
+func (c *Compiler) compileQuote(node *ast.CallExpression) error {
+	args := evaluator.UnquoteArguments(node)
+	if err := c.compileArguments(args); err != nil {
+		return err
+	}
+	c.emitAt(node.Function, "", code.OpQuote, c.addConstant(&object.Quote{Node: node}), len(args))
+	return nil
+}
+
+// 调用帧中显示的函数名，与求值器一致
+func frameName(call *ast.CallExpression) string {
+	switch function := call.Function.(type) {
+	case *ast.Identifier:
+		return function.Value
+	case *ast.PropertyExpression:
+		return function.String()
+	}
+	return "<匿名函数>"
+}
+
+// 读取变量，同名的局部变量还没有赋值时依次读取外层的变量，最外层的也没有定义时报错
+func (c *Compiler) loadIdentifier(node *ast.Identifier) {
+	symbols := c.symbolTable.ResolveAll(node.Value)
+	last := len(symbols) - 1
+
+	var jumps []int
+	for _, symbol := range symbols[:last] {
+		if symbol.Scope == LocalScope {
+			c.emit(code.OpLookupLocal, symbol.Index)
+		} else {
+			c.emit(code.OpLookupOuter, symbol.Depth, symbol.Index)
+		}
+		jumps = append(jumps, c.emit(code.OpJumpNotNil, code.NoOffset))
+	}
+	c.loadSymbol(node, symbols[last])
+	for _, jump := range jumps {
+		c.changeOperand(jump, len(c.currentInstructions()))
+	}
+}
+
+// 读取变量
+func (c *Compiler) loadSymbol(node *ast.Identifier, symbol Symbol) {
+	switch symbol.Scope {
+	case GlobalScope:
+		c.emitAt(node, node.Value, code.OpGetGlobal, symbol.Index)
+	case LocalScope:
+		c.emitAt(node, node.Value, code.OpGetLocal, symbol.Index)
+	case OuterScope:
+		c.emitAt(node, node.Value, code.OpGetOuter, symbol.Depth, symbol.Index)
+	}
+}
+
+// 把栈顶的值赋给变量
+func (c *Compiler) setSymbol(symbol Symbol) {
+	if symbol.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, symbol.Index)
+	} else {
+		c.emit(code.OpSetLocal, symbol.Index)
+	}
+}
+
+// 提前声明node中定义的变量，不进入函数和catch块，它们有自己的作用域
+func (c *Compiler) hoist(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.BlockStatement:
+		for _, statement := range node.Statements {
+			c.hoist(statement)
+		}
+	case *ast.LetStatement:
+		c.symbolTable.Declare(node.Name.Value)
+		c.hoist(node.Value)
+	case *ast.StructStatement:
+		c.symbolTable.Declare(node.Name.Value)
+	case *ast.EnumStatement:
+		c.symbolTable.Declare(node.Name.Value)
+	case *ast.ImportStatement:
+		c.symbolTable.Declare(node.Name())
+	case *ast.ExportStatement:
+		c.hoist(node.Statement)
+	case *ast.ExpressionStatement:
+		c.hoist(node.Expression)
+	case *ast.ReturnStatement:
+		c.hoist(node.ReturnValue)
+	case *ast.ThrowStatement:
+		c.hoist(node.Value)
+	case *ast.YieldExpression:
+		c.hoist(node.Value)
+	case *ast.IfExpression:
+		c.hoist(node.Condition)
+		c.hoist(node.Consequence)
+		if node.Alternative != nil {
+			c.hoist(node.Alternative)
+		}
+	case *ast.TryExpression:
+		c.hoist(node.Body)
+		if node.Finally != nil {
+			c.hoist(node.Finally)
+		}
+	case *ast.PrefixExpression:
+		c.hoist(node.Right)
+	case *ast.InfixExpression:
+		c.hoist(node.Left)
+		c.hoist(node.Right)
+	case *ast.IndexExpression:
+		c.hoist(node.Left)
+		c.hoist(node.Index)
+	case *ast.PropertyExpression:
+		c.hoist(node.Object)
+	case *ast.AssignExpression:
+		c.hoist(node.Target.Object)
+		c.hoist(node.Value)
+	case *ast.ArrayLiteral:
+		for _, element := range node.Elements {
+			c.hoist(element)
+		}
+	case *ast.CallExpression:
+		c.hoist(node.Function)
+		for _, arg := range node.Arguments {
+			c.hoist(arg)
+		}
+	case *ast.SpawnExpression:
+		c.hoist(node.Call)
+	}
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+// 生成指令，返回指令的位置
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	ins := code.Make(op, operands...)
+	pos := len(c.currentInstructions())
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
+	return pos
+}
+
+// 生成可能出错的指令，记录对应的源码位置，name为读取的变量或被调用的函数名
+func (c *Compiler) emitAt(node ast.Node, name string, op code.Opcode, operands ...int) int {
+	pos := c.emit(op, operands...)
+	line, column := ast.Position(node)
+	c.scopes[c.scopeIndex].sources[pos] = code.Source{Line: line, Column: column, Name: name}
+	return pos
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+	copy(ins[pos:], newInstruction)
+}
+
+// 修改跳转指令的操作数
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	c.replaceInstruction(opPos, code.Make(op, operand))
+}
+
+// 开始编译函数
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, CompilationScope{sources: map[int]code.Source{}})
+	c.scopeIndex++
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+// 结束编译函数，返回函数的指令和源码信息
+func (c *Compiler) leaveScope() (code.Instructions, map[int]code.Source) {
+	scope := c.scopes[c.scopeIndex]
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+	c.symbolTable = c.symbolTable.Outer
+	return scope.instructions, scope.sources
+}
@@ -0,0 +1,328 @@
+package compiler
+
+import (
+	"TroInterpreter/ast"
+	"TroInterpreter/code"
+	"TroInterpreter/evaluator"
+	"TroInterpreter/lexer"
+	"TroInterpreter/object"
+	"TroInterpreter/parser"
+	"fmt"
+	"testing"
+)
+
+// compiler/compiler_test.go
+
+// 第一个用户定义的全局变量的下标，前面是内置函数
+var firstGlobal = len(evaluator.BuiltinNames())
+
+type compilerTestCase struct {
+	input                string
+	expectedConstants    []interface{}
+	expectedInstructions []code.Instructions
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1 + 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             "1; -2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpMinus),
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "if (true) { 10 } else { 20 }; 3",
+			expectedConstants: []interface{}{10, 20, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpNotTruthy, 10),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpJump, 13),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let x = 1; x",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, firstGlobal),
+				code.Make(code.OpGetGlobal, firstGlobal),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			// let没有值，程序的值为nil
+			input:             "let x = 1;",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, firstGlobal),
+				code.Make(code.OpNone),
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "fn(a) { let b = a; fn() { a + b } }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetOuter, 1, 0),
+					code.Make(code.OpGetOuter, 1, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpClosure, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			// 函数体最后的调用是尾调用
+			input: "let f = fn(n) { f(n) }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetGlobal, firstGlobal),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0),
+				code.Make(code.OpSetGlobal, firstGlobal),
+				code.Make(code.OpNone),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			// 分支中定义的变量不一定有值，没有值时读取全局的同名变量
+			input: "fn(c) { if (c) { let x = 1; } x }",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpJumpNotTruthy, 16),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpNone),
+					code.Make(code.OpJump, 17),
+					code.Make(code.OpNull),
+					code.Make(code.OpPop),
+					code.Make(code.OpLookupLocal, 1),
+					code.Make(code.OpJumpNotNil, 27),
+					code.Make(code.OpGetGlobal, firstGlobal),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1),
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestTryExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "try { 1 } catch (e) { e } finally { 2 }",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTry, 11, 18, 22),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpEndTry),
+				code.Make(code.OpSetLocal, 0),
+				code.Make(code.OpGetLocal, 0),
+				code.Make(code.OpEndTry),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpEndTry),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             "try { 1 } finally { 2 }",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTry, code.NoOffset, 11, 15),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpEndTry),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpEndTry),
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestSymbolTableResolve(t *testing.T) {
+	global := NewSymbolTable()
+	a := global.Define("a")
+	if a.Scope != GlobalScope || a.Index != firstGlobal {
+		t.Fatalf("a wrong. got=%+v", a)
+	}
+
+	local := NewEnclosedSymbolTable(global)
+	local.DefineParameter("x")
+	local.Declare("b")
+
+	// 同一个函数中let之前读取b得到外层的变量，这里没有外层的b
+	if _, ok := local.Resolve("b"); ok {
+		t.Errorf("b should not resolve before it is defined")
+	}
+
+	nested := NewEnclosedSymbolTable(local)
+	// 内层函数可以引用外层提前声明的变量
+	b, ok := nested.Resolve("b")
+	if !ok || b.Scope != OuterScope || b.Depth != 1 || b.Index != 1 {
+		t.Errorf("b wrong. got=%+v", b)
+	}
+
+	local.Define("b")
+	if b, _ := local.Resolve("b"); b.Scope != LocalScope || b.Index != 1 {
+		t.Errorf("b wrong. got=%+v", b)
+	}
+
+	// catch块与所在函数共用局部变量槽
+	block := NewBlockSymbolTable(local)
+	e := block.Define("e")
+	if e.Scope != LocalScope || e.Index != 2 || local.NumLocals() != 3 {
+		t.Errorf("e wrong. got=%+v, locals=%d", e, local.NumLocals())
+	}
+	if x, _ := block.Resolve("x"); x.Scope != LocalScope || x.Index != 0 {
+		t.Errorf("x wrong. got=%+v", x)
+	}
+
+	// 找不到的变量保留为全局变量
+	c := nested.ResolveOrReserve("c")
+	if c.Scope != GlobalScope || c.Index != firstGlobal+1 {
+		t.Errorf("c wrong. got=%+v", c)
+	}
+
+	// 分支中定义的变量之后是外层的同名变量，一定有值的变量之外不再查找
+	block.DefineInBranch("a")
+	if all := block.ResolveAll("a"); len(all) != 2 || all[0].Scope != LocalScope || all[1].Scope != GlobalScope {
+		t.Errorf("a wrong. got=%+v", all)
+	}
+	if all := nested.ResolveAll("x"); len(all) != 1 || all[0].Scope != OuterScope {
+		t.Errorf("x wrong. got=%+v", all)
+	}
+}
+
+func runCompilerTests(t *testing.T, tests []compilerTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		compiler := New()
+		if err := compiler.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := compiler.Bytecode()
+
+		if err := testInstructions(tt.expectedInstructions, bytecode.Main.Instructions); err != nil {
+			t.Fatalf("%s: testInstructions failed: %s", tt.input, err)
+		}
+		if err := testConstants(tt.expectedConstants, bytecode.Constants); err != nil {
+			t.Fatalf("%s: testConstants failed: %s", tt.input, err)
+		}
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func concatInstructions(s []code.Instructions) code.Instructions {
+	out := code.Instructions{}
+	for _, ins := range s {
+		out = append(out, ins...)
+	}
+	return out
+}
+
+func testInstructions(expected []code.Instructions, actual code.Instructions) error {
+	concatted := concatInstructions(expected)
+	if concatted.String() != actual.String() {
+		return fmt.Errorf("wrong instructions.\nwant=\n%s\ngot=\n%s", concatted, actual)
+	}
+	return nil
+}
+
+func testConstants(expected []interface{}, actual []object.Object) error {
+	if len(expected) != len(actual) {
+		return fmt.Errorf("wrong number of constants. want=%d, got=%d", len(expected), len(actual))
+	}
+
+	for i, constant := range expected {
+		switch constant := constant.(type) {
+		case int:
+			integer, ok := actual[i].(*object.Integer)
+			if !ok || integer.Value != int64(constant) {
+				return fmt.Errorf("constant %d wrong. want=%d, got=%s", i, constant, actual[i].Inspect())
+			}
+		case []code.Instructions:
+			fn, ok := actual[i].(*object.CompiledFunction)
+			if !ok {
+				return fmt.Errorf("constant %d - not a function: %T", i, actual[i])
+			}
+			if err := testInstructions(constant, fn.Instructions); err != nil {
+				return fmt.Errorf("constant %d - %s", i, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package compiler
+
+import "TroInterpreter/evaluator"
+
+// 符号的作用域
+type SymbolScope string
+
+const (
+	GlobalScope SymbolScope = "GLOBAL" //全局变量，包括内置函数
+	LocalScope  SymbolScope = "LOCAL"  //当前调用的局部变量
+	OuterScope  SymbolScope = "OUTER"  //外层函数的局部变量
+)
+
+// 符号，记录变量存放的位置
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+	Depth int // OuterScope时向外的函数层数
+}
+
+type entry struct {
+	symbol  Symbol
+	defined bool // 是否已经编译到let，之前只是提前声明
+	certain bool // 之后读取时一定有值：参数，或者不在分支中定义的变量
+}
+
+// 符号表，每个函数和catch块各有一个
+// 函数中的变量在编译函数体之前提前声明，使函数体中定义的闭包可以引用后面才定义的变量
+// 同一个函数中，let之前读取同名变量得到的是外层的变量，与求值器一致
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store     map[string]*entry
+	function  *SymbolTable // 分配局部变量槽的表，函数和全局的表是自己，catch块是所在函数的表
+	numLocals int          // 局部变量槽的个数，只记录在function上
+}
+
+// NewSymbolTable 创建全局符号表，内置函数按名称顺序预先定义为前面的全局变量
+func NewSymbolTable() *SymbolTable {
+	s := &SymbolTable{store: make(map[string]*entry)}
+	s.function = s
+	for _, name := range evaluator.BuiltinNames() {
+		s.Define(name)
+	}
+	return s
+}
+
+// NewEnclosedSymbolTable 创建函数的符号表
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := &SymbolTable{Outer: outer, store: make(map[string]*entry)}
+	s.function = s
+	return s
+}
+
+// NewBlockSymbolTable 创建catch块的符号表，与所在函数共用局部变量槽
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	return &SymbolTable{Outer: outer, store: make(map[string]*entry), function: outer.function}
+}
+
+// 全局符号表
+func (s *SymbolTable) global() *SymbolTable {
+	for s.Outer != nil {
+		s = s.Outer
+	}
+	return s
+}
+
+func (s *SymbolTable) isGlobal() bool {
+	return s.Outer == nil
+}
+
+// NumLocals 返回函数(或顶层程序)使用的局部变量槽的个数
+func (s *SymbolTable) NumLocals() int {
+	return s.function.numLocals
+}
+
+// NumGlobals 返回全局变量的个数
+func (s *SymbolTable) NumGlobals() int {
+	global := s.global()
+	return len(global.store)
+}
+
+// Declare 提前声明变量，已经声明过时返回原来的符号
+func (s *SymbolTable) Declare(name string) Symbol {
+	if e, ok := s.store[name]; ok {
+		return e.symbol
+	}
+
+	symbol := Symbol{Name: name}
+	if s.isGlobal() {
+		symbol.Scope, symbol.Index = GlobalScope, len(s.store)
+	} else {
+		symbol.Scope, symbol.Index = LocalScope, s.function.numLocals
+		s.function.numLocals++
+	}
+	s.store[name] = &entry{symbol: symbol}
+	return symbol
+}
+
+// Define 定义变量，之后在同一个函数中读取时使用这个变量
+func (s *SymbolTable) Define(name string) Symbol {
+	symbol := s.Declare(name)
+	s.store[name].defined = true
+	s.store[name].certain = true
+	return symbol
+}
+
+// DefineInBranch 定义if或try的分支中的变量，运行时不一定执行到定义，读取时需要外层的同名变量作为备选
+func (s *SymbolTable) DefineInBranch(name string) Symbol {
+	symbol := s.Declare(name)
+	s.store[name].defined = true
+	return symbol
+}
+
+// DefineParameter 定义参数，每个参数占用一个槽，同名的参数后面的覆盖前面的
+func (s *SymbolTable) DefineParameter(name string) Symbol {
+	symbol := Symbol{Name: name, Scope: LocalScope, Index: s.function.numLocals}
+	s.function.numLocals++
+	s.store[name] = &entry{symbol: symbol, defined: true, certain: true}
+	return symbol
+}
+
+// Resolve 查找变量
+// 全局变量总能找到；当前函数中只能找到已经定义的变量；外层函数中提前声明的变量也能找到，因为闭包在之后才会被调用
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	depth := 0
+	for t := s; t != nil; t = t.Outer {
+		if e, ok := t.store[name]; ok && (e.defined || depth > 0 || t.isGlobal()) {
+			symbol := e.symbol
+			if symbol.Scope == LocalScope && depth > 0 {
+				symbol.Scope, symbol.Depth = OuterScope, depth
+			}
+			return symbol, true
+		}
+		if t.function == t && !t.isGlobal() {
+			depth++
+		}
+	}
+	return Symbol{}, false
+}
+
+// ResolveAll 从内到外查找所有同名的变量，第一个与Resolve的结果相同
+// 局部变量在运行时可能还没有赋值(如只在if的一个分支中定义)，这时与求值器一样读取外层的同名变量；
+// 一定有值的变量之外不再查找；否则最后是全局变量，还没有声明时与ResolveOrReserve一样保留一个位置
+func (s *SymbolTable) ResolveAll(name string) []Symbol {
+	var symbols []Symbol
+	depth := 0
+	for t := s; t != nil; t = t.Outer {
+		if e, ok := t.store[name]; ok && (e.defined || depth > 0 || t.isGlobal()) {
+			symbol := e.symbol
+			if symbol.Scope == LocalScope && depth > 0 {
+				symbol.Scope, symbol.Depth = OuterScope, depth
+			}
+			symbols = append(symbols, symbol)
+			if e.certain || symbol.Scope == GlobalScope {
+				return symbols
+			}
+		}
+		if t.function == t && !t.isGlobal() {
+			depth++
+		}
+	}
+	return append(symbols, s.global().Declare(name))
+}
+
+// ResolveOrReserve 查找变量，找不到时在全局符号表中保留一个位置
+// 运行时读取没有定义的全局变量会报错，这样函数中可以引用之后才定义的全局变量
+func (s *SymbolTable) ResolveOrReserve(name string) Symbol {
+	if symbol, ok := s.Resolve(name); ok {
+		return symbol
+	}
+	return s.global().Declare(name)
+}
@@ -0,0 +1,47 @@
+// Package evaltest 保存求值器和虚拟机共用的测试程序
+// 每个程序都有期望的结果，两种后端的测试都加载它们，分别检查自己的结果
+// 新增程序时在programs.json中添加，期望的结果与Describe的输出格式相同
+package evaltest
+
+import (
+	"TroInterpreter/object"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+)
+
+// 测试程序，Name为程序所属的测试表与序号，如 TestStructs/3
+type Program struct {
+	Name     string `json:"name"`
+	Input    string `json:"input"`
+	Expected string `json:"expected"` // 展开宏之后求值的结果，格式见Describe
+}
+
+// 运行测试程序时的步数限制，不会结束的程序在同一个位置停下
+const MaxSteps = 1000000
+
+// 运行测试程序时的内存限制
+var Limits = object.Limits{MaxAllocation: 1 << 20}
+
+//go:embed programs.json
+var programsJSON []byte
+
+// Programs 返回所有测试程序
+func Programs() ([]Program, error) {
+	var programs []Program
+	if err := json.Unmarshal(programsJSON, &programs); err != nil {
+		return nil, fmt.Errorf("programs.json: %w", err)
+	}
+	return programs, nil
+}
+
+// Describe 描述求值的结果，错误包括类型、信息、位置和调用栈
+func Describe(obj object.Object) string {
+	if obj == nil {
+		return "<nil>"
+	}
+	if err, ok := obj.(*object.Error); ok {
+		return fmt.Sprintf("%s: %s at %d:%d\n%s", err.Kind, err.Message, err.Line, err.Column, err.Traceback())
+	}
+	return fmt.Sprintf("%s %s", obj.Type(), obj.Inspect())
+}
@@ -0,0 +1,108 @@
+package evaluator
+
+import (
+	"TroInterpreter/object"
+	"math"
+	"math/big"
+)
+
+// 整数的四则运算，除数为0时报错，溢出时按mode转为大整数、报错或回绕
+func integerArithmetic(operator string, left, right int64, mode object.OverflowMode) object.Object {
+	if operator == "/" && right == 0 {
+		return newErrorOf(object.ARITHMETIC_ERROR, "除数不能为0")
+	}
+
+	result, overflow := checkedArithmetic(operator, left, right)
+	if overflow {
+		switch mode {
+		case object.OVERFLOW_PROMOTE:
+			return bigArithmetic(operator, big.NewInt(left), big.NewInt(right))
+		case object.OVERFLOW_ERROR:
+			if operator == "-" && left == 0 {
+				return newErrorOf(object.ARITHMETIC_ERROR, "整数溢出: -%d", right)
+			}
+			return newErrorOf(object.ARITHMETIC_ERROR, "整数溢出: %d %s %d", left, operator, right)
+		}
+	}
+	return &object.Integer{Value: result}
+}
+
+// 计算回绕后的结果，并判断是否溢出
+func checkedArithmetic(operator string, left, right int64) (int64, bool) {
+	switch operator {
+	case "+":
+		result := left + right
+		return result, (left > 0 && right > 0 && result < 0) || (left < 0 && right < 0 && result >= 0)
+	case "-":
+		result := left - right
+		return result, (right > 0 && result > left) || (right < 0 && result < left)
+	case "*":
+		result := left * right
+		if left == 0 || right == 0 {
+			return 0, false
+		}
+		return result, result/right != left || (left == -1 && right == math.MinInt64) || (right == -1 && left == math.MinInt64)
+	case "/":
+		//MinInt64 / -1 在Go中结果为MinInt64
+		return left / right, left == math.MinInt64 && right == -1
+	}
+	return 0, false
+}
+
+// 有大整数参与的中缀运算
+func evalBigIntegerInfixExpression(operator string, left, right *big.Int) object.Object {
+	switch operator {
+	case "+", "-", "*", "/":
+		return bigArithmetic(operator, left, right)
+	case "<":
+		return bool2BoolObject(left.Cmp(right) < 0)
+	case ">":
+		return bool2BoolObject(left.Cmp(right) > 0)
+	case "==":
+		return bool2BoolObject(left.Cmp(right) == 0)
+	case "!=":
+		return bool2BoolObject(left.Cmp(right) != 0)
+	default:
+		return newErrorOf(object.TYPE_ERROR, "错误操作符: %s %s %s", object.INTEGER_OBJ, operator, object.INTEGER_OBJ)
+	}
+}
+
+// 大整数的四则运算，除法与int64一样向0取整
+func bigArithmetic(operator string, left, right *big.Int) object.Object {
+	result := new(big.Int)
+	switch operator {
+	case "+":
+		result.Add(left, right)
+	case "-":
+		result.Sub(left, right)
+	case "*":
+		result.Mul(left, right)
+	case "/":
+		if right.Sign() == 0 {
+			return newErrorOf(object.ARITHMETIC_ERROR, "除数不能为0")
+		}
+		result.Quo(left, right)
+	}
+	return newInteger(result)
+}
+
+// 创建整数，在int64范围内时使用Integer，否则使用BigInteger
+func newInteger(n *big.Int) object.Object {
+	if n.IsInt64() {
+		return &object.Integer{Value: n.Int64()}
+	}
+	return &object.BigInteger{Value: n}
+}
+
+func isBigInteger(obj object.Object) bool {
+	_, ok := obj.(*object.BigInteger)
+	return ok
+}
+
+// 把整数转换为big.Int，返回的值不能被修改
+func toBigInt(obj object.Object) *big.Int {
+	if n, ok := obj.(*object.BigInteger); ok {
+		return n.Value
+	}
+	return big.NewInt(obj.(*object.Integer).Value)
+}
@@ -43,5 +43,26 @@ func isTruthy(obj object.Object) bool {
 
 // 生成错误
 func newError(format string, a ...interface{}) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, a...)}
+	return newErrorOf(object.RUNTIME_ERROR, format, a...)
+}
+
+// 创建指定类型的错误
+func newErrorOf(kind string, format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...), Kind: kind}
+}
+
+// 对象的类型名，结构体实例使用结构体的名称，变体使用 枚举名.变体名
+func typeName(obj object.Object) string {
+	switch obj := obj.(type) {
+	case *object.Struct:
+		return obj.Def.Name
+	case *object.Enum:
+		return obj.Name
+	case *object.Variant:
+		return obj.Def.Enum.Name + "." + obj.Def.Name
+	case *object.Module:
+		return "模块 " + obj.Name
+	default:
+		return string(obj.Type())
+	}
 }
@@ -1,31 +1,42 @@
 package evaluator
 
-import "TroInterpreter/object"
+import (
+	"TroInterpreter/object"
+	"unicode/utf8"
+)
+
+// 通道的最大容量
+const maxChannelSize = 1 << 20
 
 var builtins = map[string]*object.Builtin{
 	"len": &object.Builtin{
+		MinArgs: 1,
+		MaxArgs: 1,
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
-				return newError("参数数量错误，期望=1，实际=%d", len(args))
+				return newErrorOf(object.ARGUMENT_ERROR, "参数数量错误，期望=1，实际=%d", len(args))
 			}
 
 			switch arg := args[0].(type) {
 			case *object.Array:
 				return &object.Integer{Value: int64(len(arg.Elements))}
 			case *object.String:
-				return &object.Integer{Value: int64(len(arg.Value))}
+				//按字符计数，与字符串索引一致
+				return &object.Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
 			default:
-				return newError("参数类型错误，期望=string，实际=%s", arg.Type())
+				return newErrorOf(object.ARGUMENT_ERROR, "参数类型错误，期望=string，实际=%s", arg.Type())
 			}
 		},
 	},
 	"first": &object.Builtin{
+		MinArgs: 1,
+		MaxArgs: 1,
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
-				return newError("参数数量错误，期望=1，实际=%d", len(args))
+				return newErrorOf(object.ARGUMENT_ERROR, "参数数量错误，期望=1，实际=%d", len(args))
 			}
 			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("参数类型错误，期望=array，实际=%s", args[0].Type())
+				return newErrorOf(object.ARGUMENT_ERROR, "参数类型错误，期望=array，实际=%s", args[0].Type())
 			}
 
 			arr := args[0].(*object.Array)
@@ -37,12 +48,14 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 	"last": &object.Builtin{
+		MinArgs: 1,
+		MaxArgs: 1,
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
-				return newError("参数数量错误，期望=1，实际=%d", len(args))
+				return newErrorOf(object.ARGUMENT_ERROR, "参数数量错误，期望=1，实际=%d", len(args))
 			}
 			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("参数类型错误，期望=array，实际=%s", args[0].Type())
+				return newErrorOf(object.ARGUMENT_ERROR, "参数类型错误，期望=array，实际=%s", args[0].Type())
 			}
 
 			arr := args[0].(*object.Array)
@@ -55,12 +68,14 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 	"push": &object.Builtin{
+		MinArgs: 2,
+		MaxArgs: 2,
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 2 {
-				return newError("参数数量错误，期望=2，实际=%d", len(args))
+				return newErrorOf(object.ARGUMENT_ERROR, "参数数量错误，期望=2，实际=%d", len(args))
 			}
 			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("参数类型错误，期望=array，实际=%s", args[0].Type())
+				return newErrorOf(object.ARGUMENT_ERROR, "参数类型错误，期望=array，实际=%s", args[0].Type())
 			}
 
 			arr := args[0].(*object.Array)
@@ -73,33 +88,262 @@ var builtins = map[string]*object.Builtin{
 			return &object.Array{Elements: newElements}
 		},
 	},
+	"is": &object.Builtin{
+		MinArgs: 2,
+		MaxArgs: 2,
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newErrorOf(object.ARGUMENT_ERROR, "参数数量错误，期望=2，实际=%d", len(args))
+			}
+
+			var def *object.VariantType
+			switch variant := args[1].(type) {
+			case *object.VariantType:
+				def = variant
+			case *object.Variant:
+				def = variant.Def
+			default:
+				return newErrorOf(object.ARGUMENT_ERROR, "参数类型错误，期望=variant，实际=%s", args[1].Type())
+			}
+
+			value, ok := args[0].(*object.Variant)
+			return bool2BoolObject(ok && value.Def == def)
+		},
+	},
+	"tag": &object.Builtin{
+		MinArgs: 1,
+		MaxArgs: 1,
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newErrorOf(object.ARGUMENT_ERROR, "参数数量错误，期望=1，实际=%d", len(args))
+			}
+
+			value, ok := args[0].(*object.Variant)
+			if !ok {
+				return newErrorOf(object.ARGUMENT_ERROR, "参数类型错误，期望=variant，实际=%s", args[0].Type())
+			}
+			return &object.String{Value: value.Tag()}
+		},
+	},
+	"next": &object.Builtin{
+		MinArgs: 1,
+		MaxArgs: 2,
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newErrorOf(object.ARGUMENT_ERROR, "参数数量错误，期望=1或2，实际=%d", len(args))
+			}
+
+			generator, ok := args[0].(*object.Generator)
+			if !ok {
+				return newErrorOf(object.ARGUMENT_ERROR, "参数类型错误，期望=generator，实际=%s", args[0].Type())
+			}
+			val := generator.Next()
+			if val != nil {
+				return val
+			}
+			//生成器已经结束，有默认值时返回默认值
+			if len(args) == 2 {
+				return args[1]
+			}
+			return newErrorOf(object.STOP_ITERATION, "生成器已经结束: %s", generator.Name)
+		},
+	},
+	"channel": &object.Builtin{
+		MinArgs: 0,
+		MaxArgs: 1,
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) > 1 {
+				return newErrorOf(object.ARGUMENT_ERROR, "参数数量错误，期望<=1，实际=%d", len(args))
+			}
+
+			size := 0
+			if len(args) == 1 {
+				arg, ok := args[0].(*object.Integer)
+				if !ok {
+					return newErrorOf(object.ARGUMENT_ERROR, "参数类型错误，期望=int，实际=%s", args[0].Type())
+				}
+				if arg.Value < 0 || arg.Value > maxChannelSize {
+					return newErrorOf(object.ARGUMENT_ERROR, "通道容量错误: %d", arg.Value)
+				}
+				size = int(arg.Value)
+			}
+			return object.NewChannel(size)
+		},
+	},
+	"send": &object.Builtin{
+		MinArgs: 2,
+		MaxArgs: 2,
+		Blocking: func(runtime *object.Runtime, args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newErrorOf(object.ARGUMENT_ERROR, "参数数量错误，期望=2，实际=%d", len(args))
+			}
+
+			channel, ok := args[0].(*object.Channel)
+			if !ok {
+				return newErrorOf(object.ARGUMENT_ERROR, "参数类型错误，期望=channel，实际=%s", args[0].Type())
+			}
+			if err := channel.Send(args[1], runtime); err != nil {
+				return err
+			}
+			return NULL
+		},
+	},
+	"receive": &object.Builtin{
+		MinArgs: 1,
+		MaxArgs: 2,
+		Blocking: func(runtime *object.Runtime, args ...object.Object) object.Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newErrorOf(object.ARGUMENT_ERROR, "参数数量错误，期望=1或2，实际=%d", len(args))
+			}
+
+			channel, ok := args[0].(*object.Channel)
+			if !ok {
+				return newErrorOf(object.ARGUMENT_ERROR, "参数类型错误，期望=channel，实际=%s", args[0].Type())
+			}
+			val, err := channel.Receive(runtime)
+			if err == nil {
+				return val
+			}
+			//通道已经关闭，有默认值时返回默认值
+			if err.Kind == object.CHANNEL_CLOSED && len(args) == 2 {
+				return args[1]
+			}
+			return err
+		},
+	},
+	"select": &object.Builtin{
+		MinArgs: 1,
+		MaxArgs: 2,
+		Blocking: func(runtime *object.Runtime, args ...object.Object) object.Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newErrorOf(object.ARGUMENT_ERROR, "参数数量错误，期望=1或2，实际=%d", len(args))
+			}
+
+			arr, ok := args[0].(*object.Array)
+			if !ok {
+				return newErrorOf(object.ARGUMENT_ERROR, "参数类型错误，期望=array，实际=%s", args[0].Type())
+			}
+			var channels []*object.Channel
+			for _, e := range arr.Elements {
+				channel, ok := e.(*object.Channel)
+				if !ok {
+					return newErrorOf(object.ARGUMENT_ERROR, "参数类型错误，期望=channel，实际=%s", e.Type())
+				}
+				channels = append(channels, channel)
+			}
+
+			//有默认值时不等待，没有值可以接收或所有通道都已经关闭时返回默认值
+			idx, val, err := object.Select(channels, len(args) == 1, runtime)
+			switch {
+			case err != nil && err.Kind == object.CHANNEL_CLOSED && len(args) == 2:
+				return args[1]
+			case err != nil:
+				return err
+			case idx < 0:
+				return args[1]
+			}
+			return &object.Array{Elements: []object.Object{&object.Integer{Value: int64(idx)}, val}}
+		},
+	},
+	"close": &object.Builtin{
+		MinArgs: 1,
+		MaxArgs: 1,
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newErrorOf(object.ARGUMENT_ERROR, "参数数量错误，期望=1，实际=%d", len(args))
+			}
+
+			var err *object.Error
+			switch arg := args[0].(type) {
+			case *object.Channel:
+				err = arg.Close()
+			case *object.Generator:
+				err = arg.Close()
+			default:
+				return newErrorOf(object.ARGUMENT_ERROR, "参数类型错误，期望=channel或generator，实际=%s", arg.Type())
+			}
+			if err != nil {
+				return err
+			}
+			return NULL
+		},
+	},
+	"wait": &object.Builtin{
+		MinArgs: 1,
+		MaxArgs: 1,
+		Blocking: func(runtime *object.Runtime, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newErrorOf(object.ARGUMENT_ERROR, "参数数量错误，期望=1，实际=%d", len(args))
+			}
+
+			task, ok := args[0].(*object.Task)
+			if !ok {
+				return newErrorOf(object.ARGUMENT_ERROR, "参数类型错误，期望=task，实际=%s", args[0].Type())
+			}
+			return task.Wait(runtime)
+		},
+	},
 	"help": &object.Builtin{
+		MinArgs: 0,
+		MaxArgs: 1,
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) >= 2 {
-				return newError("参数数量错误，期望<=1，实际=%d", len(args))
+				return newErrorOf(object.ARGUMENT_ERROR, "参数数量错误，期望<=1，实际=%d", len(args))
 			}
 
 			if len(args) == 1 {
 				switch arg := args[0].Inspect(); arg {
 				case "let":
 					return &object.String{
-						Value: "let语句用于声明变量，格式为：let 标识符 = 表达式",
+						Value: "let语句用于声明变量，格式为：let 标识符 = 表达式，可以带类型注解：let 标识符: 类型 = 表达式",
 					}
 				case "return":
 					return &object.String{
 						Value: "return语句用于返回值，格式为：return 表达式",
 					}
+				case "enum":
+					return &object.String{
+						Value: "enum语句用于声明枚举，格式为：enum 名称 { 变体, 变体(字段, ...) }，通过 名称.变体(值, ...) 创建变体，is(值, 名称.变体) 判断是哪个变体，tag(值) 获取变体名",
+					}
+				case "struct":
+					return &object.String{
+						Value: "struct语句用于声明结构体，格式为：struct 名称 { 字段, ... }，通过 名称(值, ...) 创建实例，实例.字段 读取或修改字段",
+					}
+				case "import":
+					return &object.String{
+						Value: "import语句用于导入模块，格式为：import \"路径.tro\" as 名称，路径相对于当前文件或TRO_PATH中的目录，通过 名称.导出项 访问",
+					}
+				case "export":
+					return &object.String{
+						Value: "export用于导出模块中的绑定，格式为：export let、export struct或export enum",
+					}
+				case "try":
+					return &object.String{
+						Value: "try表达式用于捕获错误，格式为：try { ... } catch (e) { ... } finally { ... }，e.message为错误信息，e.type为错误类型，e.value为throw抛出的值，catch与finally可以省略其一",
+					}
+				case "throw":
+					return &object.String{
+						Value: "throw语句用于抛出错误，格式为：throw 表达式，字符串作为错误信息，结构体和变体以类型名作为错误类型",
+					}
+				case "gen":
+					return &object.String{
+						Value: "gen用于声明生成器函数，格式为：gen fn(参数) { yield 表达式; ... }，调用时返回生成器，next(生成器) 执行到下一个yield并返回交出的值，结束后返回next的第二个参数，没有时抛出StopIteration",
+					}
+				case "spawn":
+					return &object.String{
+						Value: "spawn用于在新的任务中调用函数，格式为：spawn 函数(参数)，返回任务，wait(任务) 等待并返回函数的结果；channel(容量) 创建通道，send(通道, 值) 发送，receive(通道) 接收，close(通道) 关闭，select([通道, ...]) 从先到达的通道接收并返回[下标, 值]",
+					}
 				default:
-					return newError("参数错误，期望=let或return，实际=%s", arg)
+					return newErrorOf(object.ARGUMENT_ERROR, "参数错误，期望=let、return、struct、enum、import、export、try、throw、gen或spawn，实际=%s", arg)
 				}
 			}
 
 			return &object.String{
 				Value: "tro使用手册:\n" +
 					"本语言分为语句和标识符两大类\n" +
-					"语句现在有let与return\n" +
-					"表达式有基本类型整型、字符串、函数、布尔值，if与前缀运算符、中缀运算符\n" +
-					`help参数可以使用："let","return"，以获取更多信息`,
+					"语句现在有let、return、struct、enum、import、export与throw\n" +
+					"表达式有基本类型整型、字符串、函数、布尔值，if、try、yield、spawn与前缀运算符、中缀运算符\n" +
+					`help参数可以使用："let","return","struct","enum","import","export","try","throw","gen","spawn"，以获取更多信息`,
 			}
 		},
 	},
@@ -0,0 +1,34 @@
+package evaluator
+
+import (
+	"TroInterpreter/ast"
+	"TroInterpreter/object"
+	"context"
+	"time"
+)
+
+// Budget 限制一次求值可以使用的资源，字段为0时不限制
+type Budget struct {
+	Steps    int64     // 最多执行的步数，每次函数调用(包括尾调用的每次循环)算一步
+	Deadline time.Time // 截止时间
+}
+
+// EvalContext 在上下文中求值，上下文被取消、超过截止时间或用完步数时中断求值
+// 中断时返回Kind为CancelledError、TimeoutError或StepLimitError的错误，这些错误不能被catch捕获
+// 求值中spawn的任务在返回前被取消，返回时它们都已经结束
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment, budget Budget) object.Object {
+	if !budget.Deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, budget.Deadline)
+		defer cancel()
+	}
+
+	restore := env.Runtime().Limit(ctx, budget.Steps)
+	defer restore()
+
+	//开始前就已经结束的上下文
+	if err := env.Runtime().Check(); err != nil {
+		return err
+	}
+	return Eval(node, env)
+}
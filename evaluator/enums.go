@@ -0,0 +1,56 @@
+package evaluator
+
+import (
+	"TroInterpreter/ast"
+	"TroInterpreter/object"
+)
+
+// 求值enum声明，把枚举绑定到名称上
+func evalEnumStatement(node *ast.EnumStatement, env *object.Environment) object.Object {
+	enum := newEnum(node)
+	if isError(enum) {
+		return enum
+	}
+
+	setVariable(node.Name, enum, env)
+	return nil
+}
+
+// 根据enum声明创建枚举，每次执行声明都会创建新的枚举
+func newEnum(node *ast.EnumStatement) object.Object {
+	enum := &object.Enum{Name: node.Name.Value}
+
+	for _, v := range node.Variants {
+		if _, ok := enum.Variant(v.Name.Value); ok {
+			return newError("变体重复: %s.%s", enum.Name, v.Name.Value)
+		}
+
+		variant := &object.VariantType{Enum: enum, Name: v.Name.Value}
+		if v.Fields != nil {
+			variant.Fields = []string{}
+			for _, field := range v.Fields {
+				if variant.FieldIndex(field.Value) >= 0 {
+					return newError("字段重复: %s.%s.%s", enum.Name, variant.Name, field.Value)
+				}
+				variant.Fields = append(variant.Fields, field.Value)
+			}
+		} else {
+			//没有字段的变体只有一个值
+			variant.Unit = &object.Variant{Def: variant}
+		}
+
+		enum.Variants = append(enum.Variants, variant)
+	}
+	return enum
+}
+
+// 创建变体值，参数按字段声明顺序传入
+func newVariant(def *object.VariantType, args []object.Object) object.Object {
+	if len(args) != len(def.Fields) {
+		return newErrorOf(object.ARGUMENT_ERROR, "参数数量错误，期望=%d，实际=%d", len(def.Fields), len(args))
+	}
+
+	values := make([]object.Object, len(args))
+	copy(values, args)
+	return &object.Variant{Def: def, Values: values}
+}
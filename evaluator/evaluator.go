@@ -3,10 +3,37 @@ package evaluator
 import (
 	"TroInterpreter/ast"
 	"TroInterpreter/object"
+	"math/big"
 )
 
-// Eval 求值
+// Eval 求值，出错时记录出错的位置和调用栈
+// 求值只读取node，不会修改它，同一个程序可以在多个goroutine中用各自的解释器(object.NewEnvironment)同时求值；
+// 包级别的内置函数、方法表和TRUE、FALSE、NULL在初始化之后不再修改，可以被所有解释器共享
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	result := eval(node, env)
+
+	if err, ok := result.(*object.Error); ok {
+		//在最内层的节点上记录调用栈
+		if err.Line == 0 && err.Stack == nil {
+			err.Stack = env.Frame()
+		}
+		//同一个函数调用中，位置由最内层有位置的节点决定
+		if err.Line == 0 && err.Stack == env.Frame() {
+			err.Line, err.Column = ast.Position(node)
+			//调用出错时指向被调用的函数，而不是括号
+			switch node := node.(type) {
+			case *ast.CallExpression:
+				err.Line, err.Column = ast.Position(node.Function)
+			case *ast.SpawnExpression:
+				err.Line, err.Column = ast.Position(node.Call.Function)
+			}
+		}
+	}
+
+	return result
+}
+
+func eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	//分析程序
 	case *ast.Program:
@@ -22,6 +49,9 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 
 		//分析整数
 	case *ast.IntegerLiteral:
+		if node.Big != nil {
+			return &object.BigInteger{Value: node.Big}
+		}
 		return &object.Integer{Value: node.Value}
 
 		//分析字符串
@@ -34,7 +64,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
-		return &object.Array{Elements: elements}
+		return allocate(&object.Array{Elements: elements}, env.Runtime())
 
 		// 分析索引
 	case *ast.IndexExpression:
@@ -46,7 +76,11 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(index) {
 			return index
 		}
-		return evalIndexExpression(left, index)
+		return evalIndexExpression(left, index, env.Runtime())
+
+		//分析属性
+	case *ast.PropertyExpression:
+		return evalPropertyExpression(node, env)
 
 		//分析布尔值
 	case *ast.Boolean:
@@ -58,7 +92,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		return allocate(evalPrefixExpression(node.Operator, right, env.Runtime()), env.Runtime())
 
 		//分析中缀表达式
 	case *ast.InfixExpression:
@@ -70,12 +104,16 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(right) {
 			return right
 		}
-		return evalInfixExpression(node.Operator, left, right)
+		return allocate(evalInfixExpression(node.Operator, left, right, env.Runtime()), env.Runtime())
 
 		//分析if
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
 
+		//分析try
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
+
 		//分析block
 	case *ast.BlockStatement:
 		return evalBlockStatements(node, env)
@@ -88,30 +126,66 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		return &object.ReturnValue{Value: val}
 
+		//分析throw
+	case *ast.ThrowStatement:
+		return evalThrowStatement(node, env)
+
 		//分析let
 	case *ast.LetStatement:
 		val := Eval(node.Value, env)
 		if isError(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		setVariable(node.Name, val, env)
+
+		//分析struct
+	case *ast.StructStatement:
+		return evalStructStatement(node, env)
+
+		//分析enum
+	case *ast.EnumStatement:
+		return evalEnumStatement(node, env)
+
+		//分析import
+	case *ast.ImportStatement:
+		return evalImportStatement(node, env)
+
+		//分析export，导出的名称在加载模块时收集
+	case *ast.ExportStatement:
+		return Eval(node.Statement, env)
+
+		//分析赋值
+	case *ast.AssignExpression:
+		return evalAssignExpression(node, env)
 
 		//分析函数
 	case *ast.FunctionExpression:
-		fe := &object.Function{Parameters: node.Parameters, Body: node.Body, Env: env}
+		fe := &object.Function{Parameters: node.Parameters, Body: node.Body, ReturnType: node.ReturnType, Generator: node.Generator, Env: env, Scope: node.Scope}
 		return fe
 
+		//分析yield
+	case *ast.YieldExpression:
+		return evalYieldExpression(node, env)
+
+		//分析spawn
+	case *ast.SpawnExpression:
+		return evalSpawnExpression(node, env)
+
 		//求值调用函数
 	case *ast.CallExpression:
-		function := Eval(node.Function, env)
+		//quote的参数不求值
+		if node.Function.TokenLiteral() == "quote" {
+			if len(node.Arguments) != 1 {
+				return newErrorOf(object.ARGUMENT_ERROR, "参数数量错误，期望=1，实际=%d", len(node.Arguments))
+			}
+			return quote(node.Arguments[0], env)
+		}
+
+		function, args := evalCallee(node, env)
 		if isError(function) {
 			return function
 		}
-		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
-			return args[0]
-		}
-		return applyFunction(function, args)
+		return applyFunction(function, args, newFrame(node, env), env)
 
 	}
 
@@ -154,14 +228,14 @@ func evalBlockStatements(block *ast.BlockStatement, env *object.Environment) obj
 }
 
 // 求值前缀表达式
-func evalPrefixExpression(operator string, right object.Object) object.Object {
+func evalPrefixExpression(operator string, right object.Object, runtime *object.Runtime) object.Object {
 	switch operator {
 	case "!":
 		return evalBangOperatorExpression(right)
 	case "-":
-		return evalMinusPrefixOperatorExpression(right)
+		return evalMinusPrefixOperatorExpression(right, runtime.Overflow)
 	default:
-		return newError("错误操作符: %s%s", operator, right.Type())
+		return newErrorOf(object.TYPE_ERROR, "错误操作符: %s%s", operator, right.Type())
 	}
 }
 
@@ -181,27 +255,39 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 }
 
 // 负数
-func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
+func evalMinusPrefixOperatorExpression(right object.Object, mode object.OverflowMode) object.Object {
 	//先检查操作数是不是整数，不是就返回NULL
 	if right.Type() != object.INTEGER_OBJ {
-		return newError("错误操作符: -%s", right.Type())
+		return newErrorOf(object.TYPE_ERROR, "错误操作符: -%s", right.Type())
 	}
 
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
+	if n, ok := right.(*object.BigInteger); ok {
+		return bigArithmetic("-", new(big.Int), n.Value)
+	}
+	return integerArithmetic("-", 0, right.(*object.Integer).Value, mode)
 }
 
 // 求值中缀表达式
-func evalInfixExpression(operator string, left, right object.Object) object.Object {
+func evalInfixExpression(operator string, left, right object.Object, runtime *object.Runtime) object.Object {
 	//如果都是整数，就用evalIntegerInfixExpression求值
 	if left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ {
-		return evalIntegerInfixExpression(operator, left, right)
+		return evalIntegerInfixExpression(operator, left, right, runtime.Overflow)
 	}
 
 	if left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ {
 		return evalStringInfixExpression(operator, left, right)
 	}
 
+	//结构体和变体按字段比较
+	if left.Type() == right.Type() && (left.Type() == object.STRUCT_OBJ || left.Type() == object.VARIANT_OBJ) {
+		switch operator {
+		case "==":
+			return bool2BoolObject(objectsEqual(left, right))
+		case "!=":
+			return bool2BoolObject(!objectsEqual(left, right))
+		}
+	}
+
 	if operator == "==" {
 		//通过都是一个对象，来进行比较，实现true 与 false比较
 		return bool2BoolObject(left == right)
@@ -211,27 +297,25 @@ func evalInfixExpression(operator string, left, right object.Object) object.Obje
 
 	if left.Type() != right.Type() {
 		//如果两个操作数类型不同，就报错
-		return newError("类型不匹配: %s %s %s", left.Type(), operator, right.Type())
+		return newErrorOf(object.TYPE_ERROR, "类型不匹配: %s %s %s", left.Type(), operator, right.Type())
 	}
 
 	//都不是就报错
-	return newError("错误操作符: %s %s %s", left.Type(), operator, right.Type())
+	return newErrorOf(object.TYPE_ERROR, "错误操作符: %s %s %s", left.Type(), operator, right.Type())
 }
 
 // 整数中缀运算
-func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
+func evalIntegerInfixExpression(operator string, left, right object.Object, mode object.OverflowMode) object.Object {
+	if isBigInteger(left) || isBigInteger(right) {
+		return evalBigIntegerInfixExpression(operator, toBigInt(left), toBigInt(right))
+	}
+
 	leftVal := left.(*object.Integer).Value
 	rightVal := right.(*object.Integer).Value
 
 	switch operator {
-	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
-	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
-	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
-	case "/":
-		return &object.Integer{Value: leftVal / rightVal}
+	case "+", "-", "*", "/":
+		return integerArithmetic(operator, leftVal, rightVal, mode)
 	case "<":
 		return bool2BoolObject(leftVal < rightVal)
 	case ">":
@@ -241,7 +325,7 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 	case "!=":
 		return bool2BoolObject(leftVal != rightVal)
 	default:
-		return newError("错误操作符: %s %s %s", left.Type(), operator, right.Type())
+		return newErrorOf(object.TYPE_ERROR, "错误操作符: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
@@ -261,7 +345,7 @@ func evalStringInfixExpression(operator string, left, right object.Object) objec
 		rightVal := right.(*object.String).Value
 		return &object.String{Value: leftVal + rightVal}
 	}
-	return newError("错误操作符: %s %s %s", left.Type(), operator, right.Type())
+	return newErrorOf(object.TYPE_ERROR, "错误操作符: %s %s %s", left.Type(), operator, right.Type())
 }
 
 // 求值if语句
@@ -283,14 +367,14 @@ func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Obje
 // 分析标识符
 func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
 	//分析是不是标识符
-	if val, ok := env.Get(node.Value); ok {
+	if val, ok := lookupVariable(node, env); ok {
 		return val
 	}
 	//分析是不是内置函数
 	if builtin, ok := builtins[node.Value]; ok {
 		return builtin
 	}
-	return newError("标识符未定义: " + node.Value)
+	return newErrorOf(object.NAME_ERROR, "标识符未定义: "+node.Value)
 }
 
 // 分析表达式
@@ -307,36 +391,178 @@ func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Ob
 	return result
 }
 
-// 分析索引数组
-func evalIndexExpression(array, index object.Object) object.Object {
-	arrayObject := array.(*object.Array)
-	idx := index.(*object.Integer).Value
-	max := int64(len(arrayObject.Elements) - 1)
+// 求值索引表达式，支持数组和字符串，负数索引从末尾开始计数，越界时返回NULL
+// 字符串索引创建新的字符串，记录占用的内存
+func evalIndexExpression(left, index object.Object, runtime *object.Runtime) object.Object {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalArrayIndexExpression(left.(*object.Array), index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return allocate(evalStringIndexExpression(left.(*object.String), index), runtime)
+	case left.Type() == object.ARRAY_OBJ || left.Type() == object.STRING_OBJ:
+		return newErrorOf(object.TYPE_ERROR, "索引类型错误，期望=INTEGER，实际=%s", index.Type())
+	default:
+		return newErrorOf(object.TYPE_ERROR, "不支持索引: %s", left.Type())
+	}
+}
+
+// 数组索引
+func evalArrayIndexExpression(array *object.Array, index object.Object) object.Object {
+	idx, ok := normalizeIndex(index, len(array.Elements))
+	if !ok {
+		return NULL
+	}
+	return array.Elements[idx]
+}
 
-	if idx < 0 || idx > max {
+// 字符串索引，按字符计数，返回只有一个字符的字符串
+func evalStringIndexExpression(str *object.String, index object.Object) object.Object {
+	chars := []rune(str.Value)
+	idx, ok := normalizeIndex(index, len(chars))
+	if !ok {
 		return NULL
 	}
-	return arrayObject.Elements[idx]
+	return &object.String{Value: string(chars[idx])}
+}
+
+// 把索引转换为[0, length)中的下标，负数从末尾开始计数，越界时返回false
+func normalizeIndex(index object.Object, length int) (int, bool) {
+	integer, ok := index.(*object.Integer)
+	if !ok {
+		//大整数一定越界
+		return 0, false
+	}
+
+	idx := integer.Value
+	if idx < 0 {
+		idx += int64(length)
+	}
+	if idx < 0 || idx >= int64(length) {
+		return 0, false
+	}
+	return int(idx), true
+}
+
+// 求值调用表达式要调用的函数和实际传入的参数，出错时函数为错误
+func evalCallee(node *ast.CallExpression, env *object.Environment) (object.Object, []object.Object) {
+	//方法调用
+	if property, ok := node.Function.(*ast.PropertyExpression); ok {
+		return evalMethodCallee(node, property, env)
+	}
+
+	function := Eval(node.Function, env)
+	if isError(function) {
+		return function, nil
+	}
+	args := evalExpressions(node.Arguments, env)
+	if len(args) == 1 && isError(args[0]) {
+		return args[0], nil
+	}
+	return function, args
+}
+
+// 创建调用帧
+func newFrame(call *ast.CallExpression, env *object.Environment) *object.Frame {
+	frame := &object.Frame{Function: "<匿名函数>", Caller: env.Frame()}
+	switch function := call.Function.(type) {
+	case *ast.Identifier:
+		frame.Function = function.Value
+	case *ast.PropertyExpression:
+		frame.Function = function.String()
+	}
+	frame.Line, frame.Column = ast.Position(call.Function)
+	frame.Depth = 1
+	if frame.Caller != nil {
+		frame.Depth = frame.Caller.Depth + 1
+	}
+	return frame
 }
 
 // 求值函数
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// 函数体中尾部位置的调用返回TailCall，在这里循环执行，不会增加Go的调用栈
+// env为调用处的环境
+func applyFunction(fn object.Object, args []object.Object, frame *object.Frame, env *object.Environment) object.Object {
+	var returnTypes []*ast.TypeName //尾调用替换掉的函数的返回类型，最终的返回值也要符合
+	for {
+		function, ok := fn.(*object.Function)
+		if !ok {
+			return checkResults(returnTypes, applyNonFunction(fn, args, frame, env))
+		}
+		runtime := function.Env.Runtime()
+		//每次调用(包括尾调用的每次循环)检查上下文和步数限制
+		if err := runtime.Step(); err != nil {
+			return err
+		}
+		if err := runtime.CheckDepth(frame); err != nil {
+			return err
+		}
+
+		if err := CheckArguments(function.Parameters, args); err != nil {
+			//与内置函数的参数错误一样报告在调用处，尾调用时也是如此
+			err.Line, err.Column, err.Stack = frame.Line, frame.Column, frame.Caller
+			return err
+		}
+
+		extendEnv := extendFunctionEnv(function, args, frame)
+		if function.Generator {
+			//生成器函数的返回类型注解检查的是生成器本身
+			return checkResults(AddReturnType(returnTypes, function.ReturnType), newGenerator(function, extendEnv, frame))
+		}
+		evaluated := unwrapReturnValue(evalFunctionBody(function.Body, extendEnv))
+		if function.ReturnType != nil {
+			returnTypes = AddReturnType(returnTypes, function.ReturnType)
+		}
+		tailCall, ok := evaluated.(*object.TailCall)
+		if !ok {
+			return checkResults(returnTypes, evaluated)
+		}
+		fn, args, frame = tailCall.Function, tailCall.Args, tailCall.Frame
+	}
+}
+
+// 检查返回值是否符合各个返回类型，出错时返回原来的错误
+func checkResults(returnTypes []*ast.TypeName, result object.Object) object.Object {
+	if len(returnTypes) == 0 || isError(result) {
+		return result
+	}
+	for _, t := range returnTypes {
+		if err := CheckResult(t, result); err != nil {
+			return err
+		}
+	}
+	return result
+}
+
+// 调用内置函数、结构体和变体的构造函数，记录创建的对象占用的内存
+func applyNonFunction(fn object.Object, args []object.Object, frame *object.Frame, env *object.Environment) object.Object {
+	result := allocate(applyCallable(fn, args, env.Runtime()), env.Runtime())
+	//尾调用出错时没有经过调用处的Eval，在这里记录位置
+	if err, ok := result.(*object.Error); ok && err.Line == 0 && err.Stack == nil {
+		err.Line, err.Column, err.Stack = frame.Line, frame.Column, frame.Caller
+	}
+	return result
+}
+
+func applyCallable(fn object.Object, args []object.Object, runtime *object.Runtime) object.Object {
 	switch fn := fn.(type) {
-	case *object.Function:
-		extendEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendEnv)
-		return unwrapReturnValue(evaluated)
 	case *object.Builtin:
+		if fn.Blocking != nil {
+			return fn.Blocking(runtime, args...)
+		}
 		return fn.Fn(args...)
+	case *object.StructType:
+		return newStruct(fn, args)
+	case *object.VariantType:
+		return newVariant(fn, args)
 	}
-	return newError("不是函数: %s", fn.Type())
+	return newErrorOf(object.TYPE_ERROR, "不是函数: %s", fn.Type())
 }
 
 // 扩展函数环境
-func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
-	env := object.NewEnclosedEnvironment(fn.Env)
+func extendFunctionEnv(fn *object.Function, args []object.Object, frame *object.Frame) *object.Environment {
+	env := object.NewCallEnvironment(fn.Env, frame, fn.Scope)
 	for paramIdx, param := range fn.Parameters {
-		env.Set(param.Value, args[paramIdx])
+		setVariable(param, args[paramIdx], env)
 	}
 	return env
 }
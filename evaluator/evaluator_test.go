@@ -1,10 +1,21 @@
 package evaluator
 
 import (
+	"TroInterpreter/ast"
+	"TroInterpreter/evaltest"
 	"TroInterpreter/lexer"
 	"TroInterpreter/object"
 	"TroInterpreter/parser"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 // evaluator/evaluator_test.go
@@ -44,6 +55,14 @@ func TestArrayIndexExpressions(t *testing.T) {
 		},
 		{
 			"[1,2,3][-1]",
+			3,
+		},
+		{
+			"[1,2,3][-3]",
+			1,
+		},
+		{
+			"[1,2,3][-4]",
 			nil,
 		},
 	}
@@ -59,6 +78,45 @@ func TestArrayIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestStringIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"abc"[0]`, "a"},
+		{`"abc"[2]`, "c"},
+		{`"abc"[-1]`, "c"},
+		{`"你好"[1]`, "好"},
+		{`let s = "你好"; s[len(s) - 1]`, "好"},
+		{`"abc"[3]`, nil},
+		{`"abc"[-4]`, nil},
+		{`""[0]`, nil},
+		{`[1, 2]["x"]`, errorMessage("索引类型错误，期望=INTEGER，实际=STRING")},
+		{`"abc"[true]`, errorMessage("索引类型错误，期望=INTEGER，实际=BOOLEAN")},
+		{`999[1]`, errorMessage("不支持索引: INTEGER")},
+		{`try { 999[1] } catch (e) { e.type }`, "TypeError"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. want=%q, got=%q", expected, str.Value)
+			}
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
 func TestArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 	evaluated := testEval(input)
@@ -125,6 +183,323 @@ func TestBuiltinFunctions(t *testing.T) {
 	}
 }
 
+func TestMethodCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`[1, 2, 3].len()`, 3},
+		{`[1, 2, 3].first()`, 1},
+		{`[1, 2, 3].last()`, 3},
+		{`[1, 2].push(3).last()`, 3},
+		{`[1, 2, 3].rest().first()`, 2},
+		{`[1, 2, 3].join(", ")`, "1, 2, 3"},
+		{`"hello".len()`, 5},
+		{`"Hello".upper()`, "HELLO"},
+		{`"Hello".lower()`, "hello"},
+		{`"  hi  ".trim()`, "hi"},
+		{`"a,b".split(",").last()`, "b"},
+		{`let double = fn(x) { x * 2 }; 5.double()`, 10},
+		{`let add = fn(a, b) { a + b }; 1.add(2)`, 3},
+		{`let xs = [1]; xs.push(2).len()`, 2},
+		{`[1].nope()`, errorMessage("ARRAY 没有方法 nope")},
+		{`[1].len`, errorMessage("ARRAY 没有属性 len")},
+		{`"a".split(1)`, errorMessage("参数类型错误，期望=string，实际=INTEGER")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. want=%q, got=%q", expected, str.Value)
+			}
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestStructs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`struct Point { x, y } let p = Point(1, 2); p.x + p.y`, 3},
+		{`struct Point { x, y } let p = Point(1, 2); p.x = 10; p.x`, 10},
+		{`struct Point { x, y } let p = Point(1, 2); p.y = p.x = 5; p.y`, 5},
+		{`struct Point { x, y } Point(1, 2) == Point(1, 2)`, true},
+		{`struct Point { x, y } Point(1, 2) == Point(1, 3)`, false},
+		{`struct Point { x, y } Point(1, 2) != Point(1, 3)`, true},
+		{`struct Point { x, y } Point("a", [1]) == Point("a", [1])`, true},
+		{`struct A { x } struct B { x } A(1) == B(1)`, false},
+		{`struct Box { f } let b = Box(fn(x) { x * 3 }); b.f(2)`, 6},
+		{`struct Point { x, y } let norm = fn(p) { p.x * p.x + p.y * p.y }; Point(3, 4).norm()`, 25},
+		{`struct Point { x, y } Point(1)`, errorMessage("参数数量错误，期望=2，实际=1")},
+		{`struct Point { x, y } Point(1, 2).z`, errorMessage("Point 没有属性 z")},
+		{`struct Point { x, y } let p = Point(1, 2); p.z = 1`, errorMessage("Point 没有字段 z")},
+		{`let a = [1]; a.x = 1`, errorMessage("不能给 ARRAY 的属性赋值")},
+		{`struct P { x, x }`, errorMessage("字段重复: P.x")},
+		//字段指向自己的结构体
+		{`struct N { x, y } let a = N(0, 1); let b = N(0, 1); a.x = a; b.x = b; a == b`, true},
+		{`struct N { x, y } let a = N(0, 1); let b = N(0, 2); a.x = a; b.x = b; a == b`, false},
+		{`struct N { x, y } let a = N(0, 1); let b = N(0, 1); a.x = [b]; b.x = [a]; a != b`, false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestStructInspect(t *testing.T) {
+	evaluated := testEval(`struct Point { x, y } Point(1, "a")`)
+	if evaluated.Inspect() != "Point{x: 1, y: a}" {
+		t.Errorf("wrong Inspect. got=%q", evaluated.Inspect())
+	}
+
+	//循环显示为 名称{...}，多次出现但不循环的结构体照常显示
+	evaluated = testEval(`struct N { x, y } enum E { V(n) } let a = N(0, 1); a.x = [a, E.V(a)]; [a, N(a, a)]`)
+	expected := "[N{x: [N{...}, E.V(N{...})], y: 1}, N{x: N{x: [N{...}, E.V(N{...})], y: 1}, y: N{x: [N{...}, E.V(N{...})], y: 1}}]"
+	if evaluated.Inspect() != expected {
+		t.Errorf("wrong Inspect. got=%q", evaluated.Inspect())
+	}
+}
+
+func TestEnums(t *testing.T) {
+	shape := `enum Shape { Circle(r), Rect(w, h), Empty } `
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{shape + `Shape.Circle(2).r`, 2},
+		{shape + `let s = Shape.Rect(2, 3); s.w * s.h`, 6},
+		{shape + `is(Shape.Circle(1), Shape.Circle)`, true},
+		{shape + `is(Shape.Circle(1), Shape.Rect)`, false},
+		{shape + `is(Shape.Empty, Shape.Empty)`, true},
+		{shape + `is(1, Shape.Empty)`, false},
+		{shape + `Shape.Circle(1).is(Shape.Circle)`, true},
+		{shape + `tag(Shape.Rect(1, 2))`, "Rect"},
+		{shape + `Shape.Empty.tag()`, "Empty"},
+		{shape + `Shape.Rect(1, 2) == Shape.Rect(1, 2)`, true},
+		{shape + `Shape.Rect(1, 2) == Shape.Rect(2, 1)`, false},
+		{shape + `Shape.Empty == Shape.Empty`, true},
+		{shape + `Shape.Circle(1) != Shape.Empty`, true},
+		{`enum Result { Ok(value), Err(error) }
+		  let unwrap = fn(r) { if (is(r, Result.Ok)) { r.value } else { 0 } };
+		  unwrap(Result.Ok(5)) + unwrap(Result.Err("bad"))`, 5},
+		{shape + `Shape.Circle(1, 2)`, errorMessage("参数数量错误，期望=1，实际=2")},
+		{shape + `Shape.Square`, errorMessage("Shape 没有属性 Square")},
+		{shape + `Shape.Circle(1).w`, errorMessage("Shape.Circle 没有属性 w")},
+		{shape + `is(1, 2)`, errorMessage("参数类型错误，期望=variant，实际=INTEGER")},
+		{`enum E { A, A }`, errorMessage("变体重复: E.A")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. want=%q, got=%q", expected, str.Value)
+			}
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestEnumInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`enum Shape { Circle(r), Empty } Shape`, "enum Shape { Circle(r), Empty }"},
+		{`enum Shape { Circle(r), Empty } Shape.Circle`, "Shape.Circle(r)"},
+		{`enum Shape { Circle(r), Empty } Shape.Circle(2)`, "Shape.Circle(2)"},
+		{`enum Shape { Circle(r), Empty } Shape.Empty`, "Shape.Empty"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect. want=%q, got=%q", tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestModules(t *testing.T) {
+	dir := t.TempDir()
+	libDir := t.TempDir()
+	files := map[string]string{
+		filepath.Join(dir, "math.tro"): `
+let secret = 40;
+export let add = fn(a, b) { a + b };
+export let answer = add(secret, 2);
+export struct Point { x, y }`,
+		filepath.Join(dir, "sub", "uses.tro"): `
+import "../math.tro" as m;
+export let total = m.add(m.answer, 1);`,
+		filepath.Join(dir, "a.tro"):       `import "b.tro"; export let x = 1;`,
+		filepath.Join(dir, "b.tro"):       `import "a.tro"; export let y = 2;`,
+		filepath.Join(libDir, "util.tro"): `export let double = fn(x) { x * 2 };`,
+		filepath.Join(dir, "slow.tro"): `
+let count = fn(n) { if (n == 0) { "ready" } else { count(n - 1) } };
+export let v = count(100000);`,
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`import "math.tro" as m; m.answer`, 42},
+		{`import "math.tro"; math.add(1, 2)`, 3},
+		{`import "math.tro" as m; m.Point(1, 2).y`, 2},
+		{`import "sub/uses.tro" as u; u.total`, 43},
+		{`import "util.tro" as u; u.double(21)`, 42},
+		{`import "math.tro" as m; m.secret`, "模块 math 没有属性 secret"},
+		{`import "missing.tro"`, "找不到模块: missing.tro"},
+		{`import "a.tro"`, "循环导入: " + filepath.Join(dir, "a.tro") + " -> " +
+			filepath.Join(dir, "b.tro") + " -> " + filepath.Join(dir, "a.tro")},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		env.SetFile(filepath.Join(dir, "main.tro"))
+		env.Runtime().SearchPath = []string{libDir}
+		evaluated := Eval(testParseProgram(tt.input), env)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+
+	//同一个运行时中模块只求值一次
+	env := object.NewEnvironment()
+	env.SetFile(filepath.Join(dir, "main.tro"))
+	Eval(testParseProgram(`import "math.tro" as a; import "sub/uses.tro" as u; import "math.tro" as b;`), env)
+	a, _ := env.Get("a")
+	b, _ := env.Get("b")
+	if a != b {
+		t.Errorf("module evaluated twice. a=%p, b=%p", a, b)
+	}
+	if _, ok := env.Runtime().Module(filepath.Join(dir, "math.tro")); !ok {
+		t.Errorf("module not cached in runtime")
+	}
+
+	//同时导入同一个模块的任务等待第一个任务加载完成，导入链属于各自的任务
+	input := `let f = fn() { import "slow.tro" as s; s.v };
+	let g = fn() { import "a.tro"; 1 };
+	let h = fn() { import "b.tro"; 1 };
+	let result = fn(t) { try { wait(t) } catch (e) { e.type } };
+	let ta = spawn f(); let tb = spawn f(); let tc = spawn g(); let td = spawn h();
+	[result(ta), result(tb), result(tc), result(td)]`
+	env = object.NewEnvironment()
+	env.SetFile(filepath.Join(dir, "main.tro"))
+	if got := Eval(testParseProgram(input), env).Inspect(); got != "[ready, ready, ImportError, ImportError]" {
+		t.Errorf("concurrent imports: got=%s", got)
+	}
+}
+
+func TestTryCatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`try { 1 } catch (e) { 2 }`, 1},
+		{`try { throw "boom"; 1 } catch (e) { e.message }`, "boom"},
+		{`try { throw "boom" } catch (e) { e.type }`, "Error"},
+		{`try { 1 + "a" } catch (e) { e.message }`, "类型不匹配: INTEGER + STRING"},
+		{`try { 1 + "a" } catch (e) { e.type }`, "TypeError"},
+		{`try { missing } catch (e) { e.type }`, "NameError"},
+		{`try { len(1, 2) } catch (e) { e.type }`, "ArgumentError"},
+		{`struct Oops { code } try { throw Oops(7) } catch (e) { e.value.code }`, 7},
+		{`struct Oops { code } try { throw Oops(7) } catch (e) { e.type }`, "Oops"},
+		{`try { try { throw "inner" } catch (e) { throw e } } catch (e) { e.message }`, "inner"},
+		{`let f = fn() { try { return 1; } finally { 2 } }; f()`, 1},
+		{`let f = fn() { try { 1 } finally { return 2; } }; f()`, 2},
+		{`let x = 0; let r = try { throw 1 } catch (e) { e.value + 1 } finally { 10 }; r`, 2},
+		{`try { throw "a" } catch (e) { e }.message`, "a"},
+		{`try { throw "a" } catch (e) { throw "b" }`, errorMessage("b")},
+		{`try { throw "a" } finally { 1 }`, errorMessage("a")},
+		{`try { 1 } finally { 1 + true }`, errorMessage("类型不匹配: INTEGER + BOOLEAN")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. want=%q, got=%q", expected, str.Value)
+			}
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestUncaughtThrowLocation(t *testing.T) {
+	input := `let f = fn() {
+  throw "boom";
+};
+f();`
+
+	errObj, ok := testEval(input).(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned")
+	}
+	if errObj.Line != 2 || errObj.Column != 3 {
+		t.Errorf("wrong error position. want=2:3, got=%d:%d", errObj.Line, errObj.Column)
+	}
+	if errObj.Stack == nil || errObj.Stack.Function != "f" {
+		t.Errorf("wrong stack. got=%+v", errObj.Stack)
+	}
+}
+
 func TestStringLiteral(t *testing.T) {
 	input := `"Hello World!"`
 
@@ -150,10 +525,35 @@ func TestFunctionApplication(t *testing.T) {
 		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
 		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
 		{"fn(x) { x; }(5)", 5},
+		{"fn(x) { x; }(5, 6)", 5},
 	}
 
 	for _, tt := range tests {
 		testIntegerObject(t, testEval(tt.input), tt.expected)
+		testIntegerObject(t, testEvalResolved(tt.input), tt.expected)
+	}
+}
+
+func TestFunctionArity(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(a, b) { a }(1)", "参数数量错误，期望=2，实际=1"},
+		{"let f = fn(a, b) { a }; let g = fn() { f() }; g()", "参数数量错误，期望=2，实际=0"},
+		{"let f = fn(n, acc) { if (n == 0) { acc } else { f(n - 1) } }; f(3, 0)", "参数数量错误，期望=2，实际=1"},
+		{"let g = gen fn(a) { yield a }; g()", "参数数量错误，期望=1，实际=0"},
+		{"let f = fn(a) { a }; wait(spawn f())", "参数数量错误，期望=1，实际=0"},
+		{"[1, 2].len(1)", "参数数量错误，期望=1，实际=2"},
+	}
+
+	for _, tt := range tests {
+		testErrorKind(t, testEval(tt.input), object.ARGUMENT_ERROR, tt.expected)
+	}
+
+	evaluated := testEval(`try { fn(a, b) { a }(1) } catch (e) { e.type }`)
+	if evaluated.Inspect() != object.ARGUMENT_ERROR {
+		t.Errorf("arity error not catchable. got=%s", evaluated.Inspect())
 	}
 }
 
@@ -194,6 +594,7 @@ func TestLetStatements(t *testing.T) {
 
 	for _, tt := range tests {
 		testIntegerObject(t, testEval(tt.input), tt.expected)
+		testIntegerObject(t, testEvalResolved(tt.input), tt.expected)
 	}
 }
 
@@ -277,6 +678,260 @@ if (10 > 1) {
 	}
 }
 
+func TestErrorLocation(t *testing.T) {
+	//调用不在尾部位置，调用栈保留每一层
+	input := `let inner = fn(x) {
+  x + "a"
+};
+let outer = fn() {
+  inner(1) + 1
+};
+outer();`
+
+	evaluated := testEval(input)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+
+	if errObj.Line != 2 || errObj.Column != 5 {
+		t.Errorf("wrong error position. want=2:5, got=%d:%d", errObj.Line, errObj.Column)
+	}
+
+	expectedStack := []struct {
+		function     string
+		line, column int
+	}{
+		{"inner", 5, 3},
+		{"outer", 7, 1},
+	}
+
+	frame := errObj.Stack
+	for i, expected := range expectedStack {
+		if frame == nil {
+			t.Fatalf("stack[%d] missing, want %q", i, expected.function)
+		}
+		if frame.Function != expected.function || frame.Line != expected.line || frame.Column != expected.column {
+			t.Errorf("stack[%d] wrong. want=%s at %d:%d, got=%s at %d:%d", i,
+				expected.function, expected.line, expected.column,
+				frame.Function, frame.Line, frame.Column)
+		}
+		frame = frame.Caller
+	}
+	if frame != nil {
+		t.Errorf("stack has extra frames. got=%+v", frame)
+	}
+
+	expectedTraceback := "ERROR: 类型不匹配: INTEGER + STRING\n" +
+		"\t位置: 第2行第5列\n" +
+		"\t调用栈(最近的调用在最后):\n" +
+		"\t\t第7行第1列 调用 outer\n" +
+		"\t\t第5行第3列 调用 inner"
+	if errObj.Traceback() != expectedTraceback {
+		t.Errorf("wrong traceback.\nwant=%q\ngot= %q", expectedTraceback, errObj.Traceback())
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let loop = fn(n, acc) { if (n == 0) { acc } else { loop(n - 1, acc + 1) } }; loop(1000000, 0)", 1000000},
+		{"let loop = fn(n) { if (n == 0) { return 0; } return loop(n - 1); }; loop(100000)", 0},
+		{"let loop = fn(n) { if (n > 0) { return loop(n - 1); } 7 }; loop(100000)", 7},
+		{`let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } };
+let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } };
+if (even(100000)) { 1 } else { 0 }`, 1},
+		{"let count = fn(n) { if (n == 0) { len([]) } else { count(n - 1) } }; count(100000)", 0},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	//尾调用替换当前调用帧
+	input := `let inner = fn(x) {
+  x + "a"
+};
+let outer = fn() {
+  inner(1)
+};
+let main = fn() {
+  let r = outer();
+  r
+};
+main();`
+	errObj, ok := testEval(input).(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned")
+	}
+	var functions []string
+	for frame := errObj.Stack; frame != nil; frame = frame.Caller {
+		functions = append(functions, frame.Function)
+	}
+	if len(functions) != 2 || functions[0] != "inner" || functions[1] != "main" {
+		t.Errorf("wrong stack. want=[inner main], got=%v", functions)
+	}
+
+	errObj, ok = testEval("let f = fn() { 1(2) }; f()").(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned")
+	}
+	if errObj.Message != "不是函数: INTEGER" || errObj.Line != 1 || errObj.Column != 16 {
+		t.Errorf("wrong error. got=%q at %d:%d", errObj.Message, errObj.Line, errObj.Column)
+	}
+}
+
+func TestRecursionDepthLimit(t *testing.T) {
+	evaluated := testEval("let f = fn(x) { f(x) + 1 }; f(1)")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	expected := fmt.Sprintf("超出最大递归深度 %d: f", object.DEFAULT_MAX_DEPTH)
+	if errObj.Message != expected || errObj.Kind != object.RECURSION_ERROR {
+		t.Errorf("wrong error. want=%q, got=%q (%s)", expected, errObj.Message, errObj.Kind)
+	}
+
+	lines := strings.Split(errObj.Traceback(), "\n")
+	if len(lines) != 2+1+10+1+10 || strings.TrimSpace(lines[13]) != fmt.Sprintf("... 省略%d层 ...", object.DEFAULT_MAX_DEPTH-20) {
+		t.Errorf("traceback not truncated. got %d lines:\n%s", len(lines), strings.Join(lines[:15], "\n"))
+	}
+
+	env := object.NewEnvironment()
+	env.Runtime().MaxDepth = 50
+	input := `
+let depth = fn(n) { if (n == 0) { 0 } else { 1 + depth(n - 1) } };
+let ok = depth(49);
+let caught = try { depth(50) } catch (e) { e.type };
+[ok, caught]`
+	evaluated = Eval(testParseProgram(input), env)
+	if evaluated.Inspect() != "[49, RecursionError]" {
+		t.Errorf("wrong result. got=%s", evaluated.Inspect())
+	}
+
+	//尾调用不增加调用深度
+	evaluated = Eval(testParseProgram("let loop = fn(n) { if (n == 0) { 0 } else { loop(n - 1) } }; loop(1000)"), env)
+	testIntegerObject(t, evaluated, 0)
+
+	//无限的尾递归受连续尾调用次数限制
+	expected = fmt.Sprintf("超出最大递归深度 %d: f", object.DEFAULT_MAX_TAIL_CALLS)
+	testErrorKind(t, testEval("let f = fn(x) { f(x) }; f(1)"), object.RECURSION_ERROR, expected)
+
+	env.Runtime().MaxTailCalls = 100
+	input = `
+let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } };
+let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } };
+let caught = try { even(101) } catch (e) { e.message };
+[even(100), caught, even(10) == even(10)]`
+	evaluated = Eval(testParseProgram(input), env)
+	if evaluated.Inspect() != "[true, 超出最大递归深度 100: odd, true]" {
+		t.Errorf("wrong result. got=%s", evaluated.Inspect())
+	}
+}
+
+func TestEvalContext(t *testing.T) {
+	loop := "let loop = fn(n) { loop(n + 1) }; "
+
+	env := object.NewEnvironment()
+	evaluated := EvalContext(context.Background(), testParseProgram(loop+"loop(0)"), env, Budget{Steps: 1000})
+	testErrorKind(t, evaluated, object.STEP_LIMIT_ERROR, "超出执行步数限制 1000")
+
+	//不能被catch捕获
+	input := loop + `try { loop(0) } catch (e) { "caught" }`
+	evaluated = EvalContext(context.Background(), testParseProgram(input), env, Budget{Steps: 1000})
+	testErrorKind(t, evaluated, object.STEP_LIMIT_ERROR, "超出执行步数限制 1000")
+
+	//结束后恢复为不限制
+	evaluated = Eval(testParseProgram("let count = fn(n) { if (n == 0) { 0 } else { count(n - 1) } }; count(2000)"), env)
+	testIntegerObject(t, evaluated, 0)
+
+	start := time.Now()
+	deadline := Budget{Deadline: time.Now().Add(50 * time.Millisecond)}
+	evaluated = EvalContext(context.Background(), testParseProgram(loop+"loop(0)"), env, deadline)
+	testErrorKind(t, evaluated, object.TIMEOUT_ERROR, "执行超时")
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("deadline not respected. took %s", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	evaluated = EvalContext(ctx, testParseProgram(loop+"loop(0)"), env, Budget{})
+	testErrorKind(t, evaluated, object.CANCELLED_ERROR, "执行被取消")
+
+	evaluated = EvalContext(ctx, testParseProgram("1 + 1"), env, Budget{})
+	testErrorKind(t, evaluated, object.CANCELLED_ERROR, "执行被取消")
+
+	evaluated = EvalContext(context.Background(), testParseProgram("let f = fn(x) { x * 2 }; f(21)"), env, Budget{Steps: 10})
+	testIntegerObject(t, evaluated, 42)
+
+	//返回前取消spawn的任务并等待它们结束
+	for _, budget := range []Budget{{}, {Steps: 1000000}, {Deadline: time.Now().Add(time.Minute)}} {
+		evaluated = EvalContext(context.Background(), testParseProgram(loop+"spawn loop(0)"), env, budget)
+		task, ok := evaluated.(*object.Task)
+		if !ok {
+			t.Fatalf("object is not Task. got=%T (%+v)", evaluated, evaluated)
+		}
+		if !task.Done() {
+			t.Fatalf("task still running after EvalContext returned")
+		}
+		testErrorKind(t, task.Wait(env.Runtime()), object.CANCELLED_ERROR, "执行被取消")
+	}
+}
+
+func TestMemoryLimits(t *testing.T) {
+	tests := []struct {
+		limits   object.Limits
+		input    string
+		expected string
+	}{
+		{object.Limits{MaxArrayLength: 3}, "[1, 2, 3, 4]", "数组长度超出限制: 4 > 3"},
+		{object.Limits{MaxArrayLength: 3}, "push([1, 2, 3], 4)", "数组长度超出限制: 4 > 3"},
+		{object.Limits{MaxArrayLength: 3}, "[1, 2, 3].push(4)", "数组长度超出限制: 4 > 3"},
+		{object.Limits{MaxArrayLength: 3}, `"a,b,c,d".split(",")`, "数组长度超出限制: 4 > 3"},
+		{object.Limits{MaxArrayLength: 3}, "let f = fn(xs) { push(xs, 0) }; f([1, 2, 3])", "数组长度超出限制: 4 > 3"},
+		{object.Limits{MaxStringLength: 5}, `"abc" + "def"`, "字符串长度超出限制: 6 > 5"},
+		{object.Limits{MaxStringLength: 5}, `["abc", "def"].join("")`, "字符串长度超出限制: 6 > 5"},
+		{object.Limits{MaxStringLength: 100}, `let grow = fn(s) { grow(s + s) }; grow("ab")`, "字符串长度超出限制: 128 > 100"},
+		{object.Limits{MaxAllocation: 100}, "let grow = fn(xs) { grow(push(xs, 1)) }; grow([])", "分配的内存超出限制 100"},
+		{object.Limits{MaxAllocation: 64}, "let f = fn(n) { f(n * n) }; f(99999999999)", "分配的内存超出限制 64"},
+		{object.Limits{MaxAllocation: 100}, `let s = "abc"; let f = fn(n) { s[n - n - 1]; f(n + 1) }; f(0)`, "分配的内存超出限制 100"},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		env.Runtime().Limits = tt.limits
+		evaluated := Eval(testParseProgram(tt.input), env)
+		testErrorKind(t, evaluated, object.MEMORY_ERROR, tt.expected)
+	}
+
+	env := object.NewEnvironment()
+	env.Runtime().Limits = object.Limits{MaxArrayLength: 3, MaxStringLength: 20}
+	evaluated := Eval(testParseProgram(`let r = try { [1, 2, 3, 4] } catch (e) { e.type }; r + "!"`), env)
+	if evaluated.Inspect() != "MemoryError!" {
+		t.Errorf("MemoryError not catchable. got=%s", evaluated.Inspect())
+	}
+	if env.Runtime().Allocated() == 0 {
+		t.Errorf("allocation not recorded")
+	}
+}
+
+func testErrorKind(t *testing.T, obj object.Object, kind, message string) {
+	t.Helper()
+	errObj, ok := obj.(*object.Error)
+	if !ok {
+		t.Errorf("object is not Error. got=%T (%+v)", obj, obj)
+		return
+	}
+	if errObj.Kind != kind || errObj.Message != message {
+		t.Errorf("wrong error. want=%s %q, got=%s %q", kind, message, errObj.Kind, errObj.Message)
+	}
+}
+
 func TestReturnStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -318,11 +973,647 @@ func TestIfElseExpressions(t *testing.T) {
 	}
 }
 
-func testNullObject(t *testing.T, obj object.Object) bool {
-	if obj != NULL {
-		t.Errorf("object is not NULL. got=%T (%+v)", obj, obj)
-		return false
-	}
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(5)`, `5`},
+		{`quote(5 + 8)`, `(5 + 8)`},
+		{`quote(foobar)`, `foobar`},
+		{`quote(foobar + barfoo)`, `(foobar + barfoo)`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		quote, ok := evaluated.(*object.Quote)
+		if !ok {
+			t.Fatalf("expected *object.Quote. got=%T (%+v)", evaluated, evaluated)
+		}
+
+		if quote.Node == nil {
+			t.Fatalf("quote.Node is nil")
+		}
+
+		if quote.Node.String() != tt.expected {
+			t.Errorf("not equal. got=%q, want=%q", quote.Node.String(), tt.expected)
+		}
+	}
+}
+
+func TestQuoteUnquote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(unquote(4))`, `4`},
+		{`quote(unquote(4 + 4))`, `8`},
+		{`quote(8 + unquote(4 + 4))`, `(8 + 8)`},
+		{`quote(unquote(4 + 4) + 8)`, `(8 + 8)`},
+		{`let foobar = 8; quote(foobar)`, `foobar`},
+		{`let foobar = 8; quote(unquote(foobar))`, `8`},
+		{`quote(unquote(true))`, `true`},
+		{`quote(unquote(true == false))`, `false`},
+		{`quote(unquote(quote(4 + 4)))`, `(4 + 4)`},
+		{`let quotedInfixExpression = quote(4 + 4);
+		quote(unquote(4 + 4) + unquote(quotedInfixExpression))`, `(8 + (4 + 4))`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		quote, ok := evaluated.(*object.Quote)
+		if !ok {
+			t.Fatalf("expected *object.Quote. got=%T (%+v)", evaluated, evaluated)
+		}
+
+		if quote.Node == nil {
+			t.Fatalf("quote.Node is nil")
+		}
+
+		if quote.Node.String() != tt.expected {
+			t.Errorf("not equal. got=%q, want=%q", quote.Node.String(), tt.expected)
+		}
+	}
+}
+
+func TestQuoteUnquoteErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(unquote(fn(x) { x }))`, "unquote的值不能转换为代码: FUNCTION"},
+		{`quote(unquote(nope))`, "标识符未定义: nope"},
+		{`quote(1 + unquote([1, 2]))`, "unquote的值不能转换为代码: ARRAY"},
+		{`quote(unquote(1 / 0) + unquote(nope))`, "除数不能为0"},
+	}
+
+	for _, tt := range tests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+
+	evaluated := testEval(`try { quote(unquote(fn(x) { x })) } catch (e) { e.type }`)
+	if evaluated.Inspect() != object.TYPE_ERROR {
+		t.Errorf("unquote error not catchable. got=%s", evaluated.Inspect())
+	}
+}
+
+func TestDefineMacros(t *testing.T) {
+	input := `
+	let number = 1;
+	let function = fn(x, y) { x + y };
+	let mymacro = macro(x, y) { x + y; };
+	`
+
+	env := object.NewEnvironment()
+	program := testParseProgram(input)
+
+	DefineMacros(program, env)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("Wrong number of statements. got=%d", len(program.Statements))
+	}
+
+	_, ok := env.Get("number")
+	if ok {
+		t.Fatalf("number should not be defined")
+	}
+	_, ok = env.Get("function")
+	if ok {
+		t.Fatalf("function should not be defined")
+	}
+
+	obj, ok := env.Get("mymacro")
+	if !ok {
+		t.Fatalf("macro not in environment.")
+	}
+
+	macro, ok := obj.(*object.Macro)
+	if !ok {
+		t.Fatalf("object is not Macro. got=%T (%+v)", obj, obj)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("Wrong number of macro parameters. got=%d", len(macro.Parameters))
+	}
+
+	if macro.Parameters[0].String() != "x" {
+		t.Fatalf("parameter is not 'x'. got=%q", macro.Parameters[0])
+	}
+	if macro.Parameters[1].String() != "y" {
+		t.Fatalf("parameter is not 'y'. got=%q", macro.Parameters[1])
+	}
+
+	expectedBody := "(x + y)"
+
+	if macro.Body.String() != expectedBody {
+		t.Fatalf("body is not %q. got=%q", expectedBody, macro.Body.String())
+	}
+}
+
+func TestExpandMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`
+			let infixExpression = macro() { quote(1 + 2); };
+
+			infixExpression();
+			`,
+			`(1 + 2)`,
+		},
+		{
+			`
+			let reverse = macro(a, b) { quote(unquote(b) - unquote(a)); };
+
+			reverse(2 + 2, 10 - 5);
+			`,
+			`(10 - 5) - (2 + 2)`,
+		},
+		{
+			`
+			let unless = macro(condition, consequence, alternative) {
+				quote(if (!(unquote(condition))) {
+					unquote(consequence);
+				} else {
+					unquote(alternative);
+				});
+			};
+
+			unless(10 > 5, puts("not greater"), puts("greater"));
+			`,
+			`if (!(10 > 5)) { puts("not greater") } else { puts("greater") }`,
+		},
+	}
+
+	for _, tt := range tests {
+		expected := testParseProgram(tt.expected)
+		program := testParseProgram(tt.input)
+
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		expanded, err := ExpandMacros(program, env)
+		if err != nil {
+			t.Fatalf("ExpandMacros returned error: %s", err)
+		}
+
+		if expanded.String() != expected.String() {
+			t.Errorf("not equal. want=%q, got=%q", expected.String(), expanded.String())
+		}
+	}
+}
+
+func TestExpandMacrosErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{
+			`let m = macro() { 1 }; m();`,
+			"宏只能返回quote引用的代码，实际=INTEGER",
+		},
+		{
+			`let m = macro(a) { quote(unquote(a)) }; m(1, 2);`,
+			"宏参数数量错误，期望=1，实际=2",
+		},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(tt.input)
+
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		_, err := ExpandMacros(program, env)
+		if err == nil {
+			t.Errorf("expected error %q, got none", tt.expectedMessage)
+			continue
+		}
+
+		if err.Error() != tt.expectedMessage {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expectedMessage, err.Error())
+		}
+	}
+}
+
+// 期望的错误信息
+type errorMessage string
+
+func testErrorObject(t *testing.T, obj object.Object, expected string) bool {
+	errObj, ok := obj.(*object.Error)
+	if !ok {
+		t.Errorf("object is not Error. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if errObj.Message != expected {
+		t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+		return false
+	}
+	return true
+}
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`60 * 60 * 24`, `86400`},
+		{`"a" + "b" == "ab"`, `true`},
+		{`!(1 < 2)`, `false`},
+		{`let x = 2 * 3; x + 1`, `let x = 6;(x + 1)`},
+		{`9223372036854775807 + 1`, `(9223372036854775807 + 1)`},
+		{`10 / 0`, `(10 / 0)`},
+		{`1 + "a"`, `(1 + a)`},
+		{`if (true) { 1 } else { 2 }`, `1`},
+		{`if (1 > 2) { 1 } else { let a = 2; a }`, `let a = 2;a`},
+		{`let x = if (false) { 1 } else { let a = 2; a }`, `let x = iftrue let a = 2;a;`},
+		{`if (false) { 1 }; 2`, `2`},
+		{`if (false) { 1 }`, `iffalse `},
+		{`let f = fn() { return 1; 2 }`, `let f = func() return 1;;`},
+		{`let f = fn() { if (true) { return 1; } 2 }`, `let f = func() return 1;;`},
+		{`quote(1 + 2)`, `quote((1 + 2))`},
+	}
+
+	for _, tt := range tests {
+		optimized := Optimize(testParseProgram(tt.input))
+		if optimized.String() != tt.expected {
+			t.Errorf("%q: wrong program. want=%q, got=%q", tt.input, tt.expected, optimized.String())
+		}
+	}
+
+	//优化前后的求值结果相同，包括错误的位置
+	inputs := []string{
+		`60 * 60 * 24`,
+		`9223372036854775807 + 1`,
+		"let f = fn() {\n  1 + 2 + true\n};\nf()",
+		`let x = if (false) { 1 } else { let a = 2; a * 3 }; x`,
+		`if (true) { let x = 5; }; x`,
+		`1; if (false) { 2 }`,
+		`let f = fn(n) { if (true) { if (n == 0) { return 0; } f(n - 1) } }; f(20000)`,
+		`try { 1 / 0 } catch (e) { e.message }`,
+		`let x = 3; quote(unquote(x) + 1)`,
+	}
+	for _, input := range inputs {
+		want := testEval(input)
+		got := Eval(Optimize(testParseProgram(input)), object.NewEnvironment())
+		if want.Inspect() != got.Inspect() {
+			t.Errorf("%q: wrong result. want=%s, got=%s", input, want.Inspect(), got.Inspect())
+		}
+		if wantErr, ok := want.(*object.Error); ok {
+			gotErr, _ := got.(*object.Error)
+			if gotErr == nil || gotErr.Line != wantErr.Line || gotErr.Column != wantErr.Column {
+				t.Errorf("%q: wrong error position. want=%d:%d, got=%+v", input, wantErr.Line, wantErr.Column, gotErr)
+			}
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	program := Resolve(testParseProgram(`let g = 1; let f = fn(a) { let b = a; fn() { a + b + g } }; try { 1 } catch (e) { e }`))
+
+	f := program.Statements[1].(*ast.LetStatement).Value.(*ast.FunctionExpression)
+	if f.Scope == nil || strings.Join(f.Scope.Names, ",") != "a,b" {
+		t.Fatalf("wrong scope. got=%+v", f.Scope)
+	}
+	inner := f.Body.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.FunctionExpression)
+	sum := inner.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.InfixExpression)
+	left := sum.Left.(*ast.InfixExpression)
+
+	tests := []struct {
+		ident      *ast.Identifier
+		resolution ast.Resolution
+		depth      int
+		slot       int
+	}{
+		{program.Statements[0].(*ast.LetStatement).Name, ast.Global, 0, 0},
+		{f.Parameters[0], ast.Local, 0, 0},
+		{f.Body.Statements[0].(*ast.LetStatement).Name, ast.Local, 0, 1},
+		{left.Left.(*ast.Identifier), ast.Local, 1, 0},
+		{left.Right.(*ast.Identifier), ast.Local, 1, 1},
+		{sum.Right.(*ast.Identifier), ast.Global, 2, 0},
+	}
+	for _, tt := range tests {
+		if tt.ident.Resolution != tt.resolution || tt.ident.Depth != tt.depth || tt.ident.Slot != tt.slot {
+			t.Errorf("%s resolved wrong. want=%d %d:%d, got=%d %d:%d", tt.ident.Value,
+				tt.resolution, tt.depth, tt.slot, tt.ident.Resolution, tt.ident.Depth, tt.ident.Slot)
+		}
+	}
+
+	try := program.Statements[2].(*ast.ExpressionStatement).Expression.(*ast.TryExpression)
+	if try.CatchScope == nil || try.Param.Resolution != ast.Local {
+		t.Errorf("catch not resolved. got=%+v", try.CatchScope)
+	}
+
+	//解析前后的结果相同，槽还没有赋值时按名称向外查找
+	inputs := []struct {
+		input    string
+		expected string
+	}{
+		{`let f = fn() { let y = x; let x = 2; [y, x] }; let x = 1; f()`, "[1, 2]"},
+		{`let f = fn(c) { if (c) { let x = 2; } x }; let x = 1; [f(true), f(false)]`, "[2, 1]"},
+		{`let f = fn() { let g = fn() { x }; let a = g(); let x = 5; [a, g()] }; let x = 1; f()`, "[1, 5]"},
+		{`let f = fn(a, a) { a }; f(1, 2)`, "2"},
+		{`let x = 1; try { throw 2 } catch (e) { let x = e.value; x }; x`, "1"},
+		{`let f = fn() { try { throw 2 } catch (e) { fn() { e.value + 1 } } }; f()()`, "3"},
+		{`let f = fn() { struct P { x } [P(1).x, P] }; f()[0]`, "1"},
+		{`let f = fn() { let len = fn(x) { 99 }; [len("a"), [1, 2].len()] }; f()`, "[99, 2]"},
+		{`let y = 4; let f = fn() { let v = 3; quote(unquote(v) + unquote(y)) }; f()`, "QUOTE((3 + 4))"},
+	}
+	for _, tt := range inputs {
+		if got := testEvalResolved(tt.input).Inspect(); got != tt.expected {
+			t.Errorf("%q: wrong result. want=%s, got=%s", tt.input, tt.expected, got)
+		}
+		if got := testEval(tt.input).Inspect(); got != tt.expected {
+			t.Errorf("%q: wrong unresolved result. want=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestTypeAnnotations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let n: int = 1; let f = fn(a: int, b: string) -> string { b }; f(n, "x")`, "x"},
+		{`let f = fn(a: any, b) -> any { [a, b] }; f("a", 1)`, "[a, 1]"},
+		{`let f = fn(a: int) { a }; f("x")`, "ERROR: 参数 a 类型错误，期望=int，实际=string"},
+		{`let f = fn() -> int { return "s"; }; f()`, "ERROR: 返回值类型错误，期望=int，实际=string"},
+		{`let f = fn() -> bool { try { return 1; } catch (e) { false } }; try { f() } catch (e) { e.type }`, "TypeError"},
+		{`let f = fn(x: fn) { 1 }; [f(len), f(fn(a) { a })]`, "[1, 1]"},
+		{`let f = fn(x: fn) { 1 }; f(1)`, "ERROR: 参数 x 类型错误，期望=fn，实际=int"},
+		{`struct Point { x, y } let f = fn(p: Point) -> int { p.x }; f(Point(3, 4))`, "3"},
+		{`enum Shape { Circle(r), Empty } let f = fn(s: Shape) -> Shape { s }; [f(Shape.Empty), f(Shape.Circle(1))]`, "[Shape.Empty, Shape.Circle(1)]"},
+		{`let f = fn(n: int, acc: int) -> int { if (n == 0) { return acc; } f(n - 1, acc + n) }; f(100000, 0)`, "5000050000"},
+		//尾调用替换掉的函数的返回类型也要检查
+		{`let g = fn() { "s" }; let f = fn() -> int { g() }; f()`, "ERROR: 返回值类型错误，期望=int，实际=string"},
+		{`let f = fn() -> string { len("abc") }; f()`, "ERROR: 返回值类型错误，期望=string，实际=int"},
+		{`let f = fn(a: int) -> int { a }; f(99999999999999999999)`, "99999999999999999999"},
+	}
+
+	for _, tt := range tests {
+		if got := testEval(tt.input).Inspect(); got != tt.expected {
+			t.Errorf("%q: wrong result. want=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+
+	//类型错误报告在调用处
+	errObj, ok := testEval("let f = fn(a: int) { a };\nlet g = fn() { f(\"x\") };\ng();").(*object.Error)
+	if !ok {
+		t.Fatalf("expected error")
+	}
+	if errObj.Kind != object.TYPE_ERROR || errObj.Line != 2 || errObj.Column != 16 {
+		t.Errorf("wrong error. got=%s %d:%d", errObj.Kind, errObj.Line, errObj.Column)
+	}
+}
+
+func TestGenerators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let g = gen fn() { yield 1; yield 2; }(); [next(g), g.next(), next(g, "end"), next(g, "end")]`, "[1, 2, end, end]"},
+		{`let g = gen fn() { yield 1; }(); next(g); next(g)`, "ERROR: 生成器已经结束: <匿名函数>"},
+		{`let f = gen fn() { yield 1; }; let g = f(); try { next(g); next(g) } catch (e) { e.type }`, "StopIteration"},
+		//在嵌套的块、try和递归调用中挂起
+		{`let f = gen fn(n) {
+			let loop = fn(i) { if (i < n) { try { yield i * i; } finally { 0 } loop(i + 1) } };
+			if (true) { loop(0); }
+			yield "done";
+		};
+		let g = f(3);
+		[next(g), next(g), next(g), next(g), next(g, "end")]`, "[0, 1, 4, done, end]"},
+		//无限的序列
+		{`let nat = gen fn() { let loop = fn(n) { yield n; loop(n + 1) }; loop(0) };
+		let take = fn(g, n, acc) { if (n == 0) { acc } else { take(g, n - 1, push(acc, next(g))) } };
+		take(nat(), 5, [])`, "[0, 1, 2, 3, 4]"},
+		//函数体在第一次next时才开始执行
+		{`struct Box { n } let b = Box(0); let f = gen fn() { b.n = 1; yield b.n; }; let g = f(); [b.n, next(g), b.n]`, "[0, 1, 1]"},
+		{`let f = gen fn() { yield 1; throw "boom"; }; let g = f(); next(g); try { next(g) } catch (e) { e.message }`, "boom"},
+		{`let f = gen fn() { let x = yield 1; yield x; }; let g = f(); [next(g), next(g)]`, "[1, null]"},
+		{`struct Box { log } let b = Box([]); let f = gen fn() { try { yield 1; yield 2; } finally { b.log = push(b.log, "finally") } };
+		let g = f(); [next(g), g.close(), b.log, next(g, "end")]`, "[1, null, [finally], end]"},
+		{`let f = gen fn() { next(g) }; let g = f(); next(g)`, "ERROR: 生成器正在运行: f"},
+		{`let f = gen fn() { yield 1; }; let h = fn() { f }; [f, f()]`, "[gen fn() {\nyield 1\n}, generator f]"},
+		{`let f = gen fn(a: int) -> generator { yield a; }; next(f(1))`, "1"},
+		{`let f = gen fn() -> int { yield 1; }; f()`, "ERROR: 返回值类型错误，期望=int，实际=generator"},
+		{`next(1)`, "ERROR: 参数类型错误，期望=generator，实际=INTEGER"},
+	}
+
+	for _, tt := range tests {
+		if got := testEval(tt.input).Inspect(); got != tt.expected {
+			t.Errorf("%q: wrong result. want=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+
+	//不在生成器中的yield
+	program := &ast.Program{Statements: []ast.Statement{&ast.ExpressionStatement{
+		Expression: &ast.YieldExpression{Value: &ast.IntegerLiteral{Value: 1}},
+	}}}
+	if got := Eval(program, object.NewEnvironment()).Inspect(); got != "ERROR: yield不在生成器中" {
+		t.Errorf("wrong result for yield outside generator. got=%s", got)
+	}
+
+	//结束时函数体中的panic转换为错误，回收没有结束的生成器时也是如此
+	g := object.NewGenerator("g", func(yield func(object.Object) bool) object.Object {
+		yield(&object.Integer{Value: 1})
+		panic("boom")
+	})
+	g.Next()
+	if err := g.Close(); err == nil || err.Message != "生成器异常: boom" {
+		t.Errorf("panic not converted on close. got=%v", err)
+	}
+	for i := 0; i < 10; i++ {
+		g := object.NewGenerator("g", func(yield func(object.Object) bool) object.Object {
+			yield(&object.Integer{Value: 1})
+			panic("boom")
+		})
+		g.Next()
+	}
+	for i := 0; i < 3; i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSpawnAndChannels(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let sq = fn(x) { x * x }; let t = spawn sq(7); [t, wait(t), t.wait()]`, "[task sq, 49, 49]"},
+		//生产者与消费者，关闭后receive返回默认值
+		{`let ch = channel();
+		let produce = fn(n) { if (n > 0) { send(ch, n); produce(n - 1) } else { close(ch) } };
+		let sum = fn(acc) { let v = receive(ch, -1); if (v < 0) { acc } else { sum(acc + v) } };
+		let t = spawn produce(100);
+		[sum(0), wait(t)]`, "[5050, null]"},
+		//关闭后仍然可以接收缓冲中的值
+		{`let ch = channel(2); ch.send(1); ch.send(2); ch.close(); [ch.receive(), ch.receive(), ch.receive("end")]`, "[1, 2, end]"},
+		{`let ch = channel(1); close(ch); try { send(ch, 1) } catch (e) { [e.type, e.message] }`, "[ChannelClosed, 通道已经关闭]"},
+		{`let ch = channel(); close(ch); receive(ch)`, "ERROR: 通道已经关闭"},
+		{`let ch = channel(); close(ch); close(ch)`, "ERROR: 通道已经关闭"},
+		{`let a = channel(1); let b = channel(1); send(b, "b"); select([a, b])`, "[1, b]"},
+		{`let a = channel(); select([a], "none")`, "none"},
+		{`let a = channel(); close(a); [select([a], "none"), try { select([a]) } catch (e) { e.type }]`, "[none, ChannelClosed]"},
+		//任务中的错误在wait时抛出
+		{`let f = fn() { throw "boom" }; let t = spawn f(); try { wait(t) } catch (e) { e.message }`, "boom"},
+		{`let f = fn(a: int) { a }; wait(spawn f("x"))`, "ERROR: 参数 a 类型错误，期望=int，实际=string"},
+		//任务与创建者共享变量和结构体
+		{`struct Box { n } let b = Box(0); let set = fn(v) { b.n = v }; wait(spawn set(5)); b.n`, "5"},
+		{`let ch = channel(); let f = fn(c) { send(c, "pong") }; spawn f(ch); [1, 2].len() + len(receive(ch))`, "6"},
+		{`let ch = channel(); spawn ch.send(1); ch.receive()`, "1"},
+		//多个任务同时读写同一个结构体和外层的变量
+		{`struct Box { n } let b = Box(0); let ch = channel(); let worker = fn(i) { b.n = b.n + i; send(ch, b.n) };
+		let start = fn(i) { if (i > 0) { spawn worker(i); start(i - 1) } };
+		start(20);
+		let collect = fn(i, acc) { if (i == 0) { acc } else { receive(ch); collect(i - 1, acc + 1) } };
+		collect(20, 0)`, "20"},
+		//任务中的yield不会交给创建任务的生成器
+		{`let g = gen fn() { let f = fn() { yield 1 }; yield wait(spawn f()); }; try { next(g()) } catch (e) { e.message }`, "yield不在生成器中"},
+		{`channel(-1)`, "ERROR: 通道容量错误: -1"},
+		{`wait(1)`, "ERROR: 参数类型错误，期望=task，实际=INTEGER"},
+		//没有任务能唤醒等待的一方时抛出DeadlockError，而不是使进程退出
+		{`receive(channel())`, "ERROR: 死锁: 所有任务都在等待"},
+		{`try { send(channel(), 1) } catch (e) { e.type }`, "DeadlockError"},
+		{`try { select([channel(), channel()]) } catch (e) { e.type }`, "DeadlockError"},
+		{`let ch = channel(); let t = spawn receive(ch); try { wait(t) } catch (e) { e.type }`, "DeadlockError"},
+		{`let a = channel(); let b = channel(); let f = fn() { receive(a); send(b, 1) }; spawn f(); try { receive(b) } catch (e) { e.type }`, "DeadlockError"},
+		//还有任务在执行时继续等待
+		{`let ch = channel(); let f = fn(n) { if (n == 0) { send(ch, "done") } else { f(n - 1) } }; spawn f(5000); receive(ch)`, "done"},
+	}
+
+	for _, tt := range tests {
+		if got := testEval(tt.input).Inspect(); got != tt.expected {
+			t.Errorf("%q: wrong result. want=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+
+	//等待中的任务响应上下文的结束
+	start := time.Now()
+	deadline := Budget{Deadline: time.Now().Add(50 * time.Millisecond)}
+	//一直执行的任务使receive不会被当作死锁
+	input := `let ch = channel(); let spin = fn() { spin() }; spawn spin(); receive(ch)`
+	evaluated := EvalContext(context.Background(), testParseProgram(input), object.NewEnvironment(), deadline)
+	testErrorKind(t, evaluated, object.TIMEOUT_ERROR, "执行超时")
+	input = `let ch = channel(); let spin = fn() { spin() }; spawn spin(); let f = fn() { receive(ch) }; wait(spawn f())`
+	deadline = Budget{Deadline: time.Now().Add(50 * time.Millisecond)}
+	evaluated = EvalContext(context.Background(), testParseProgram(input), object.NewEnvironment(), deadline)
+	testErrorKind(t, evaluated, object.TIMEOUT_ERROR, "执行超时")
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("deadline not respected. took %s", elapsed)
+	}
+}
+
+func TestConcurrentInterpreters(t *testing.T) {
+	input := `struct Point { x, y }
+	enum Shape { Circle(r), Rect(w, h) }
+	let area = fn(s) { if (is(s, Shape.Circle)) { 3 * s.r * s.r } else { s.w * s.h } };
+	let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) };
+	let nat = gen fn() { let loop = fn(n) { yield n; loop(n + 1) }; loop(0) };
+	let g = nat();
+	let p = Point(1, 2);
+	p.x = fib(15);
+	let t = spawn area(Shape.Rect(p.x, p.y));
+	let caught = try { 1 + "a" } catch (e) { e.type };
+	[id, p.x, wait(t), next(g), next(g), caught, "a,b".split(","), quote(1 + unquote(p.y)), 9223372036854775807 + 1]`
+
+	//修改程序的步骤在共享之前完成，之后各个解释器只读取程序
+	program := Optimize(Resolve(testParseProgram(input)))
+	before, err := ast.EncodeJSON(program)
+	if err != nil {
+		t.Fatalf("EncodeJSON returned error: %s", err)
+	}
+
+	const workers = 24
+	results := make([]object.Object, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			//每个解释器有自己的顶层变量和运行时配置
+			env := object.NewEnvironment()
+			env.Set("id", &object.Integer{Value: int64(i)})
+			switch i % 3 {
+			case 1:
+				env.Runtime().Overflow = object.OVERFLOW_WRAP
+			case 2:
+				results[i] = EvalContext(context.Background(), program, env, Budget{Steps: 100})
+				return
+			}
+			results[i] = Eval(program, env)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, result := range results {
+		switch i % 3 {
+		case 0:
+			expected := fmt.Sprintf("[%d, 610, 1220, 0, 1, TypeError, [a, b], QUOTE((1 + 2)), 9223372036854775808]", i)
+			if got := result.Inspect(); got != expected {
+				t.Errorf("worker %d: wrong result. want=%s, got=%s", i, expected, got)
+			}
+		case 1:
+			expected := fmt.Sprintf("[%d, 610, 1220, 0, 1, TypeError, [a, b], QUOTE((1 + 2)), -9223372036854775808]", i)
+			if got := result.Inspect(); got != expected {
+				t.Errorf("worker %d: wrong result. want=%s, got=%s", i, expected, got)
+			}
+		case 2:
+			testErrorKind(t, result, object.STEP_LIMIT_ERROR, "超出执行步数限制 100")
+		}
+	}
+
+	after, err := ast.EncodeJSON(program)
+	if err != nil {
+		t.Fatalf("EncodeJSON returned error: %s", err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Errorf("program modified by evaluation.\nbefore=%s\nafter= %s", before, after)
+	}
+}
+
+// 求值器与虚拟机共用的测试程序，解析变量前后的结果都应当与期望的结果一致
+func TestPrograms(t *testing.T) {
+	programs, err := evaltest.Programs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := func(program ast.Node) string {
+		env := object.NewEnvironment()
+		env.Runtime().Limits = evaltest.Limits
+		return evaltest.Describe(EvalContext(context.Background(), program, env, Budget{Steps: evaltest.MaxSteps}))
+	}
+
+	for _, p := range programs {
+		program := testParseProgram(p.Input)
+		macroEnv := object.NewEnvironment()
+		DefineMacros(program, macroEnv)
+		expanded, err := ExpandMacros(program, macroEnv)
+		if err != nil {
+			t.Errorf("%s: cannot expand %q: %s", p.Name, p.Input, err)
+			continue
+		}
+
+		if got := run(expanded); got != p.Expected {
+			t.Errorf("%s: %q wrong result.\nwant=%s\ngot= %s", p.Name, p.Input, p.Expected, got)
+		}
+		if got := run(Resolve(expanded.(*ast.Program))); got != p.Expected {
+			t.Errorf("%s: %q wrong resolved result.\nwant=%s\ngot= %s", p.Name, p.Input, p.Expected, got)
+		}
+	}
+}
+
+func testParseProgram(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func testNullObject(t *testing.T, obj object.Object) bool {
+	if obj != NULL {
+		t.Errorf("object is not NULL. got=%T (%+v)", obj, obj)
+		return false
+	}
 	return true
 }
 
@@ -354,6 +1645,85 @@ func TestEvalIntegerExpression(t *testing.T) {
 	}
 }
 
+func TestIntegerArithmeticErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1 / 0", errorMessage("除数不能为0")},
+		{"let f = fn(x) { 10 / x }; f(0)", errorMessage("除数不能为0")},
+		{"try { 1 / 0 } catch (e) { e.type }", "ArithmeticError"},
+		{"9223372036854775807 + 1", errorMessage("整数溢出: 9223372036854775807 + 1")},
+		{"-9223372036854775807 - 2", errorMessage("整数溢出: -9223372036854775807 - 2")},
+		{"4611686018427387904 * 2", errorMessage("整数溢出: 4611686018427387904 * 2")},
+		{"(-9223372036854775807 - 1) / -1", errorMessage("整数溢出: -9223372036854775808 / -1")},
+		{"-(-9223372036854775807 - 1)", errorMessage("整数溢出: --9223372036854775808")},
+		{"9223372036854775807 - 1", 9223372036854775806},
+		{"-4611686018427387904 * 2", -9223372036854775808},
+		{"-7 / 2", -3},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		env.Runtime().Overflow = object.OVERFLOW_ERROR
+		evaluated := Eval(testParseProgram(tt.input), env)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("expected string %q, got=%T (%+v)", expected, evaluated, evaluated)
+			}
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+
+	env := object.NewEnvironment()
+	env.Runtime().Overflow = object.OVERFLOW_WRAP
+	evaluated := Eval(testParseProgram("9223372036854775807 + 1"), env)
+	testIntegerObject(t, evaluated, -9223372036854775808)
+}
+
+func TestBigIntegers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "-9223372036854775809"},
+		{"99999999999999999999", "99999999999999999999"},
+		{"99999999999999999999 - 99999999999999999998", "1"},
+		{"-9223372036854775808", "-9223372036854775808"},
+		{"(9223372036854775807 + 1) / 2", "4611686018427387904"},
+		{"-(-9223372036854775807 - 1)", "9223372036854775808"},
+		{"-99999999999999999999 / 10", "-9999999999999999999"},
+		{"let f = fn(n) { if (n < 2) { 1 } else { n * f(n - 1) } }; f(25)", "15511210043330985984000000"},
+		{"99999999999999999999 > 1", "true"},
+		{"1 < -99999999999999999999", "false"},
+		{"99999999999999999999 == 99999999999999999998 + 1", "true"},
+		{"99999999999999999999 / 0", "ERROR: 除数不能为0"},
+		{"[1, 2][99999999999999999999]", "null"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	small := testEval("(9223372036854775807 + 1) - 1")
+	if _, ok := small.(*object.Integer); !ok {
+		t.Errorf("big integer not demoted. got=%T", small)
+	}
+	big := testEval("9223372036854775807 * 2")
+	if _, ok := big.(*object.BigInteger); !ok || big.Type() != object.INTEGER_OBJ {
+		t.Errorf("integer not promoted. got=%T", big)
+	}
+}
+
 func TestBangOperator(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -415,6 +1785,11 @@ func testEval(input string) object.Object {
 	return Eval(program, env)
 }
 
+// 与testEval相同，但求值前先解析变量
+func testEvalResolved(input string) object.Object {
+	return Eval(Resolve(testParseProgram(input)), object.NewEnvironment())
+}
+
 func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
 	//类型断言
 	result, ok := obj.(*object.Boolean)
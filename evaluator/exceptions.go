@@ -0,0 +1,88 @@
+package evaluator
+
+import (
+	"TroInterpreter/ast"
+	"TroInterpreter/object"
+)
+
+// catch中绑定的错误值，字段为错误信息、错误类型和throw抛出的值
+var errorType = &object.StructType{Name: "Error", Fields: []string{"message", "type", "value"}}
+
+// 求值throw语句，把值转换为错误向外传播
+func evalThrowStatement(node *ast.ThrowStatement, env *object.Environment) object.Object {
+	val := Eval(node.Value, env)
+	if isError(val) {
+		return val
+	}
+	return throwValue(val)
+}
+
+// 把throw的值转换为错误：catch得到的错误值原样重新抛出，字符串作为错误信息，结构体和变体以类型名作为错误类型
+func throwValue(val object.Object) *object.Error {
+	switch val := val.(type) {
+	case *object.Struct:
+		if val.Def == errorType {
+			message, kind, value := val.Field(0), val.Field(1), val.Field(2)
+			err := &object.Error{Message: message.Inspect(), Kind: kind.Inspect()}
+			if message, ok := message.(*object.String); ok {
+				err.Message = message.Value
+			}
+			if kind, ok := kind.(*object.String); ok {
+				err.Kind = kind.Value
+			}
+			if value != NULL {
+				err.Value = value
+			}
+			return err
+		}
+		return &object.Error{Message: val.Inspect(), Kind: typeName(val), Value: val}
+	case *object.Variant:
+		return &object.Error{Message: val.Inspect(), Kind: typeName(val), Value: val}
+	case *object.String:
+		return &object.Error{Message: val.Value, Kind: object.THROWN_ERROR, Value: val}
+	default:
+		return &object.Error{Message: val.Inspect(), Kind: object.THROWN_ERROR, Value: val}
+	}
+}
+
+// 把错误转换为catch中可以使用的值
+func errorValue(err *object.Error) *object.Struct {
+	var val object.Object = NULL
+	if err.Value != nil {
+		val = err.Value
+	}
+	return &object.Struct{
+		Def:    errorType,
+		Values: []object.Object{&object.String{Value: err.Message}, &object.String{Value: err.Kind}, val},
+	}
+}
+
+// 求值try表达式
+// 主体出错时执行catch，结果为catch的值，中断求值的错误不会被捕获
+// finally总会执行，只有在其中出错或return时才会覆盖结果
+func evalTryExpression(node *ast.TryExpression, env *object.Environment) object.Object {
+	result := Eval(node.Body, env)
+
+	if err, ok := result.(*object.Error); ok && err.Catchable() && node.Catch != nil {
+		var catchEnv *object.Environment
+		if node.CatchScope != nil {
+			catchEnv = object.NewScopeEnvironment(env, node.CatchScope)
+		} else {
+			catchEnv = object.NewEnclosedEnvironment(env)
+		}
+		setVariable(node.Param, errorValue(err), catchEnv)
+		result = Eval(node.Catch, catchEnv)
+	}
+
+	if node.Finally != nil {
+		finally := Eval(node.Finally, env)
+		if finally != nil && (finally.Type() == object.ERROR_OBJ || finally.Type() == object.RETRUN_VALUE_OBJ) {
+			return finally
+		}
+	}
+
+	if result == nil {
+		return NULL
+	}
+	return result
+}
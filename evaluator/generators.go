@@ -0,0 +1,43 @@
+package evaluator
+
+import (
+	"TroInterpreter/ast"
+	"TroInterpreter/object"
+)
+
+// 调用生成器函数得到生成器，函数体在第一次next时才开始执行
+// 函数体在生成器自己的goroutine中求值，挂起时整个求值过程(嵌套的块、try、函数调用)原样保留
+func newGenerator(function *object.Function, env *object.Environment, frame *object.Frame) *object.Generator {
+	return object.NewGenerator(frame.Function, func(yield func(object.Object) bool) object.Object {
+		frame.Yield = yield
+		return unwrapReturnValue(Eval(function.Body, env))
+	})
+}
+
+// 求值yield表达式，把值交给调用链上最近的生成器，恢复后表达式的值为null
+func evalYieldExpression(node *ast.YieldExpression, env *object.Environment) object.Object {
+	val := Eval(node.Value, env)
+	if isError(val) {
+		return val
+	}
+
+	yield := findYield(env.Frame())
+	if yield == nil {
+		return newError("yield不在生成器中")
+	}
+	//生成器不再使用，结束函数体，finally仍然会执行
+	if !yield(val) {
+		return newErrorOf(object.GENERATOR_EXIT, "生成器已经结束")
+	}
+	return NULL
+}
+
+// 沿调用栈查找最近的生成器，生成器中嵌套的函数也可以yield，查找到任务的边界为止
+func findYield(frame *object.Frame) func(object.Object) bool {
+	for f := frame; f != nil && !f.Task; f = f.Caller {
+		if f.Yield != nil {
+			return f.Yield
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package evaluator
+
+import (
+	"TroInterpreter/ast"
+	"TroInterpreter/object"
+	"fmt"
+)
+
+// DefineMacros 找出程序顶层的宏定义，存入env并从程序中移除
+func DefineMacros(program *ast.Program, env *object.Environment) {
+	var definitions []int
+
+	for i, statement := range program.Statements {
+		if isMacroDefinition(statement) {
+			addMacro(statement, env)
+			definitions = append(definitions, i)
+		}
+	}
+
+	//倒序删除，防止下标错位
+	for i := len(definitions) - 1; i >= 0; i-- {
+		definitionIndex := definitions[i]
+		program.Statements = append(
+			program.Statements[:definitionIndex],
+			program.Statements[definitionIndex+1:]...,
+		)
+	}
+}
+
+// 判断是不是宏定义：let 标识符 = macro(...) {...}
+func isMacroDefinition(node ast.Statement) bool {
+	letStatement, ok := node.(*ast.LetStatement)
+	if !ok {
+		return false
+	}
+
+	_, ok = letStatement.Value.(*ast.MacroLiteral)
+	return ok
+}
+
+// 把宏添加到env
+func addMacro(stmt ast.Statement, env *object.Environment) {
+	letStatement, _ := stmt.(*ast.LetStatement)
+	macroLiteral, _ := letStatement.Value.(*ast.MacroLiteral)
+
+	macro := &object.Macro{
+		Parameters: macroLiteral.Parameters,
+		Env:        env,
+		Body:       macroLiteral.Body,
+	}
+
+	env.Set(letStatement.Name.Value, macro)
+}
+
+// ExpandMacros 展开程序中所有的宏调用，宏的结果必须是quote
+// 展开直接修改program，与DefineMacros一样在求值之前完成
+func ExpandMacros(program ast.Node, env *object.Environment) (ast.Node, error) {
+	var err error
+
+	expanded := ast.Modify(program, func(node ast.Node) ast.Node {
+		callExpression, ok := node.(*ast.CallExpression)
+		if !ok || err != nil {
+			return node
+		}
+
+		macro, ok := isMacroCall(callExpression, env)
+		if !ok {
+			return node
+		}
+
+		if len(callExpression.Arguments) != len(macro.Parameters) {
+			err = fmt.Errorf("宏参数数量错误，期望=%d，实际=%d",
+				len(macro.Parameters), len(callExpression.Arguments))
+			return node
+		}
+
+		args := quoteArgs(callExpression)
+		evalEnv := extendMacroEnv(macro, args)
+
+		evaluated := Eval(macro.Body, evalEnv)
+		if isError(evaluated) {
+			err = fmt.Errorf("宏展开失败: %s", evaluated.(*object.Error).Message)
+			return node
+		}
+
+		quote, ok := unwrapReturnValue(evaluated).(*object.Quote)
+		if !ok {
+			err = fmt.Errorf("宏只能返回quote引用的代码，实际=%s", typeOf(evaluated))
+			return node
+		}
+
+		return quote.Node
+	})
+
+	return expanded, err
+}
+
+// 获取对象类型，nil视为NULL
+func typeOf(obj object.Object) object.TypeObject {
+	if obj == nil {
+		return object.NULL_OBJ
+	}
+	return unwrapReturnValue(obj).Type()
+}
+
+// 判断是不是宏调用
+func isMacroCall(exp *ast.CallExpression, env *object.Environment) (*object.Macro, bool) {
+	identifier, ok := exp.Function.(*ast.Identifier)
+	if !ok {
+		return nil, false
+	}
+
+	obj, ok := env.Get(identifier.Value)
+	if !ok {
+		return nil, false
+	}
+
+	macro, ok := obj.(*object.Macro)
+	if !ok {
+		return nil, false
+	}
+
+	return macro, true
+}
+
+// 宏的参数不求值，全部包裹为quote
+func quoteArgs(exp *ast.CallExpression) []*object.Quote {
+	var args []*object.Quote
+
+	for _, a := range exp.Arguments {
+		args = append(args, &object.Quote{Node: a})
+	}
+
+	return args
+}
+
+// 扩展宏环境
+func extendMacroEnv(macro *object.Macro, args []*object.Quote) *object.Environment {
+	extended := object.NewEnclosedEnvironment(macro.Env)
+
+	for paramIdx, param := range macro.Parameters {
+		extended.Set(param.Value, args[paramIdx])
+	}
+
+	return extended
+}
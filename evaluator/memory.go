@@ -0,0 +1,14 @@
+package evaluator
+
+import "TroInterpreter/object"
+
+// 记录新创建的对象，超出解释器的内存限制时返回错误
+func allocate(obj object.Object, runtime *object.Runtime) object.Object {
+	if obj == nil || isError(obj) {
+		return obj
+	}
+	if err := runtime.Allocate(obj); err != nil {
+		return err
+	}
+	return obj
+}
@@ -0,0 +1,197 @@
+package evaluator
+
+import (
+	"TroInterpreter/ast"
+	"TroInterpreter/object"
+	"strings"
+)
+
+// 各类型内置的方法，调用时接收者作为第一个参数
+var methods = map[object.TypeObject]map[string]*object.Builtin{
+	object.ARRAY_OBJ: {
+		"len":   builtins["len"],
+		"first": builtins["first"],
+		"last":  builtins["last"],
+		"push":  builtins["push"],
+		"rest": &object.Builtin{
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newErrorOf(object.ARGUMENT_ERROR, "参数数量错误，期望=0，实际=%d", len(args)-1)
+				}
+
+				arr := args[0].(*object.Array)
+				length := len(arr.Elements)
+				if length == 0 {
+					return NULL
+				}
+
+				newElements := make([]object.Object, length-1)
+				copy(newElements, arr.Elements[1:length])
+				return &object.Array{Elements: newElements}
+			},
+		},
+		"join": &object.Builtin{
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 2 {
+					return newErrorOf(object.ARGUMENT_ERROR, "参数数量错误，期望=1，实际=%d", len(args)-1)
+				}
+				sep, ok := args[1].(*object.String)
+				if !ok {
+					return newErrorOf(object.ARGUMENT_ERROR, "参数类型错误，期望=string，实际=%s", args[1].Type())
+				}
+
+				var parts []string
+				for _, e := range args[0].(*object.Array).Elements {
+					parts = append(parts, e.Inspect())
+				}
+				return &object.String{Value: strings.Join(parts, sep.Value)}
+			},
+		},
+	},
+	object.STRING_OBJ: {
+		"len": builtins["len"],
+		"upper": stringMethod(func(s string) object.Object {
+			return &object.String{Value: strings.ToUpper(s)}
+		}),
+		"lower": stringMethod(func(s string) object.Object {
+			return &object.String{Value: strings.ToLower(s)}
+		}),
+		"trim": stringMethod(func(s string) object.Object {
+			return &object.String{Value: strings.TrimSpace(s)}
+		}),
+		"split": stringMethodWithArg(func(s, sep string) object.Object {
+			var elements []object.Object
+			for _, part := range strings.Split(s, sep) {
+				elements = append(elements, &object.String{Value: part})
+			}
+			return &object.Array{Elements: elements}
+		}),
+		"contains": stringMethodWithArg(func(s, sub string) object.Object {
+			return bool2BoolObject(strings.Contains(s, sub))
+		}),
+	},
+	object.GENERATOR_OBJ: {
+		"next":  builtins["next"],
+		"close": builtins["close"],
+	},
+	object.CHANNEL_OBJ: {
+		"send":    builtins["send"],
+		"receive": builtins["receive"],
+		"close":   builtins["close"],
+	},
+	object.TASK_OBJ: {
+		"wait": builtins["wait"],
+	},
+}
+
+// 没有参数的字符串方法
+func stringMethod(fn func(s string) object.Object) *object.Builtin {
+	return &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newErrorOf(object.ARGUMENT_ERROR, "参数数量错误，期望=0，实际=%d", len(args)-1)
+			}
+			return fn(args[0].(*object.String).Value)
+		},
+	}
+}
+
+// 有一个字符串参数的字符串方法
+func stringMethodWithArg(fn func(s, arg string) object.Object) *object.Builtin {
+	return &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newErrorOf(object.ARGUMENT_ERROR, "参数数量错误，期望=1，实际=%d", len(args)-1)
+			}
+			arg, ok := args[1].(*object.String)
+			if !ok {
+				return newErrorOf(object.ARGUMENT_ERROR, "参数类型错误，期望=string，实际=%s", args[1].Type())
+			}
+			return fn(args[0].(*object.String).Value, arg.Value)
+		},
+	}
+}
+
+// 求值属性表达式
+func evalPropertyExpression(node *ast.PropertyExpression, env *object.Environment) object.Object {
+	receiver := Eval(node.Object, env)
+	if isError(receiver) {
+		return receiver
+	}
+
+	if val, ok := getProperty(receiver, node.Property.Value); ok {
+		return val
+	}
+	return newErrorOf(object.NAME_ERROR, "%s 没有属性 %s", typeName(receiver), node.Property.Value)
+}
+
+// 获取对象的属性，数组和字符串没有属性，只有方法
+func getProperty(receiver object.Object, name string) (object.Object, bool) {
+	switch receiver := receiver.(type) {
+	case *object.Struct:
+		return receiver.Get(name)
+	case *object.Enum:
+		variant, ok := receiver.Variant(name)
+		if !ok {
+			return nil, false
+		}
+		if variant.Unit != nil {
+			return variant.Unit, true
+		}
+		return variant, true
+	case *object.Variant:
+		return receiver.Get(name)
+	case *object.Module:
+		val, ok := receiver.Exports[name]
+		return val, ok
+	default:
+		return nil, false
+	}
+}
+
+// 求值方法调用value.name(args)要调用的函数和实际传入的参数，出错时函数为错误
+// 依次查找：对象的属性、类型内置的方法、以接收者为第一个参数的同名函数
+func evalMethodCallee(node *ast.CallExpression, property *ast.PropertyExpression, env *object.Environment) (object.Object, []object.Object) {
+	receiver := Eval(property.Object, env)
+	if isError(receiver) {
+		return receiver, nil
+	}
+
+	args := evalExpressions(node.Arguments, env)
+	if len(args) == 1 && isError(args[0]) {
+		return args[0], nil
+	}
+
+	name := property.Property.Value
+	fallback, ok := env.Get(name)
+	if !ok {
+		if builtin, ok := builtins[name]; ok {
+			fallback = builtin
+		}
+	}
+
+	fn, args, err := resolveMethod(receiver, name, args, fallback)
+	if err != nil {
+		return err, nil
+	}
+	return fn, args
+}
+
+// 查找方法调用要调用的函数和实际传入的参数
+// 依次查找：对象的属性、类型内置的方法、fallback(调用处名为name的变量或内置函数，没有时为nil)
+// 后两种情况接收者作为第一个参数传入
+func resolveMethod(receiver object.Object, name string, args []object.Object, fallback object.Object) (object.Object, []object.Object, *object.Error) {
+	if fn, ok := getProperty(receiver, name); ok {
+		return fn, args, nil
+	}
+
+	withReceiver := append([]object.Object{receiver}, args...)
+	if method, ok := methods[receiver.Type()][name]; ok {
+		return method, withReceiver, nil
+	}
+	if fallback != nil {
+		return fallback, withReceiver, nil
+	}
+
+	return nil, nil, newErrorOf(object.NAME_ERROR, "%s 没有方法 %s", typeName(receiver), name)
+}
@@ -0,0 +1,151 @@
+package evaluator
+
+import (
+	"TroInterpreter/ast"
+	"TroInterpreter/lexer"
+	"TroInterpreter/object"
+	"TroInterpreter/parser"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultSearchPath 返回TRO_PATH环境变量中的模块搜索路径
+func DefaultSearchPath() []string {
+	var paths []string
+	for _, dir := range filepath.SplitList(os.Getenv("TRO_PATH")) {
+		if dir != "" {
+			paths = append(paths, dir)
+		}
+	}
+	return paths
+}
+
+// ModuleRunner 在模块自己的顶层环境中执行模块的程序(已展开宏)，返回names中各个名称绑定的值
+// 求值器与字节码虚拟机各自提供实现，加载、缓存和循环导入检测由ImportModule完成
+type ModuleRunner func(program *ast.Program, env *object.Environment, names []string) (map[string]object.Object, *object.Error)
+
+// 求值import语句，加载模块并绑定到名称上
+func evalImportStatement(node *ast.ImportStatement, env *object.Environment) object.Object {
+	module := ImportModule(node.Path.Value, env, runModule)
+	if isError(module) {
+		return module
+	}
+
+	env.Set(node.Name(), module)
+	return nil
+}
+
+// ImportModule 查找并加载name对应的模块，env为导入者的环境，尚未加载的模块由run执行
+func ImportModule(name string, env *object.Environment, run ModuleRunner) object.Object {
+	path, ok := resolveModulePath(name, env)
+	if !ok {
+		return newErrorOf(object.IMPORT_ERROR, "找不到模块: %s", name)
+	}
+	return loadModule(path, env, run)
+}
+
+// 查找模块文件：绝对路径直接使用，相对路径先在导入者所在目录查找，再依次在搜索路径中查找
+func resolveModulePath(name string, env *object.Environment) (string, bool) {
+	var candidates []string
+	if filepath.IsAbs(name) {
+		candidates = append(candidates, name)
+	} else {
+		dir := "."
+		if file := env.File(); file != "" {
+			dir = filepath.Dir(file)
+		}
+		candidates = append(candidates, filepath.Join(dir, name))
+		for _, searchDir := range env.Runtime().SearchPath {
+			candidates = append(candidates, filepath.Join(searchDir, name))
+		}
+	}
+
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			abs, err := filepath.Abs(candidate)
+			if err != nil {
+				return "", false
+			}
+			return abs, true
+		}
+	}
+	return "", false
+}
+
+// 加载模块，每个模块在同一个运行时中只执行一次，同时导入的任务等待第一个任务加载完成
+func loadModule(path string, env *object.Environment, run ModuleRunner) object.Object {
+	runtime := env.Runtime()
+	module, cycle, waitErr := runtime.BeginLoading(path, env.Imports())
+	switch {
+	case waitErr != nil:
+		return waitErr
+	case module != nil:
+		return module
+	case cycle != nil:
+		return newErrorOf(object.IMPORT_ERROR, "循环导入: %s", strings.Join(cycle, " -> "))
+	}
+
+	module, err := evalModule(path, env, run)
+	runtime.EndLoading(path, module)
+	if err != nil {
+		return err
+	}
+	return module
+}
+
+// 在模块自己的环境中执行模块，收集导出的绑定
+func evalModule(path string, importer *object.Environment, run ModuleRunner) (*object.Module, *object.Error) {
+	input, err := os.ReadFile(path)
+	if err != nil {
+		return nil, newErrorOf(object.IMPORT_ERROR, "无法读取模块 %s: %s", path, err)
+	}
+
+	p := parser.New(lexer.New(string(input)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, newErrorOf(object.IMPORT_ERROR, "模块 %s 解析错误: %s", path, strings.Join(p.Errors(), "; "))
+	}
+
+	env := object.NewModuleEnvironment(importer, path)
+	macroEnv := object.NewModuleEnvironment(importer, path)
+	DefineMacros(program, macroEnv)
+	expanded, expandErr := ExpandMacros(program, macroEnv)
+	if expandErr != nil {
+		return nil, newErrorOf(object.IMPORT_ERROR, "模块 %s 宏错误: %s", path, expandErr)
+	}
+
+	if importer.Runtime().Optimize {
+		expanded = Optimize(expanded.(*ast.Program))
+	}
+
+	var names []string
+	for _, stmt := range program.Statements {
+		if export, ok := stmt.(*ast.ExportStatement); ok {
+			names = append(names, export.Names()...)
+		}
+	}
+
+	exports, runErr := run(expanded.(*ast.Program), env, names)
+	if runErr != nil {
+		return nil, runErr
+	}
+
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return &object.Module{Name: name, Path: path, Exports: exports}, nil
+}
+
+// 用求值器执行模块
+func runModule(program *ast.Program, env *object.Environment, names []string) (map[string]object.Object, *object.Error) {
+	if result := Eval(Resolve(program), env); isError(result) {
+		return nil, result.(*object.Error)
+	}
+
+	exports := map[string]object.Object{}
+	for _, name := range names {
+		if val, ok := env.Get(name); ok {
+			exports[name] = val
+		}
+	}
+	return exports, nil
+}
@@ -0,0 +1,128 @@
+package evaluator
+
+import (
+	"TroInterpreter/ast"
+	"TroInterpreter/object"
+	"sort"
+)
+
+// 本文件导出求值器的基本运算，供字节码虚拟机使用，两者的语义和错误信息保持一致
+
+// BuiltinNames 返回所有内置函数的名称，按字典序排列
+func BuiltinNames() []string {
+	var names []string
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Builtin 返回名为name的内置函数，没有时返回nil
+func Builtin(name string) *object.Builtin {
+	return builtins[name]
+}
+
+// IsTruthy 判断条件是否成立，只有false和null不成立
+func IsTruthy(obj object.Object) bool {
+	return isTruthy(obj)
+}
+
+// Prefix 计算前缀表达式，记录结果占用的内存
+func Prefix(operator string, right object.Object, runtime *object.Runtime) object.Object {
+	return allocate(evalPrefixExpression(operator, right, runtime), runtime)
+}
+
+// Infix 计算中缀表达式，记录结果占用的内存
+func Infix(operator string, left, right object.Object, runtime *object.Runtime) object.Object {
+	return allocate(evalInfixExpression(operator, left, right, runtime), runtime)
+}
+
+// NewArray 创建数组，记录占用的内存
+func NewArray(elements []object.Object, runtime *object.Runtime) object.Object {
+	return allocate(&object.Array{Elements: elements}, runtime)
+}
+
+// Index 求值索引表达式left[index]，记录字符串索引创建的字符串占用的内存
+func Index(left, index object.Object, runtime *object.Runtime) object.Object {
+	return evalIndexExpression(left, index, runtime)
+}
+
+// GetProperty 读取属性receiver.name，没有该属性时返回错误
+func GetProperty(receiver object.Object, name string) object.Object {
+	if val, ok := getProperty(receiver, name); ok {
+		return val
+	}
+	return newErrorOf(object.NAME_ERROR, "%s 没有属性 %s", typeName(receiver), name)
+}
+
+// SetProperty 给结构体的字段赋值，返回赋的值
+func SetProperty(receiver object.Object, name string, val object.Object) object.Object {
+	return setProperty(receiver, name, val)
+}
+
+// ResolveMethod 查找方法调用receiver.name(args)要调用的函数和实际传入的参数
+// fallback为调用处名为name的变量或内置函数，没有时为nil
+func ResolveMethod(receiver object.Object, name string, args []object.Object, fallback object.Object) (object.Object, []object.Object, *object.Error) {
+	return resolveMethod(receiver, name, args, fallback)
+}
+
+// Call 调用内置函数、结构体或变体的构造函数，记录创建的对象占用的内存
+func Call(fn object.Object, args []object.Object, runtime *object.Runtime) object.Object {
+	return allocate(applyCallable(fn, args, runtime), runtime)
+}
+
+// ThrowValue 把throw的值转换为错误
+func ThrowValue(val object.Object) *object.Error {
+	return throwValue(val)
+}
+
+// ErrorValue 把错误转换为catch中绑定的值
+func ErrorValue(err *object.Error) object.Object {
+	return errorValue(err)
+}
+
+// DefineStruct 根据struct声明创建结构体类型
+func DefineStruct(node *ast.StructStatement) object.Object {
+	return newStructType(node)
+}
+
+// DefineEnum 根据enum声明创建枚举
+func DefineEnum(node *ast.EnumStatement) object.Object {
+	return newEnum(node)
+}
+
+// UnquoteArguments 按求值的顺序返回quote调用中所有unquote调用的参数
+func UnquoteArguments(call *ast.CallExpression) []ast.Expression {
+	if len(call.Arguments) != 1 {
+		return nil
+	}
+
+	var args []ast.Expression
+	ast.Modify(call.Arguments[0], func(node ast.Node) ast.Node {
+		if unquote, ok := node.(*ast.CallExpression); ok && isUnquoteCall(unquote) && len(unquote.Arguments) == 1 {
+			args = append(args, unquote.Arguments[0])
+		}
+		return node
+	})
+	return args
+}
+
+// Quote 求值quote调用：复制参数，把其中的unquote调用依次替换为values中的值
+// values与UnquoteArguments返回的参数一一对应
+func Quote(call *ast.CallExpression, values []object.Object) object.Object {
+	if len(call.Arguments) != 1 {
+		return newErrorOf(object.ARGUMENT_ERROR, "参数数量错误，期望=1，实际=%d", len(call.Arguments))
+	}
+
+	next := 0
+	node, err := replaceUnquoteCalls(ast.Clone(call.Arguments[0]), func(arg ast.Expression) object.Object {
+		val := values[next]
+		next++
+		return val
+	})
+	if err != nil {
+		return err
+	}
+	return &object.Quote{Node: node}
+}
@@ -0,0 +1,234 @@
+package evaluator
+
+import (
+	"TroInterpreter/ast"
+	"TroInterpreter/object"
+	"TroInterpreter/token"
+	"strconv"
+)
+
+// 折叠常量时使用的运行时：溢出时报错，这样溢出的表达式不会被折叠，留到运行时按实际的溢出处理方式计算
+var foldRuntime = &object.Runtime{Overflow: object.OVERFLOW_ERROR}
+
+// Optimize 优化宏展开之后的程序，直接修改并返回program：
+// 计算只有整数、字符串、布尔字面量参与的运算，删除条件为字面量的if中不会执行的分支，删除return之后的语句
+// 运算出错(如除以0、类型不匹配、溢出)的表达式不折叠，quote的参数保持原样，所以优化前后的求值结果相同
+// 折叠得到的字符串与字面量一样，不计入内存限制
+// 与Resolve一样，不能与使用同一个程序的求值同时进行
+func Optimize(program *ast.Program) *ast.Program {
+	program.Statements = optimizeStatements(program.Statements)
+	return program
+}
+
+// 优化语句序列，语句序列的值为最后一条语句的值
+func optimizeStatements(statements []ast.Statement) []ast.Statement {
+	optimized := make([]ast.Statement, 0, len(statements))
+
+	for i, statement := range statements {
+		statement = optimizeStatement(statement)
+		last := i == len(statements)-1
+
+		if block, ok := constantBranch(statement); ok {
+			switch {
+			case block != nil && len(block.Statements) > 0:
+				//块不产生新的作用域，直接展开到当前语句序列中
+				optimized = append(optimized, block.Statements...)
+			case !last:
+				//没有执行的分支，值也不会被使用
+			default:
+				optimized = append(optimized, statement)
+			}
+		} else {
+			optimized = append(optimized, statement)
+		}
+
+		if n := len(optimized); n > 0 {
+			if _, ok := optimized[n-1].(*ast.ReturnStatement); ok {
+				break
+			}
+		}
+	}
+
+	return optimized
+}
+
+// 如果语句是条件为字面量的if表达式，返回会执行的分支，没有时为nil
+func constantBranch(statement ast.Statement) (*ast.BlockStatement, bool) {
+	expressionStatement, ok := statement.(*ast.ExpressionStatement)
+	if !ok {
+		return nil, false
+	}
+	ie, ok := expressionStatement.Expression.(*ast.IfExpression)
+	if !ok {
+		return nil, false
+	}
+	condition := constantValue(ie.Condition)
+	if condition == nil {
+		return nil, false
+	}
+
+	if isTruthy(condition) {
+		return ie.Consequence, true
+	}
+	return ie.Alternative, true
+}
+
+func optimizeStatement(statement ast.Statement) ast.Statement {
+	switch node := statement.(type) {
+	case *ast.ExpressionStatement:
+		node.Expression = optimizeExpression(node.Expression)
+	case *ast.LetStatement:
+		node.Value = optimizeExpression(node.Value)
+	case *ast.ReturnStatement:
+		node.ReturnValue = optimizeExpression(node.ReturnValue)
+	case *ast.ThrowStatement:
+		node.Value = optimizeExpression(node.Value)
+	case *ast.ExportStatement:
+		node.Statement = optimizeStatement(node.Statement)
+	}
+	return statement
+}
+
+func optimizeBlock(block *ast.BlockStatement) {
+	if block != nil {
+		block.Statements = optimizeStatements(block.Statements)
+	}
+}
+
+func optimizeExpression(expression ast.Expression) ast.Expression {
+	switch node := expression.(type) {
+	case *ast.PrefixExpression:
+		node.Right = optimizeExpression(node.Right)
+		if right := constantValue(node.Right); right != nil {
+			if folded := literal(evalPrefixExpression(node.Operator, right, foldRuntime), node); folded != nil {
+				return folded
+			}
+		}
+
+	case *ast.InfixExpression:
+		node.Left = optimizeExpression(node.Left)
+		node.Right = optimizeExpression(node.Right)
+		left, right := constantValue(node.Left), constantValue(node.Right)
+		if left != nil && right != nil {
+			if folded := literal(evalInfixExpression(node.Operator, left, right, foldRuntime), node.Left); folded != nil {
+				return folded
+			}
+		}
+
+	case *ast.IfExpression:
+		node.Condition = optimizeExpression(node.Condition)
+		optimizeBlock(node.Consequence)
+		optimizeBlock(node.Alternative)
+		return optimizeIf(node)
+
+	case *ast.IndexExpression:
+		node.Left = optimizeExpression(node.Left)
+		node.Index = optimizeExpression(node.Index)
+
+	case *ast.CallExpression:
+		//quote的参数是代码而不是值，不能修改
+		if node.Function.TokenLiteral() == "quote" {
+			return node
+		}
+		node.Function = optimizeExpression(node.Function)
+		for i, argument := range node.Arguments {
+			node.Arguments[i] = optimizeExpression(argument)
+		}
+
+	case *ast.FunctionExpression:
+		optimizeBlock(node.Body)
+
+	case *ast.YieldExpression:
+		node.Value = optimizeExpression(node.Value)
+
+	case *ast.SpawnExpression:
+		optimizeExpression(node.Call)
+
+	case *ast.PropertyExpression:
+		node.Object = optimizeExpression(node.Object)
+
+	case *ast.AssignExpression:
+		node.Target.Object = optimizeExpression(node.Target.Object)
+		node.Value = optimizeExpression(node.Value)
+
+	case *ast.ArrayLiteral:
+		for i, element := range node.Elements {
+			node.Elements[i] = optimizeExpression(element)
+		}
+
+	case *ast.TryExpression:
+		optimizeBlock(node.Body)
+		optimizeBlock(node.Catch)
+		optimizeBlock(node.Finally)
+	}
+
+	return expression
+}
+
+// 删除条件为字面量的if中不会执行的分支
+func optimizeIf(node *ast.IfExpression) ast.Expression {
+	condition := constantValue(node.Condition)
+	if condition == nil {
+		return node
+	}
+
+	block := node.Alternative
+	if isTruthy(condition) {
+		block = node.Consequence
+	}
+
+	if block == nil {
+		//条件不成立且没有else，值为null
+		node.Consequence = &ast.BlockStatement{Token: node.Consequence.Token}
+		return node
+	}
+
+	//分支只有一个表达式时，if的值就是这个表达式的值
+	if len(block.Statements) == 1 {
+		if expressionStatement, ok := block.Statements[0].(*ast.ExpressionStatement); ok {
+			return expressionStatement.Expression
+		}
+	}
+
+	node.Condition = literal(TRUE, node.Condition)
+	node.Consequence = block
+	node.Alternative = nil
+	return node
+}
+
+// 字面量的值，不是整数、字符串、布尔字面量时返回nil，大整数字面量不参与折叠
+func constantValue(expression ast.Expression) object.Object {
+	switch node := expression.(type) {
+	case *ast.IntegerLiteral:
+		if node.Big == nil {
+			return &object.Integer{Value: node.Value}
+		}
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}
+	case *ast.Boolean:
+		return bool2BoolObject(node.Value)
+	}
+	return nil
+}
+
+// 把折叠的结果转换为与at位置相同的字面量，结果是错误或大整数时返回nil
+func literal(obj object.Object, at ast.Node) ast.Expression {
+	var tok token.Token
+	tok.Line, tok.Column = ast.Position(at)
+
+	switch obj := obj.(type) {
+	case *object.Integer:
+		tok.Type, tok.Literal = token.NUMBER, strconv.FormatInt(obj.Value, 10)
+		return &ast.IntegerLiteral{Token: tok, Value: obj.Value}
+	case *object.String:
+		tok.Type, tok.Literal = token.STRING, obj.Value
+		return &ast.StringLiteral{Token: tok, Value: obj.Value}
+	case *object.Boolean:
+		tok.Type, tok.Literal = token.FALSE, "false"
+		if obj.Value {
+			tok.Type, tok.Literal = token.TRUE, "true"
+		}
+		return &ast.Boolean{Token: tok, Value: obj.Value}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package evaluator
+
+import (
+	"TroInterpreter/ast"
+	"TroInterpreter/object"
+	"TroInterpreter/token"
+	"fmt"
+)
+
+// 引用，参数不求值直接包裹起来，其中的unquote调用会被求值
+// 替换unquote调用前先复制参数，同一个quote再次求值时仍能看到unquote调用
+func quote(node ast.Node, env *object.Environment) object.Object {
+	node, err := evalUnquoteCalls(ast.Clone(node), env)
+	if err != nil {
+		return err
+	}
+	return &object.Quote{Node: node}
+}
+
+// 求值quote中所有的unquote调用，并把结果转换回ast节点
+func evalUnquoteCalls(quoted ast.Node, env *object.Environment) (ast.Node, *object.Error) {
+	return replaceUnquoteCalls(quoted, func(arg ast.Expression) object.Object {
+		return Eval(arg, env)
+	})
+}
+
+// 按ast.Modify遍历的顺序，把每个unquote调用替换为unquote(arg)的值对应的ast节点
+// unquote的参数出错或值不能转换为ast节点时返回第一个错误，之后的unquote调用不再求值
+func replaceUnquoteCalls(quoted ast.Node, unquote func(arg ast.Expression) object.Object) (ast.Node, *object.Error) {
+	var err *object.Error
+	node := ast.Modify(quoted, func(node ast.Node) ast.Node {
+		if err != nil || !isUnquoteCall(node) {
+			return node
+		}
+
+		call, ok := node.(*ast.CallExpression)
+		if !ok {
+			return node
+		}
+
+		if len(call.Arguments) != 1 {
+			return node
+		}
+
+		converted, convertErr := convertObjectToASTNode(unquote(call.Arguments[0]))
+		if convertErr != nil {
+			err = convertErr
+			return node
+		}
+		return converted
+	})
+	return node, err
+}
+
+// 判断是不是unquote调用
+func isUnquoteCall(node ast.Node) bool {
+	callExpression, ok := node.(*ast.CallExpression)
+	if !ok {
+		return false
+	}
+
+	return callExpression.Function.TokenLiteral() == "unquote"
+}
+
+// 把对象转换为ast节点，错误原样返回，函数等没有对应字面量的值返回类型错误
+func convertObjectToASTNode(obj object.Object) (ast.Node, *object.Error) {
+	switch obj := unwrapReturnValue(obj).(type) {
+	case *object.Error:
+		return nil, obj
+
+	case *object.Integer:
+		t := token.Token{
+			Type:    token.NUMBER,
+			Literal: fmt.Sprintf("%d", obj.Value),
+		}
+		return &ast.IntegerLiteral{Token: t, Value: obj.Value}, nil
+
+	case *object.BigInteger:
+		t := token.Token{
+			Type:    token.NUMBER,
+			Literal: obj.Value.String(),
+		}
+		return &ast.IntegerLiteral{Token: t, Big: obj.Value}, nil
+
+	case *object.String:
+		t := token.Token{
+			Type:    token.STRING,
+			Literal: obj.Value,
+		}
+		return &ast.StringLiteral{Token: t, Value: obj.Value}, nil
+
+	case *object.Boolean:
+		var t token.Token
+		if obj.Value {
+			t = token.Token{Type: token.TRUE, Literal: "true"}
+		} else {
+			t = token.Token{Type: token.FALSE, Literal: "false"}
+		}
+		return &ast.Boolean{Token: t, Value: obj.Value}, nil
+
+	case *object.Quote:
+		return obj.Node, nil
+
+	default:
+		return nil, newErrorOf(object.TYPE_ERROR, "unquote的值不能转换为代码: %s", typeOf(obj))
+	}
+}
@@ -0,0 +1,294 @@
+package evaluator
+
+import (
+	"TroInterpreter/ast"
+	"TroInterpreter/object"
+)
+
+// Resolve 静态解析宏展开之后的程序，直接修改并返回program
+// 给每个函数体和catch块分配静态作用域，其中声明的变量(参数、let、struct、enum、import)各占一个槽，
+// 标识符记录所在作用域向外的层数和槽，求值时直接按下标读取，不再逐层按名称查找；
+// 顶层的变量仍然按名称存放在顶层环境中，所以REPL中之后输入的代码可以使用之前定义的变量
+// 槽还没有赋值时(如let之前读取同名的外层变量)按名称继续向外查找，结果与没有解析时相同
+// quote的参数不解析，宏展开时求值的代码也不解析，它们按名称查找
+// 解析会修改程序，需要在程序被多个goroutine共享之前完成
+func Resolve(program *ast.Program) *ast.Program {
+	r := &resolver{scopes: []*ast.Scope{nil}, seen: map[*ast.Identifier]bool{}}
+	r.resolve(program)
+	return program
+}
+
+// 解析器，scopes为从外到内的静态作用域，nil表示顶层
+type resolver struct {
+	scopes []*ast.Scope
+	seen   map[*ast.Identifier]bool // 已经解析的标识符，宏展开可能把同一个节点放在多个位置
+}
+
+func (r *resolver) resolve(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, statement := range node.Statements {
+			r.resolve(statement)
+		}
+
+	case *ast.BlockStatement:
+		for _, statement := range node.Statements {
+			r.resolve(statement)
+		}
+
+	case *ast.ExpressionStatement:
+		r.resolve(node.Expression)
+
+	case *ast.LetStatement:
+		r.resolve(node.Value)
+		r.lookup(node.Name)
+
+	case *ast.ReturnStatement:
+		r.resolve(node.ReturnValue)
+
+	case *ast.ThrowStatement:
+		r.resolve(node.Value)
+
+	case *ast.YieldExpression:
+		r.resolve(node.Value)
+
+	case *ast.SpawnExpression:
+		r.resolve(node.Call)
+
+	case *ast.StructStatement:
+		r.lookup(node.Name)
+
+	case *ast.EnumStatement:
+		r.lookup(node.Name)
+
+	case *ast.ExportStatement:
+		r.resolve(node.Statement)
+
+	case *ast.Identifier:
+		r.lookup(node)
+
+	case *ast.PrefixExpression:
+		r.resolve(node.Right)
+
+	case *ast.InfixExpression:
+		r.resolve(node.Left)
+		r.resolve(node.Right)
+
+	case *ast.IndexExpression:
+		r.resolve(node.Left)
+		r.resolve(node.Index)
+
+	case *ast.PropertyExpression:
+		r.resolve(node.Object)
+
+	case *ast.AssignExpression:
+		r.resolve(node.Target.Object)
+		r.resolve(node.Value)
+
+	case *ast.ArrayLiteral:
+		for _, element := range node.Elements {
+			r.resolve(element)
+		}
+
+	case *ast.IfExpression:
+		r.resolve(node.Condition)
+		r.resolve(node.Consequence)
+		if node.Alternative != nil {
+			r.resolve(node.Alternative)
+		}
+
+	case *ast.CallExpression:
+		//quote的参数会被复制，解析的结果不会保留
+		if node.Function.TokenLiteral() == "quote" {
+			return
+		}
+		r.resolve(node.Function)
+		for _, argument := range node.Arguments {
+			r.resolve(argument)
+		}
+
+	case *ast.FunctionExpression:
+		scope := &ast.Scope{}
+		for _, param := range node.Parameters {
+			declare(scope, param.Value)
+		}
+		hoist(scope, node.Body)
+		node.Scope = scope
+
+		r.scopes = append(r.scopes, scope)
+		for _, param := range node.Parameters {
+			r.lookup(param)
+		}
+		r.resolve(node.Body)
+		r.scopes = r.scopes[:len(r.scopes)-1]
+
+	case *ast.TryExpression:
+		r.resolve(node.Body)
+		if node.Catch != nil {
+			scope := &ast.Scope{}
+			declare(scope, node.Param.Value)
+			hoist(scope, node.Catch)
+			node.CatchScope = scope
+
+			r.scopes = append(r.scopes, scope)
+			r.lookup(node.Param)
+			r.resolve(node.Catch)
+			r.scopes = r.scopes[:len(r.scopes)-1]
+		}
+		if node.Finally != nil {
+			r.resolve(node.Finally)
+		}
+	}
+}
+
+// 从内向外查找声明了标识符的作用域
+// 同一个节点出现在多个位置且结果不同时不做解析，按名称查找
+func (r *resolver) lookup(ident *ast.Identifier) {
+	if r.seen[ident] {
+		resolution, depth, slot := ident.Resolution, ident.Depth, ident.Slot
+		r.locate(ident)
+		if ident.Resolution != resolution || ident.Depth != depth || ident.Slot != slot {
+			ident.Resolution = ast.Unresolved
+		}
+		return
+	}
+	r.seen[ident] = true
+	r.locate(ident)
+}
+
+func (r *resolver) locate(ident *ast.Identifier) {
+	depth := 0
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		scope := r.scopes[i]
+		if scope == nil {
+			ident.Resolution, ident.Depth = ast.Global, depth
+			return
+		}
+		if slot := scope.Slot(ident.Value); slot >= 0 {
+			ident.Resolution, ident.Depth, ident.Slot = ast.Local, depth, slot
+			return
+		}
+		depth++
+	}
+}
+
+// 在作用域中声明变量，已经声明过时使用原来的槽
+func declare(scope *ast.Scope, name string) {
+	if scope.Slot(name) < 0 {
+		scope.Names = append(scope.Names, name)
+	}
+}
+
+// 提前声明node中属于当前作用域的变量，不进入函数、catch块和quote
+func hoist(scope *ast.Scope, node ast.Node) {
+	switch node := node.(type) {
+	case *ast.BlockStatement:
+		for _, statement := range node.Statements {
+			hoist(scope, statement)
+		}
+
+	case *ast.ExpressionStatement:
+		hoist(scope, node.Expression)
+
+	case *ast.LetStatement:
+		hoist(scope, node.Value)
+		declare(scope, node.Name.Value)
+
+	case *ast.ReturnStatement:
+		hoist(scope, node.ReturnValue)
+
+	case *ast.ThrowStatement:
+		hoist(scope, node.Value)
+
+	case *ast.YieldExpression:
+		hoist(scope, node.Value)
+
+	case *ast.SpawnExpression:
+		hoist(scope, node.Call)
+
+	case *ast.StructStatement:
+		declare(scope, node.Name.Value)
+
+	case *ast.EnumStatement:
+		declare(scope, node.Name.Value)
+
+	case *ast.ImportStatement:
+		declare(scope, node.Name())
+
+	case *ast.ExportStatement:
+		hoist(scope, node.Statement)
+
+	case *ast.PrefixExpression:
+		hoist(scope, node.Right)
+
+	case *ast.InfixExpression:
+		hoist(scope, node.Left)
+		hoist(scope, node.Right)
+
+	case *ast.IndexExpression:
+		hoist(scope, node.Left)
+		hoist(scope, node.Index)
+
+	case *ast.PropertyExpression:
+		hoist(scope, node.Object)
+
+	case *ast.AssignExpression:
+		hoist(scope, node.Target.Object)
+		hoist(scope, node.Value)
+
+	case *ast.ArrayLiteral:
+		for _, element := range node.Elements {
+			hoist(scope, element)
+		}
+
+	case *ast.IfExpression:
+		hoist(scope, node.Condition)
+		hoist(scope, node.Consequence)
+		if node.Alternative != nil {
+			hoist(scope, node.Alternative)
+		}
+
+	case *ast.TryExpression:
+		hoist(scope, node.Body)
+		if node.Finally != nil {
+			hoist(scope, node.Finally)
+		}
+
+	case *ast.CallExpression:
+		if node.Function.TokenLiteral() == "quote" {
+			return
+		}
+		hoist(scope, node.Function)
+		for _, argument := range node.Arguments {
+			hoist(scope, argument)
+		}
+	}
+}
+
+// 按解析的结果查找变量
+func lookupVariable(node *ast.Identifier, env *object.Environment) (object.Object, bool) {
+	switch node.Resolution {
+	case ast.Local:
+		val, scopeEnv := env.GetSlot(node.Depth, node.Slot)
+		if val != nil {
+			return val, true
+		}
+		//变量还没有定义，与按名称查找一样继续向外查找
+		if outer := scopeEnv.Outer(); outer != nil {
+			return outer.Get(node.Value)
+		}
+		return nil, false
+	case ast.Global:
+		return env.GetGlobal(node.Depth, node.Value)
+	}
+	return env.Get(node.Value)
+}
+
+// 按解析的结果给变量赋值，声明总是位于当前的作用域
+func setVariable(node *ast.Identifier, val object.Object, env *object.Environment) {
+	if node.Resolution == ast.Local {
+		env.SetSlot(node.Slot, val)
+		return
+	}
+	env.Set(node.Value, val)
+}
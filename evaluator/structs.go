@@ -0,0 +1,131 @@
+package evaluator
+
+import (
+	"TroInterpreter/ast"
+	"TroInterpreter/object"
+)
+
+// 求值struct声明，把结构体类型绑定到名称上
+func evalStructStatement(node *ast.StructStatement, env *object.Environment) object.Object {
+	def := newStructType(node)
+	if isError(def) {
+		return def
+	}
+
+	setVariable(node.Name, def, env)
+	return nil
+}
+
+// 根据struct声明创建结构体类型，每次执行声明都会创建新的类型
+func newStructType(node *ast.StructStatement) object.Object {
+	def := &object.StructType{Name: node.Name.Value}
+	for _, field := range node.Fields {
+		if def.FieldIndex(field.Value) >= 0 {
+			return newError("字段重复: %s.%s", def.Name, field.Value)
+		}
+		def.Fields = append(def.Fields, field.Value)
+	}
+	return def
+}
+
+// 创建结构体实例，参数按字段声明顺序传入
+func newStruct(def *object.StructType, args []object.Object) object.Object {
+	if len(args) != len(def.Fields) {
+		return newErrorOf(object.ARGUMENT_ERROR, "参数数量错误，期望=%d，实际=%d", len(def.Fields), len(args))
+	}
+
+	values := make([]object.Object, len(args))
+	copy(values, args)
+	return &object.Struct{Def: def, Values: values}
+}
+
+// 求值赋值表达式，修改结构体的字段
+func evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	receiver := Eval(node.Target.Object, env)
+	if isError(receiver) {
+		return receiver
+	}
+
+	val := Eval(node.Value, env)
+	if isError(val) {
+		return val
+	}
+
+	return setProperty(receiver, node.Target.Property.Value, val)
+}
+
+// 修改结构体的字段，返回赋的值
+func setProperty(receiver object.Object, name string, val object.Object) object.Object {
+	instance, ok := receiver.(*object.Struct)
+	if !ok {
+		return newErrorOf(object.TYPE_ERROR, "不能给 %s 的属性赋值", receiver.Type())
+	}
+	if !instance.Set(name, val) {
+		return newErrorOf(object.NAME_ERROR, "%s 没有字段 %s", instance.Def.Name, name)
+	}
+
+	return val
+}
+
+// 判断两个对象是否相等，结构体和变体按字段逐个比较
+func objectsEqual(left, right object.Object) bool {
+	return equal(left, right, nil)
+}
+
+// 结构体的字段可以指向自己，comparing记录正在比较的结构体对，再次遇到时认为相等，由其余字段决定结果
+func equal(left, right object.Object, comparing map[[2]*object.Struct]bool) bool {
+	switch left := left.(type) {
+	case *object.Integer:
+		r, ok := right.(*object.Integer)
+		return ok && left.Value == r.Value
+	case *object.BigInteger:
+		r, ok := right.(*object.BigInteger)
+		return ok && left.Value.Cmp(r.Value) == 0
+	case *object.String:
+		r, ok := right.(*object.String)
+		return ok && left.Value == r.Value
+	case *object.Array:
+		r, ok := right.(*object.Array)
+		if !ok || len(left.Elements) != len(r.Elements) {
+			return false
+		}
+		for i := range left.Elements {
+			if !equal(left.Elements[i], r.Elements[i], comparing) {
+				return false
+			}
+		}
+		return true
+	case *object.Struct:
+		r, ok := right.(*object.Struct)
+		if !ok || left.Def != r.Def {
+			return false
+		}
+		pair := [2]*object.Struct{left, r}
+		if left == r || comparing[pair] {
+			return true
+		}
+		if comparing == nil {
+			comparing = map[[2]*object.Struct]bool{}
+		}
+		comparing[pair] = true
+		for i := range left.Values {
+			if !equal(left.Field(i), r.Field(i), comparing) {
+				return false
+			}
+		}
+		return true
+	case *object.Variant:
+		r, ok := right.(*object.Variant)
+		if !ok || left.Def != r.Def {
+			return false
+		}
+		for i := range left.Values {
+			if !equal(left.Values[i], r.Values[i], comparing) {
+				return false
+			}
+		}
+		return true
+	default:
+		return left == right
+	}
+}
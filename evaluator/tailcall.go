@@ -0,0 +1,96 @@
+package evaluator
+
+import (
+	"TroInterpreter/ast"
+	"TroInterpreter/object"
+)
+
+// 求值函数体，尾部位置的调用返回TailCall而不是立即执行
+// 尾部位置：return的值、函数体最后一个表达式，以及if分支中处于这些位置的表达式
+func evalFunctionBody(body *ast.BlockStatement, env *object.Environment) object.Object {
+	return evalTailBlock(body, env, true)
+}
+
+// 求值函数体中的块，last表示块的值是否就是函数的返回值
+func evalTailBlock(block *ast.BlockStatement, env *object.Environment, last bool) object.Object {
+	var result object.Object
+
+	for i, statement := range block.Statements {
+		result = evalTailStatement(statement, env, last && i == len(block.Statements)-1)
+
+		if result != nil {
+			if result.Type() == object.RETRUN_VALUE_OBJ || result.Type() == object.ERROR_OBJ {
+				return result
+			}
+		}
+	}
+
+	return result
+}
+
+// 求值函数体中的语句，return总是处于尾部位置，表达式只有在last时才处于尾部位置
+func evalTailStatement(statement ast.Statement, env *object.Environment, last bool) object.Object {
+	switch statement := statement.(type) {
+	case *ast.ReturnStatement:
+		val := evalTailExpression(statement.ReturnValue, env, true)
+		if isError(val) {
+			return val
+		}
+		return &object.ReturnValue{Value: val}
+
+	case *ast.ExpressionStatement:
+		return evalTailExpression(statement.Expression, env, last)
+	}
+	return Eval(statement, env)
+}
+
+// 求值函数体中的表达式，tail时调用会返回TailCall
+func evalTailExpression(exp ast.Expression, env *object.Environment, tail bool) object.Object {
+	switch exp := exp.(type) {
+	case *ast.IfExpression:
+		//分支中的return仍然处于尾部位置
+		condition := Eval(exp.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if isTruthy(condition) {
+			return evalTailBlock(exp.Consequence, env, tail)
+		} else if exp.Alternative != nil {
+			return evalTailBlock(exp.Alternative, env, tail)
+		}
+		return NULL
+
+	case *ast.CallExpression:
+		if tail && isTailCall(exp) {
+			return evalTailCall(exp, env)
+		}
+	}
+	return Eval(exp, env)
+}
+
+// quote和方法调用不做尾调用优化
+func isTailCall(call *ast.CallExpression) bool {
+	if call.Function.TokenLiteral() == "quote" {
+		return false
+	}
+	_, isMethod := call.Function.(*ast.PropertyExpression)
+	return !isMethod
+}
+
+// 求值被调用的函数和参数，生成替换当前调用帧的尾调用
+func evalTailCall(call *ast.CallExpression, env *object.Environment) object.Object {
+	function := Eval(call.Function, env)
+	if isError(function) {
+		return function
+	}
+	args := evalExpressions(call.Arguments, env)
+	if len(args) == 1 && isError(args[0]) {
+		return args[0]
+	}
+
+	frame := newFrame(call, env)
+	if caller := env.Frame(); caller != nil {
+		frame.Caller, frame.Depth, frame.TailCalls = caller.Caller, caller.Depth, caller.TailCalls+1
+	}
+	return &object.TailCall{Function: function, Args: args, Frame: frame}
+}
@@ -0,0 +1,28 @@
+package evaluator
+
+import (
+	"TroInterpreter/ast"
+	"TroInterpreter/object"
+)
+
+// 求值spawn表达式：在当前任务中求值函数和参数，在新的任务中调用函数，返回任务
+// 任务与创建者共享函数的环境，并发读写变量和结构体字段是安全的，但不保证先后顺序
+func evalSpawnExpression(node *ast.SpawnExpression, env *object.Environment) object.Object {
+	function, args := evalCallee(node.Call, env)
+	if isError(function) {
+		return function
+	}
+
+	//被调用的函数之外是标记任务边界的spawn帧，任务中的yield不会越过它
+	frame := newFrame(node.Call, env)
+	task := &object.Frame{Function: "spawn", Line: frame.Line, Column: frame.Column, Caller: frame.Caller, Depth: frame.Depth, Task: true}
+	frame.Caller, frame.Depth = task, task.Depth+1
+	return object.NewTask(frame.Function, env.Runtime(), func() object.Object {
+		result := applyFunction(function, args, frame, env)
+		//函数体之外的错误(参数、返回类型)没有经过Eval记录位置，记录在spawn的调用处
+		if err, ok := result.(*object.Error); ok && err.Line == 0 && err.Stack == nil {
+			err.Line, err.Column, err.Stack = frame.Line, frame.Column, frame.Caller
+		}
+		return result
+	})
+}
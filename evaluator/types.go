@@ -0,0 +1,94 @@
+package evaluator
+
+import (
+	"TroInterpreter/ast"
+	"TroInterpreter/object"
+	"strings"
+)
+
+// 类型注解中内置的类型名
+var builtinTypes = map[string]bool{
+	"int":       true,
+	"string":    true,
+	"bool":      true,
+	"array":     true,
+	"fn":        true,
+	"null":      true,
+	"any":       true,
+	"generator": true,
+	"channel":   true,
+	"task":      true,
+}
+
+// IsBuiltinType 判断name是不是内置的类型名，其余的类型名是结构体或枚举
+func IsBuiltinType(name string) bool {
+	return builtinTypes[name]
+}
+
+// TypeOf 返回值在类型注解中的类型名：int、string、bool、array、fn、null、generator、channel、task，
+// 结构体实例为结构体名，变体为枚举名，其他的值为小写的对象类型
+func TypeOf(obj object.Object) string {
+	switch obj := obj.(type) {
+	case *object.Integer, *object.BigInteger:
+		return "int"
+	case *object.String:
+		return "string"
+	case *object.Boolean:
+		return "bool"
+	case *object.Array:
+		return "array"
+	case *object.Null:
+		return "null"
+	case *object.Function, *object.Closure, *object.Builtin:
+		return "fn"
+	case *object.Struct:
+		return obj.Def.Name
+	case *object.Variant:
+		return obj.Def.Enum.Name
+	default:
+		return strings.ToLower(string(obj.Type()))
+	}
+}
+
+// 判断值是否符合类型注解，any符合所有的值
+func matchesType(t *ast.TypeName, obj object.Object) bool {
+	return t.Name == "any" || TypeOf(obj) == t.Name
+}
+
+// CheckArguments 检查实参的个数和类型注解：实参少于形参时报错，多余的实参被忽略；没有注解的参数不检查类型
+func CheckArguments(parameters []*ast.Identifier, args []object.Object) *object.Error {
+	if len(args) < len(parameters) {
+		return newErrorOf(object.ARGUMENT_ERROR, "参数数量错误，期望=%d，实际=%d", len(parameters), len(args))
+	}
+	for i, param := range parameters {
+		if param.Type == nil {
+			continue
+		}
+		if !matchesType(param.Type, args[i]) {
+			return newErrorOf(object.TYPE_ERROR, "参数 %s 类型错误，期望=%s，实际=%s", param.Value, param.Type.Name, TypeOf(args[i]))
+		}
+	}
+	return nil
+}
+
+// CheckResult 检查返回值是否符合返回类型注解，returnType为nil时不检查
+func CheckResult(returnType *ast.TypeName, val object.Object) *object.Error {
+	if returnType == nil || matchesType(returnType, val) {
+		return nil
+	}
+	return newErrorOf(object.TYPE_ERROR, "返回值类型错误，期望=%s，实际=%s", returnType.Name, TypeOf(val))
+}
+
+// AddReturnType 把尾调用替换掉的函数的返回类型加入pending，被调用函数的返回值也要符合它，
+// 同名的类型只记录一次，尾递归不会使pending增长
+func AddReturnType(pending []*ast.TypeName, returnType *ast.TypeName) []*ast.TypeName {
+	if returnType == nil || returnType.Name == "any" {
+		return pending
+	}
+	for _, t := range pending {
+		if t.Name == returnType.Name {
+			return pending
+		}
+	}
+	return append(pending, returnType)
+}
@@ -0,0 +1,588 @@
+package formatter
+
+import (
+	"TroInterpreter/ast"
+	"TroInterpreter/lexer"
+	"TroInterpreter/parser"
+	"TroInterpreter/token"
+	"bytes"
+	"errors"
+	"strings"
+)
+
+const indent = "\t"
+
+// 源码位置
+type position struct {
+	line   int
+	column int
+}
+
+func posOf(tok token.Token) position {
+	return position{line: tok.Line, column: tok.Column}
+}
+
+func (p position) before(o position) bool {
+	return p.line < o.line || p.line == o.line && p.column < o.column
+}
+
+// 格式化器
+type formatter struct {
+	out      bytes.Buffer
+	depth    int                   //缩进层数
+	tokens   []token.Token         //源码中所有的token，不含注释
+	comments []token.Token         //源码中所有的注释
+	next     int                   //下一个还没输出的注释
+	closing  map[position]position //每个左括号对应的右括号
+}
+
+// Format 把源码格式化为统一的风格，源码有语法错误时返回错误
+func Format(source string) (string, error) {
+	l := lexer.New(source)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return "", errors.New(strings.Join(p.Errors(), "\n"))
+	}
+
+	f := &formatter{comments: l.Comments(), closing: map[position]position{}}
+	f.scanTokens(source)
+	f.program(program)
+
+	return f.out.String(), nil
+}
+
+// 重新扫描一遍源码，记录所有token和每个左括号对应的右括号
+func (f *formatter) scanTokens(source string) {
+	l := lexer.New(source)
+	var open []position
+	for {
+		tok := l.NextToken()
+		if tok.Type == token.EOF {
+			f.tokens = append(f.tokens, tok)
+			break
+		}
+		f.tokens = append(f.tokens, tok)
+
+		switch tok.Type {
+		case token.LBRACE, token.LPAREN, token.LBRACKET:
+			open = append(open, posOf(tok))
+		case token.RBRACE, token.RPAREN, token.RBRACKET:
+			if len(open) > 0 {
+				f.closing[open[len(open)-1]] = posOf(tok)
+				open = open[:len(open)-1]
+			}
+		}
+	}
+}
+
+// 左括号对应的右括号，找不到时返回源码结尾
+func (f *formatter) closingOf(open position) position {
+	if end, ok := f.closing[open]; ok {
+		return end
+	}
+	return posOf(f.tokens[len(f.tokens)-1])
+}
+
+// 位置之前的最后一个token的下标
+func (f *formatter) tokenBefore(pos position) int {
+	index := -1
+	for i, tok := range f.tokens {
+		if !posOf(tok).before(pos) {
+			break
+		}
+		index = i
+	}
+	return index
+}
+
+// 位置之前的最后一个token所在行
+func (f *formatter) lastLineBefore(pos position) int {
+	line := 0
+	for _, tok := range f.tokens {
+		if !posOf(tok).before(pos) {
+			break
+		}
+		line = tok.Line
+	}
+	return line
+}
+
+// 源码中pos之前的最后一个token与pos之间是否有空行
+func (f *formatter) blankLineBefore(pos position) bool {
+	start := pos
+	if f.next < len(f.comments) && posOf(f.comments[f.next]).before(pos) {
+		start = posOf(f.comments[f.next])
+	}
+	last := f.lastLineBefore(start)
+	return last != 0 && start.line-last > 1
+}
+
+func (f *formatter) write(s string) {
+	f.out.WriteString(s)
+}
+
+func (f *formatter) newline() {
+	f.write("\n")
+	f.write(strings.Repeat(indent, f.depth))
+}
+
+// 输出pos之前所有还没输出的注释，每个注释独占一行
+func (f *formatter) commentsBefore(pos position) {
+	for f.next < len(f.comments) && posOf(f.comments[f.next]).before(pos) {
+		comment := f.comments[f.next]
+		f.write(strings.TrimRight(comment.Literal, " \t\r"))
+		f.next++
+
+		//保留注释后的空行
+		following := pos
+		if f.next < len(f.comments) && posOf(f.comments[f.next]).before(pos) {
+			following = posOf(f.comments[f.next])
+		}
+		if following.line-comment.Line > 1 {
+			f.write("\n")
+		}
+		f.newline()
+	}
+}
+
+// 输出与上一个语句结尾同一行的注释
+func (f *formatter) trailingComment(end position) {
+	if f.next >= len(f.comments) {
+		return
+	}
+	comment := f.comments[f.next]
+	if comment.Line == f.lastLineBefore(posOf(comment)) && posOf(comment).before(end) {
+		f.write(" ")
+		f.write(strings.TrimRight(comment.Literal, " \t\r"))
+		f.next++
+	}
+}
+
+// 程序
+func (f *formatter) program(program *ast.Program) {
+	end := posOf(f.tokens[len(f.tokens)-1])
+	f.statements(program.Statements, end)
+	f.commentsAfter(end)
+	if f.out.Len() > 0 {
+		f.write("\n")
+	}
+}
+
+// 输出end之前剩余的注释，位于最后一个语句之后
+func (f *formatter) commentsAfter(end position) {
+	for f.next < len(f.comments) && posOf(f.comments[f.next]).before(end) {
+		comment := f.comments[f.next]
+		if f.out.Len() > 0 {
+			//与语句之间一样，保留注释前的空行
+			previous := f.lastLineBefore(posOf(comment))
+			if f.next > 0 && f.comments[f.next-1].Line > previous {
+				previous = f.comments[f.next-1].Line
+			}
+			if previous != 0 && comment.Line-previous > 1 {
+				f.write("\n")
+			}
+			f.newline()
+		}
+		f.write(strings.TrimRight(comment.Literal, " \t\r"))
+		f.next++
+	}
+}
+
+// 语句列表，end为列表结束的位置
+func (f *formatter) statements(statements []ast.Statement, end position) {
+	for i, stmt := range statements {
+		start := statementStart(stmt)
+		if i > 0 {
+			if f.blankLineBefore(start) {
+				f.write("\n")
+			}
+			f.newline()
+		}
+		f.commentsBefore(start)
+		f.statement(stmt)
+
+		next := end
+		if i+1 < len(statements) {
+			next = statementStart(statements[i+1])
+		}
+		f.trailingComment(next)
+	}
+}
+
+// 语句的起始位置
+func statementStart(stmt ast.Statement) position {
+	if es, ok := stmt.(*ast.ExpressionStatement); ok && es.Expression != nil {
+		return expressionStart(es.Expression)
+	}
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		return posOf(stmt.Token)
+	case *ast.ReturnStatement:
+		return posOf(stmt.Token)
+	case *ast.StructStatement:
+		return posOf(stmt.Token)
+	case *ast.EnumStatement:
+		return posOf(stmt.Token)
+	case *ast.ImportStatement:
+		return posOf(stmt.Token)
+	case *ast.ExportStatement:
+		return posOf(stmt.Token)
+	case *ast.ThrowStatement:
+		return posOf(stmt.Token)
+	case *ast.ExpressionStatement:
+		return posOf(stmt.Token)
+	}
+	return position{}
+}
+
+// 表达式的起始位置，中缀、调用、索引表达式从左侧开始
+func expressionStart(exp ast.Expression) position {
+	switch exp := exp.(type) {
+	case *ast.InfixExpression:
+		return expressionStart(exp.Left)
+	case *ast.CallExpression:
+		return expressionStart(exp.Function)
+	case *ast.IndexExpression:
+		return expressionStart(exp.Left)
+	case *ast.PropertyExpression:
+		return expressionStart(exp.Object)
+	case *ast.AssignExpression:
+		return expressionStart(exp.Target)
+	case *ast.Identifier:
+		return posOf(exp.Token)
+	case *ast.IntegerLiteral:
+		return posOf(exp.Token)
+	case *ast.StringLiteral:
+		return posOf(exp.Token)
+	case *ast.Boolean:
+		return posOf(exp.Token)
+	case *ast.ArrayLiteral:
+		return posOf(exp.Token)
+	case *ast.PrefixExpression:
+		return posOf(exp.Token)
+	case *ast.IfExpression:
+		return posOf(exp.Token)
+	case *ast.TryExpression:
+		return posOf(exp.Token)
+	case *ast.YieldExpression:
+		return posOf(exp.Token)
+	case *ast.SpawnExpression:
+		return posOf(exp.Token)
+	case *ast.FunctionExpression:
+		return posOf(exp.Token)
+	case *ast.MacroLiteral:
+		return posOf(exp.Token)
+	}
+	return position{}
+}
+
+// 语句
+func (f *formatter) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		f.write("let ")
+		f.write(stmt.Name.String())
+		f.write(" = ")
+		f.expression(stmt.Value, parser.LOWEST)
+		f.write(";")
+
+	case *ast.ReturnStatement:
+		f.write("return ")
+		f.expression(stmt.ReturnValue, parser.LOWEST)
+		f.write(";")
+
+	case *ast.ThrowStatement:
+		f.write("throw ")
+		f.expression(stmt.Value, parser.LOWEST)
+		f.write(";")
+
+	case *ast.StructStatement:
+		f.write("struct ")
+		f.write(stmt.Name.Value)
+		var fields []string
+		for _, field := range stmt.Fields {
+			fields = append(fields, field.Value)
+		}
+		if len(fields) == 0 {
+			f.write(" {}")
+		} else {
+			f.write(" { " + strings.Join(fields, ", ") + " }")
+		}
+
+	case *ast.EnumStatement:
+		f.write("enum ")
+		f.write(stmt.Name.Value)
+		var variants []string
+		for _, v := range stmt.Variants {
+			variants = append(variants, v.String())
+		}
+		if len(variants) == 0 {
+			f.write(" {}")
+		} else {
+			f.write(" { " + strings.Join(variants, ", ") + " }")
+		}
+
+	case *ast.ImportStatement:
+		f.write(stmt.String())
+
+	case *ast.ExportStatement:
+		f.write("export ")
+		f.statement(stmt.Statement)
+
+	case *ast.ExpressionStatement:
+		f.expression(stmt.Expression, parser.LOWEST)
+		switch stmt.Expression.(type) {
+		case *ast.IfExpression, *ast.TryExpression:
+		default:
+			f.write(";")
+		}
+	}
+}
+
+// 块语句，带花括号
+func (f *formatter) block(block *ast.BlockStatement) {
+	end := f.closingOf(posOf(block.Token))
+
+	hasComments := f.next < len(f.comments) && posOf(f.comments[f.next]).before(end)
+	if len(block.Statements) == 0 && !hasComments {
+		f.write("{}")
+		return
+	}
+
+	f.write("{")
+	f.depth++
+	if len(block.Statements) > 0 {
+		f.newline()
+		f.statements(block.Statements, end)
+	}
+	f.commentsAfter(end)
+	f.depth--
+	f.newline()
+	f.write("}")
+}
+
+// 表达式的优先级，用来决定是否需要加括号
+func precedenceOf(exp ast.Expression) int {
+	switch exp := exp.(type) {
+	case *ast.InfixExpression:
+		return parser.Precedence(exp.Token.Type)
+	case *ast.PrefixExpression, *ast.SpawnExpression:
+		return parser.PREFIX
+	case *ast.AssignExpression:
+		return parser.ASSIGN
+	case *ast.YieldExpression:
+		//yield之后的表达式一直延伸到结尾，作为运算数时需要加括号
+		return parser.LOWEST
+	default:
+		return parser.MEMBER + 1
+	}
+}
+
+// 表达式，parent为外层需要的最低优先级，低于它时加括号
+func (f *formatter) expression(exp ast.Expression, parent int) {
+	if precedenceOf(exp) < parent {
+		f.write("(")
+		f.expression(exp, parser.LOWEST)
+		f.write(")")
+		return
+	}
+
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		f.write(exp.Value)
+
+	case *ast.IntegerLiteral:
+		f.write(exp.Token.Literal)
+
+	case *ast.StringLiteral:
+		f.write(`"` + exp.Value + `"`)
+
+	case *ast.Boolean:
+		f.write(exp.Token.Literal)
+
+	case *ast.PrefixExpression:
+		f.write(exp.Operator)
+		f.expression(exp.Right, parser.PREFIX)
+
+	case *ast.InfixExpression:
+		precedence := parser.Precedence(exp.Token.Type)
+		f.expression(exp.Left, precedence)
+		f.write(" " + exp.Operator + " ")
+		//左结合，右侧同级也要加括号
+		f.expression(exp.Right, precedence+1)
+
+	case *ast.ArrayLiteral:
+		f.write("[")
+		f.expressionList(posOf(exp.Token), exp.Elements)
+		f.write("]")
+
+	case *ast.IndexExpression:
+		f.expression(exp.Left, parser.INDEX)
+		f.write("[")
+		f.expression(exp.Index, parser.LOWEST)
+		f.write("]")
+
+	case *ast.AssignExpression:
+		f.expression(exp.Target, parser.MEMBER)
+		f.write(" = ")
+		//右结合
+		f.expression(exp.Value, parser.ASSIGN)
+
+	case *ast.PropertyExpression:
+		f.expression(exp.Object, parser.MEMBER)
+		f.write(".")
+		f.write(exp.Property.Value)
+
+	case *ast.CallExpression:
+		f.expression(exp.Function, parser.CALL)
+		f.write("(")
+		f.expressionList(posOf(exp.Token), exp.Arguments)
+		f.write(")")
+
+	case *ast.IfExpression:
+		f.write("if (")
+		f.expression(exp.Condition, parser.LOWEST)
+		f.write(") ")
+		f.block(exp.Consequence)
+		if exp.Alternative != nil {
+			f.write(" else ")
+			f.block(exp.Alternative)
+		}
+
+	case *ast.TryExpression:
+		f.write("try ")
+		f.block(exp.Body)
+		if exp.Catch != nil {
+			f.write(" catch (" + exp.Param.Value + ") ")
+			f.block(exp.Catch)
+		}
+		if exp.Finally != nil {
+			f.write(" finally ")
+			f.block(exp.Finally)
+		}
+
+	case *ast.YieldExpression:
+		f.write("yield ")
+		f.expression(exp.Value, parser.LOWEST)
+
+	case *ast.SpawnExpression:
+		f.write("spawn ")
+		f.expression(exp.Call, parser.PREFIX)
+
+	case *ast.FunctionExpression:
+		if exp.Generator {
+			f.write("gen ")
+		}
+		f.write("fn")
+		f.parameters(posOf(exp.Token), exp.Parameters)
+		if exp.ReturnType != nil {
+			f.write("-> " + exp.ReturnType.Name + " ")
+		}
+		f.block(exp.Body)
+
+	case *ast.MacroLiteral:
+		f.write("macro")
+		f.parameters(posOf(exp.Token), exp.Parameters)
+		f.block(exp.Body)
+	}
+}
+
+// 逗号分隔的表达式列表，open为左括号的位置
+func (f *formatter) expressionList(open position, list []ast.Expression) {
+	var starts []position
+	for _, e := range list {
+		starts = append(starts, expressionStart(e))
+	}
+	f.list(open, starts, func(i int) {
+		f.expression(list[i], parser.LOWEST)
+	})
+}
+
+// 函数参数，包括类型注解，keyword为fn或macro的位置
+func (f *formatter) parameters(keyword position, params []*ast.Identifier) {
+	//参数列表从关键字之后的(开始
+	open := keyword
+	for _, tok := range f.tokens[f.tokenBefore(keyword)+1:] {
+		if tok.Type == token.LPAREN {
+			open = posOf(tok)
+			break
+		}
+	}
+
+	var starts []position
+	for _, p := range params {
+		starts = append(starts, posOf(p.Token))
+	}
+	f.write("(")
+	f.list(open, starts, func(i int) {
+		f.write(params[i].String())
+	})
+	f.write(") ")
+}
+
+// 括号内逗号分隔的列表，starts为每一项的起始位置，item输出第i项
+// 项与项之间有注释时每项独占一行，注释跟在它所在的项后面
+func (f *formatter) list(open position, starts []position, item func(i int)) {
+	end := f.closingOf(open)
+	if !f.commentsBetween(open, starts, end) {
+		for i := range starts {
+			if i != 0 {
+				f.write(", ")
+			}
+			item(i)
+		}
+		return
+	}
+
+	f.depth++
+	for i := range starts {
+		f.newline()
+		f.commentsBefore(starts[i])
+		item(i)
+
+		next := end
+		if i+1 < len(starts) {
+			f.write(",")
+			next = starts[i+1]
+		}
+		f.trailingComment(next)
+	}
+	f.commentsAfter(end)
+	f.depth--
+	f.newline()
+}
+
+// 列表的项与项之间是否有注释，项内部的注释不算
+func (f *formatter) commentsBetween(open position, starts []position, end position) bool {
+	//每一项之后的间隙从它最后一个token开始，到下一项或右括号为止
+	gaps := [][2]position{{open, end}}
+	if len(starts) > 0 {
+		gaps[0][1] = starts[0]
+	}
+	for i := range starts {
+		next := end
+		if i+1 < len(starts) {
+			next = starts[i+1]
+		}
+		last := f.tokenBefore(next)
+		if i+1 < len(starts) {
+			//跳过项之间的逗号
+			last--
+		}
+		gaps = append(gaps, [2]position{posOf(f.tokens[last]), next})
+	}
+
+	for _, comment := range f.comments[f.next:] {
+		pos := posOf(comment)
+		if !pos.before(end) {
+			break
+		}
+		for _, gap := range gaps {
+			if gap[0].before(pos) && pos.before(gap[1]) {
+				return true
+			}
+		}
+	}
+	return false
+}
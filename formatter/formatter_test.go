@@ -0,0 +1,101 @@
+package formatter
+
+import "testing"
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x=1+2*3;", "let x = 1 + 2 * 3;\n"},
+		{"let x = (1 + 2) * 3", "let x = (1 + 2) * 3;\n"},
+		{"1 - (2 - 3); (1 - 2) - 3", "1 - (2 - 3);\n1 - 2 - 3;\n"},
+		{"-(1 + 2); !(-x)", "-(1 + 2);\n!-x;\n"},
+		{"[1,2][0]; add(1,[2])", "[1, 2][0];\nadd(1, [2]);\n"},
+		{`let s="a  b"`, "let s = \"a  b\";\n"},
+		{"let f = fn(){}", "let f = fn() {};\n"},
+		{
+			"let add=fn(a,b){return a+b}",
+			"let add = fn(a, b) {\n\treturn a + b;\n};\n",
+		},
+		{
+			"if(x<y){x}else{if(true){y}}",
+			"if (x < y) {\n\tx;\n} else {\n\tif (true) {\n\t\ty;\n\t}\n}\n",
+		},
+		{
+			"let m = macro(a){quote(unquote(a))}",
+			"let m = macro(a) {\n\tquote(unquote(a));\n};\n",
+		},
+		{
+			"let a = 1;\n\n\n\nlet b = 2;\nlet c = 3;",
+			"let a = 1;\n\nlet b = 2;\nlet c = 3;\n",
+		},
+		{
+			"// header\n\nlet a = 1; // trailing\n// before b\nlet b = 2;\n// end",
+			"// header\n\nlet a = 1; // trailing\n// before b\nlet b = 2;\n// end\n",
+		},
+		{
+			"let f = fn() {\n  // inside\n  1 // one\n  // last\n};",
+			"let f = fn() {\n\t// inside\n\t1; // one\n\t// last\n};\n",
+		},
+		{
+			"let f = fn() { // only\n}",
+			"let f = fn() {\n\t// only\n};\n",
+		},
+		{"xs.push(1+2).len(); (-a).b", "xs.push(1 + 2).len();\n(-a).b;\n"},
+		{"struct Point{x,y}\nstruct E{}", "struct Point { x, y }\nstruct E {}\n"},
+		{"p.x=q.y=1+2", "p.x = q.y = 1 + 2;\n"},
+		{"enum Shape{Circle(r),Rect(w,h),Empty}", "enum Shape { Circle(r), Rect(w, h), Empty }\n"},
+		{"import \"lib.tro\" as lib\nexport let x=lib.y\nexport struct P{a}", "import \"lib.tro\" as lib;\nexport let x = lib.y;\nexport struct P { a }\n"},
+		{"try{f()}catch(e){throw e}finally{g()}\nlet x=try{1}catch(e){2}", "try {\n\tf();\n} catch (e) {\n\tthrow e;\n} finally {\n\tg();\n}\nlet x = try {\n\t1;\n} catch (e) {\n\t2;\n};\n"},
+		{"let n:int=1\nlet f=fn(a:int,b)->bool{a>b}", "let n: int = 1;\nlet f = fn(a: int, b) -> bool {\n\ta > b;\n};\n"},
+		{"let g=gen fn(n){yield n;let x=(yield n)+1;yield yield 2}", "let g = gen fn(n) {\n\tyield n;\n\tlet x = (yield n) + 1;\n\tyield yield 2;\n};\n"},
+		{"let t=spawn f(1)\nwait(spawn ch.send(2)).len()+(spawn g()).wait()", "let t = spawn f(1);\nwait(spawn ch.send(2)).len() + (spawn g()).wait();\n"},
+		{
+			"let xs = [\n  1, // one\n  // before two\n  2 // two\n];",
+			"let xs = [\n\t1, // one\n\t// before two\n\t2 // two\n];\n",
+		},
+		{
+			"let f = fn(a, // first\n  b: int // second\n) { a }\nf(1, // x\n  2)",
+			"let f = fn(\n\ta, // first\n\tb: int // second\n) {\n\ta;\n};\nf(\n\t1, // x\n\t2\n);\n",
+		},
+		{
+			"g(fn(x) {\n  // body\n  x\n}, 2); let e = [ // empty\n]",
+			"g(fn(x) {\n\t// body\n\tx;\n}, 2);\nlet e = [\n\t// empty\n];\n",
+		},
+		{"x\n\n// end", "x;\n\n// end\n"},
+		{
+			"let f = fn() {\n  1\n\n\n  // last\n  // more\n\n  // again\n};\n// after\n\n\n// end",
+			"let f = fn() {\n\t1;\n\n\t// last\n\t// more\n\n\t// again\n};\n// after\n\n// end\n",
+		},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		formatted, err := Format(tt.input)
+		if err != nil {
+			t.Errorf("Format(%q) returned error: %s", tt.input, err)
+			continue
+		}
+		if formatted != tt.expected {
+			t.Errorf("Format(%q) wrong.\nwant=%q\ngot= %q", tt.input, tt.expected, formatted)
+			continue
+		}
+
+		again, err := Format(formatted)
+		if err != nil {
+			t.Errorf("Format(%q) returned error: %s", formatted, err)
+			continue
+		}
+		if again != formatted {
+			t.Errorf("Format is not idempotent.\nfirst= %q\nsecond=%q", formatted, again)
+		}
+	}
+}
+
+func TestFormatParseError(t *testing.T) {
+	_, err := Format("let = 1;")
+	if err == nil {
+		t.Fatalf("expected parse error, got none")
+	}
+}
@@ -9,9 +9,25 @@ type Lexer struct {
 	position     int    //字符在输入中的位置
 	readPosition int    //下一个字符位置
 	ch           byte   //当前字符
+	line         int    //当前字符所在行
+	column       int    //当前字符所在列
+
+	comments []token.Token //跳过的注释
+}
+
+// Comments 返回目前为止跳过的注释，格式化等工具使用
+func (l *Lexer) Comments() []token.Token {
+	return l.comments
 }
 
 func (l *Lexer) readChar() {
+	//更新行列号
+	if l.ch == '\n' {
+		l.line += 1
+		l.column = 0
+	}
+	l.column += 1
+
 	//读取指针更新
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
@@ -57,6 +73,20 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
+func (l *Lexer) skipComments() {
+	//跳过//开头的注释，记录下来
+	for l.ch == '/' && l.peekChar() == '/' {
+		tok := token.Token{Type: token.COMMENT, Line: l.line, Column: l.column}
+		position := l.position
+		for l.ch != '\n' && l.ch != 0 {
+			l.readChar()
+		}
+		tok.Literal = l.input[position:l.position]
+		l.comments = append(l.comments, tok)
+		l.skipWhitespace()
+	}
+}
+
 func (l *Lexer) readString() string {
 	//读取字符串
 	position := l.position + 1
@@ -71,6 +101,10 @@ func (l *Lexer) readString() string {
 
 func (l *Lexer) NextToken() token.Token {
 	l.skipWhitespace() //跳过空白字符
+	l.skipComments()   //跳过注释
+
+	//记录token起始位置
+	line, column := l.line, l.column
 
 	//根据字符返回不同的token，并且读取指针前移
 	var tok token.Token
@@ -103,6 +137,10 @@ func (l *Lexer) NextToken() token.Token {
 		tok = token.Token{Type: token.RPAREN, Literal: string(l.ch)}
 	case ',':
 		tok = token.Token{Type: token.COMMA, Literal: string(l.ch)}
+	case '.':
+		tok = token.Token{Type: token.DOT, Literal: string(l.ch)}
+	case ':':
+		tok = token.Token{Type: token.COLON, Literal: string(l.ch)}
 	case '{':
 		tok = token.Token{Type: token.LBRACE, Literal: string(l.ch)}
 	case '}':
@@ -119,7 +157,12 @@ func (l *Lexer) NextToken() token.Token {
 	case '+':
 		tok = token.Token{Type: token.PLUS, Literal: string(l.ch)}
 	case '-':
-		tok = token.Token{Type: token.MINUS, Literal: string(l.ch)}
+		if l.peekChar() == '>' {
+			l.readChar()
+			tok = token.Token{Type: token.ARROW, Literal: "->"}
+		} else {
+			tok = token.Token{Type: token.MINUS, Literal: string(l.ch)}
+		}
 	case '*':
 		tok = token.Token{Type: token.ASTER, Literal: string(l.ch)}
 	case '/':
@@ -134,16 +177,19 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()          //读取标识符
 			tok.Type = token.LookupIdent(tok.Literal) //根据标识符返回对应的token类型
-			return tok                                //跳过readChar()
+			tok.Line, tok.Column = line, column
+			return tok //跳过readChar()
 		} else if isNumber(l.ch) {
 			tok.Type = token.NUMBER
 			tok.Literal = l.readNumberIdentifier()
+			tok.Line, tok.Column = line, column
 			return tok
 		} else {
 			tok.Type = token.ILLEGAL
 			tok.Literal = string(l.ch)
 		}
 	}
+	tok.Line, tok.Column = line, column
 	l.readChar()
 	return tok
 }
@@ -31,6 +31,8 @@ if (5 < 10) {
 "hi"
 
 [1, 2]
+fn(a: int) -> bool
+gen yield spawn
 `
 	tests := []struct {
 		expectedType    token.TypeToken
@@ -116,6 +118,17 @@ if (5 < 10) {
 		{token.COMMA, ","},
 		{token.NUMBER, "2"},
 		{token.RBRACKET, "]"},
+		{token.FUNCTION, "fn"},
+		{token.LPAREN, "("},
+		{token.IDENT, "a"},
+		{token.COLON, ":"},
+		{token.IDENT, "int"},
+		{token.RPAREN, ")"},
+		{token.ARROW, "->"},
+		{token.IDENT, "bool"},
+		{token.GEN, "gen"},
+		{token.YIELD, "yield"},
+		{token.SPAWN, "spawn"},
 		{token.EOF, ""},
 	}
 	l := New(input)
@@ -134,3 +147,81 @@ if (5 < 10) {
 		}
 	}
 }
+
+func TestNextTokenPosition(t *testing.T) {
+	input := `let x = 5;
+  if (x) {
+	"a b" }`
+
+	tests := []struct {
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{"let", 1, 1},
+		{"x", 1, 5},
+		{"=", 1, 7},
+		{"5", 1, 9},
+		{";", 1, 10},
+		{"if", 2, 3},
+		{"(", 2, 6},
+		{"x", 2, 7},
+		{")", 2, 8},
+		{"{", 2, 10},
+		{"a b", 3, 2},
+		{"}", 3, 8},
+		{"", 3, 9},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+}
+
+func TestNextTokenComments(t *testing.T) {
+	input := `// leading
+let x = 5; // trailing
+//last`
+
+	expectedTypes := []token.TypeToken{
+		token.LET, token.IDENT, token.ASSIGN, token.NUMBER, token.SEMICOLON, token.EOF,
+	}
+
+	l := New(input)
+	for i, expected := range expectedTypes {
+		tok := l.NextToken()
+		if tok.Type != expected {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, expected, tok.Type)
+		}
+	}
+
+	expectedComments := []token.Token{
+		{Type: token.COMMENT, Literal: "// leading", Line: 1, Column: 1},
+		{Type: token.COMMENT, Literal: "// trailing", Line: 2, Column: 12},
+		{Type: token.COMMENT, Literal: "//last", Line: 3, Column: 1},
+	}
+
+	comments := l.Comments()
+	if len(comments) != len(expectedComments) {
+		t.Fatalf("wrong number of comments. expected=%d, got=%d",
+			len(expectedComments), len(comments))
+	}
+	for i, expected := range expectedComments {
+		if comments[i] != expected {
+			t.Errorf("comments[%d] wrong. expected=%+v, got=%+v", i, expected, comments[i])
+		}
+	}
+}
@@ -1,11 +1,276 @@
 package main
 
 import (
+	"TroInterpreter/ast"
+	"TroInterpreter/compiler"
+	"TroInterpreter/evaluator"
+	"TroInterpreter/formatter"
+	"TroInterpreter/lexer"
+	"TroInterpreter/object"
+	"TroInterpreter/parser"
 	"TroInterpreter/repl"
+	"TroInterpreter/typecheck"
+	"TroInterpreter/vet"
+	"TroInterpreter/vm"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
 func main() {
+	if len(os.Args) < 2 || strings.HasPrefix(os.Args[1], "-") {
+		os.Exit(runREPL(os.Args[1:]))
+	}
+
+	switch os.Args[1] {
+	case "run":
+		os.Exit(runFile(os.Args[2:]))
+	case "ast":
+		os.Exit(runAST(os.Args[2:]))
+	case "fmt":
+		os.Exit(runFmt(os.Args[2:]))
+	case "vet":
+		os.Exit(runVet(os.Args[2:]))
+	default:
+		fmt.Fprintf(os.Stderr, "未知的命令 %q\n", os.Args[1])
+		os.Exit(2)
+	}
+}
+
+// tro [--vm]：启动REPL
+func runREPL(args []string) int {
+	flags := flag.NewFlagSet("tro", flag.ContinueOnError)
+	useVM := flags.Bool("vm", false, "编译为字节码在虚拟机中执行")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
 	println("欢迎使用Tro，调用help()查看更多信息")
-	repl.Start(os.Stdin, os.Stdout)
+	if *useVM {
+		repl.StartVM(os.Stdin, os.Stdout)
+	} else {
+		repl.Start(os.Stdin, os.Stdout)
+	}
+	return 0
+}
+
+// tro run [选项] 文件：运行程序，选项见 tro run -h：运行程序，出错时输出错误与调用栈并返回1
+func runFile(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	overflow := flags.String("overflow", "promote", "整数溢出时的处理方式：promote转为大整数，error报错，wrap按补码回绕")
+	maxDepth := flags.Int("max-depth", object.DEFAULT_MAX_DEPTH, "最大调用深度，小于等于0时不限制")
+	maxTailCalls := flags.Int("max-tail-calls", object.DEFAULT_MAX_TAIL_CALLS, "同一个调用帧上连续尾调用的最大次数，小于等于0时不限制")
+	maxSteps := flags.Int64("max-steps", 0, "最多执行的步数(函数调用次数)，0表示不限制")
+	timeout := flags.Duration("timeout", 0, "最长运行时间，如 2s，0表示不限制")
+	useVM := flags.Bool("vm", false, "编译为字节码在虚拟机中执行")
+	optimize := flags.Bool("optimize", false, "运行前折叠常量、删除不会执行的代码")
+	var limits object.Limits
+	flags.Int64Var(&limits.MaxAllocation, "max-alloc", 0, "累计分配的数组元素与字符串字节总数，0表示不限制")
+	flags.IntVar(&limits.MaxStringLength, "max-string", 0, "字符串的最大字节数，0表示不限制")
+	flags.IntVar(&limits.MaxArrayLength, "max-array", 0, "数组的最大长度，0表示不限制")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	args = flags.Args()
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "用法: tro run [选项] 文件")
+		flags.PrintDefaults()
+		return 2
+	}
+
+	var mode object.OverflowMode
+	switch *overflow {
+	case "promote":
+		mode = object.OVERFLOW_PROMOTE
+	case "error":
+		mode = object.OVERFLOW_ERROR
+	case "wrap":
+		mode = object.OVERFLOW_WRAP
+	default:
+		fmt.Fprintf(os.Stderr, "未知的溢出处理方式 %q\n", *overflow)
+		return 2
+	}
+
+	input, err := os.ReadFile(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	p := parser.New(lexer.New(string(input)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		for _, msg := range p.Errors() {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", args[0], msg)
+		}
+		return 1
+	}
+
+	path, err := filepath.Abs(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	env := object.NewEnvironment()
+	env.SetFile(path)
+	env.Runtime().SearchPath = evaluator.DefaultSearchPath()
+	env.Runtime().Overflow = mode
+	env.Runtime().MaxDepth = *maxDepth
+	env.Runtime().MaxTailCalls = *maxTailCalls
+	env.Runtime().Limits = limits
+	env.Runtime().Optimize = *optimize
+
+	macroEnv := object.NewEnvironment()
+	evaluator.DefineMacros(program, macroEnv)
+	expanded, err := evaluator.ExpandMacros(program, macroEnv)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", args[0], err)
+		return 1
+	}
+	if errs := typecheck.Check(expanded.(*ast.Program)); len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "%s:%s\n", args[0], err)
+		}
+		return 1
+	}
+	if *optimize {
+		expanded = evaluator.Optimize(expanded.(*ast.Program))
+	}
+
+	budget := evaluator.Budget{Steps: *maxSteps}
+	if *timeout > 0 {
+		budget.Deadline = time.Now().Add(*timeout)
+	}
+
+	var result object.Object
+	if *useVM {
+		c := compiler.New()
+		if err := c.Compile(expanded.(*ast.Program)); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", args[0], err)
+			return 1
+		}
+		result = vm.New(c.Bytecode(), env).RunContext(context.Background(), budget)
+	} else {
+		result = evaluator.EvalContext(context.Background(), evaluator.Resolve(expanded.(*ast.Program)), env, budget)
+	}
+	if err, ok := result.(*object.Error); ok {
+		fmt.Fprintln(os.Stderr, err.Traceback())
+		return 1
+	}
+	return 0
+}
+
+// tro ast 文件：把程序的ast以json格式输出
+func runAST(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "用法: tro ast 文件")
+		return 2
+	}
+
+	input, err := os.ReadFile(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	p := parser.New(lexer.New(string(input)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		for _, msg := range p.Errors() {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", args[0], msg)
+		}
+		return 1
+	}
+
+	data, err := ast.EncodeJSON(program)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	var out bytes.Buffer
+	json.Indent(&out, data, "", "  ")
+	out.WriteString("\n")
+	out.WriteTo(os.Stdout)
+	return 0
+}
+
+// tro fmt [--check] 文件...：输出格式化后的源码，--check时只检查，有未格式化的文件返回1
+func runFmt(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	check := flags.Bool("check", false, "只检查文件是否已格式化，列出未格式化的文件")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "用法: tro fmt [--check] 文件...")
+		return 2
+	}
+
+	status := 0
+	for _, name := range flags.Args() {
+		input, err := os.ReadFile(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+			continue
+		}
+
+		formatted, err := formatter.Format(string(input))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+			status = 1
+			continue
+		}
+
+		if *check {
+			if formatted != string(input) {
+				fmt.Println(name)
+				status = 1
+			}
+			continue
+		}
+		os.Stdout.WriteString(formatted)
+	}
+	return status
+}
+
+// tro vet 文件...：静态检查程序，按 文件:行:列: 问题 输出，发现问题时返回1
+func runVet(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "用法: tro vet 文件...")
+		return 2
+	}
+
+	status := 0
+	for _, name := range args {
+		input, err := os.ReadFile(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+			continue
+		}
+
+		p := parser.New(lexer.New(string(input)))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			for _, msg := range p.Errors() {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", name, msg)
+			}
+			status = 1
+			continue
+		}
+
+		for _, d := range vet.Check(program) {
+			fmt.Printf("%s:%s\n", name, d)
+			status = 1
+		}
+	}
+	return status
 }
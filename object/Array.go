@@ -11,11 +11,15 @@ type Array struct {
 
 func (ao *Array) Type() TypeObject { return ARRAY_OBJ }
 func (ao *Array) Inspect() string {
+	return inspect(ao, nil)
+}
+
+func (ao *Array) format(element func(Object) string) string {
 	var out bytes.Buffer
 
 	elements := []string{}
 	for _, e := range ao.Elements {
-		elements = append(elements, e.Inspect())
+		elements = append(elements, element(e))
 	}
 
 	out.WriteString("[")
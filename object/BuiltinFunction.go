@@ -3,7 +3,12 @@ package object
 type BuiltInFunction func(args ...Object) Object
 
 type Builtin struct {
-	Fn BuiltInFunction
+	Fn      BuiltInFunction
+	MinArgs int // 最少的参数个数
+	MaxArgs int // 最多的参数个数，小于0时不限制
+
+	// 会阻塞的内置函数(通道、等待任务)，不为nil时代替Fn调用，阻塞时响应运行时的上下文
+	Blocking func(runtime *Runtime, args ...Object) Object
 }
 
 func (b *Builtin) Type() TypeObject {
@@ -0,0 +1,181 @@
+package object
+
+import (
+	"reflect"
+	"sync"
+)
+
+// 通道，用于spawn的任务之间传递值，容量为0时发送方等待接收方
+// 关闭后不能再发送，缓冲中剩余的值仍然可以被接收，之后接收返回ChannelClosed错误
+type Channel struct {
+	values chan Object   // 不会被关闭，避免关闭时正在发送的任务panic
+	closed chan struct{} // 通道关闭时被关闭
+
+	mu       sync.Mutex
+	isClosed bool
+}
+
+func NewChannel(size int) *Channel {
+	return &Channel{values: make(chan Object, size), closed: make(chan struct{})}
+}
+
+func (c *Channel) Type() TypeObject { return CHANNEL_OBJ }
+func (c *Channel) Inspect() string {
+	return "channel"
+}
+
+// Send 发送值，缓冲已满或没有接收方时等待；通道已经关闭时返回ChannelClosed错误，
+// 所有任务都在等待时返回DeadlockError，等待时运行时的上下文结束则返回中断求值的错误
+func (c *Channel) Send(val Object, runtime *Runtime) *Error {
+	//已经关闭时即使缓冲未满也不能发送
+	select {
+	case <-c.closed:
+		return c.closedError()
+	default:
+	}
+	select {
+	case c.values <- val:
+		return nil
+	default:
+	}
+
+	deadlock, done := runtime.wait()
+	defer done()
+	for {
+		select {
+		case <-c.closed:
+			return c.closedError()
+		case c.values <- val:
+			return nil
+		case <-deadlock:
+			return deadlockError()
+		case <-runtime.Done():
+			if err := runtime.Check(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Receive 接收值，没有值时等待；通道已经关闭并且缓冲为空时返回ChannelClosed错误，
+// 所有任务都在等待时返回DeadlockError，等待时运行时的上下文结束则返回中断求值的错误
+func (c *Channel) Receive(runtime *Runtime) (Object, *Error) {
+	select {
+	case val := <-c.values:
+		return val, nil
+	case <-c.closed:
+		return c.drain()
+	default:
+	}
+
+	deadlock, done := runtime.wait()
+	defer done()
+	for {
+		select {
+		case val := <-c.values:
+			return val, nil
+		case <-c.closed:
+			return c.drain()
+		case <-deadlock:
+			return nil, deadlockError()
+		case <-runtime.Done():
+			if err := runtime.Check(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// 从已经关闭的通道中取出缓冲中剩余的值
+func (c *Channel) drain() (Object, *Error) {
+	select {
+	case val := <-c.values:
+		return val, nil
+	default:
+		return nil, c.closedError()
+	}
+}
+
+// Close 关闭通道，等待接收的任务会收到ChannelClosed错误，已经关闭时返回错误
+func (c *Channel) Close() *Error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.isClosed {
+		return &Error{Message: "通道已经关闭", Kind: CHANNEL_CLOSED}
+	}
+	c.isClosed = true
+	close(c.closed)
+	return nil
+}
+
+func (c *Channel) closedError() *Error {
+	return &Error{Message: "通道已经关闭", Kind: CHANNEL_CLOSED}
+}
+
+func deadlockError() *Error {
+	return &Error{Message: "死锁: 所有任务都在等待", Kind: DEADLOCK_ERROR}
+}
+
+// Select 从多个通道中接收先到达的值，返回通道的下标和值；block为false时没有值立即返回下标-1
+// 所有通道都已经关闭并且缓冲为空时返回ChannelClosed错误，所有任务都在等待时返回DeadlockError，
+// 等待时运行时的上下文结束则返回中断求值的错误
+func Select(channels []*Channel, block bool, runtime *Runtime) (int, Object, *Error) {
+	closed := make([]bool, len(channels))
+	//先不等待地尝试一次，确实需要等待时才参与死锁检测
+	if block {
+		if i, val, err := Select(channels, false, runtime); i >= 0 || err != nil {
+			return i, val, err
+		}
+	}
+	var deadlock <-chan struct{}
+	if block {
+		var done func()
+		deadlock, done = runtime.wait()
+		defer done()
+	}
+	for {
+		//每个未关闭的通道等待值和关闭两种情况，已经关闭的通道只取缓冲中剩余的值
+		var cases []reflect.SelectCase
+		var index []int
+		open := 0
+		for i, c := range channels {
+			if closed[i] {
+				if val, err := c.drain(); err == nil {
+					return i, val, nil
+				}
+				continue
+			}
+			open++
+			cases = append(cases,
+				reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.values)},
+				reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.closed)})
+			index = append(index, i, i)
+		}
+		if open == 0 {
+			return -1, nil, &Error{Message: "所有通道都已经关闭", Kind: CHANNEL_CLOSED}
+		}
+		if block {
+			cases = append(cases,
+				reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(deadlock)},
+				reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(runtime.Done())})
+		} else {
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectDefault})
+		}
+
+		chosen, val, _ := reflect.Select(cases)
+		switch {
+		case chosen == len(cases)-1 && !block:
+			return -1, nil, nil
+		case chosen == len(cases)-1:
+			if err := runtime.Check(); err != nil {
+				return -1, nil, err
+			}
+		case chosen == len(cases)-2 && block:
+			return -1, nil, deadlockError()
+		case chosen%2 == 0:
+			return index[chosen], val.Interface().(Object), nil
+		default:
+			closed[index[chosen]] = true
+		}
+	}
+}
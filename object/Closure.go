@@ -0,0 +1,99 @@
+package object
+
+import (
+	"TroInterpreter/ast"
+	"TroInterpreter/code"
+	"fmt"
+	"sync"
+)
+
+// 编译后的函数，只出现在常量池中
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int                 // 局部变量槽的个数，包括参数
+	NumParameters int                 // 参数个数，参数占用前面的槽
+	Sources       map[int]code.Source // 指令位置到源码信息，用于报错
+
+	Parameters []*ast.Identifier   // 源码中的参数和函数体，用于显示
+	Body       *ast.BlockStatement // 编译顶层程序时为nil
+	ReturnType *ast.TypeName       // 返回类型注解，没有注解时为nil
+	Generator  bool                // gen fn，调用时返回生成器
+}
+
+func (cf *CompiledFunction) Type() TypeObject { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// 局部变量，一次调用中的局部变量按编译时分配的下标存放在Values中
+// Outer为定义被调用函数时所在调用的局部变量，闭包通过它读取外层函数的变量
+// 只有所在的调用会给局部变量赋值，它自己可以直接读取Values；闭包可能在spawn的任务中执行，通过Get读取
+type Locals struct {
+	Values []Object
+	Outer  *Locals
+
+	mu sync.RWMutex
+}
+
+// Get 读取第idx个局部变量
+func (l *Locals) Get(idx int) Object {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.Values[idx]
+}
+
+// Set 给第idx个局部变量赋值
+func (l *Locals) Set(idx int, val Object) {
+	l.mu.Lock()
+	l.Values[idx] = val
+	l.mu.Unlock()
+}
+
+// 闭包，虚拟机中的函数，与求值器的函数类型相同
+type Closure struct {
+	Fn   *CompiledFunction
+	Env  *Locals // 创建闭包时所在调用的局部变量
+	Unit *Unit   // 函数所属的程序或模块，导出的函数在导入者的虚拟机中执行时仍然使用它
+}
+
+// 编译单元，一个程序或模块编译得到的常量池和它的全局变量
+type Unit struct {
+	Constants []Object
+	Globals   *Globals
+}
+
+// 全局变量，同一个编译单元的闭包共享，包括执行生成器函数体和spawn的任务的虚拟机
+type Globals struct {
+	mu     sync.RWMutex
+	values []Object
+}
+
+// NewGlobals 创建全局变量，values为预先定义的全局变量
+func NewGlobals(values []Object) *Globals {
+	return &Globals{values: values}
+}
+
+// Get 返回第idx个全局变量，还没有定义时返回nil
+func (g *Globals) Get(idx int) Object {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if idx < len(g.values) {
+		return g.values[idx]
+	}
+	return nil
+}
+
+// Set 给第idx个全局变量赋值，需要时变长
+func (g *Globals) Set(idx int, val Object) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for idx >= len(g.values) {
+		g.values = append(g.values, nil)
+	}
+	g.values[idx] = val
+}
+
+func (c *Closure) Type() TypeObject { return FUNCTION_OBJ }
+func (c *Closure) Inspect() string {
+	return inspectFunction(c.Fn.Generator, c.Fn.Parameters, c.Fn.ReturnType, c.Fn.Body)
+}
@@ -0,0 +1,107 @@
+package object
+
+import (
+	"bytes"
+	"strings"
+)
+
+// 枚举，通过 枚举名.变体名 获取变体
+type Enum struct {
+	Name     string
+	Variants []*VariantType
+}
+
+func (e *Enum) Type() TypeObject { return ENUM_OBJ }
+func (e *Enum) Inspect() string {
+	var variants []string
+	for _, v := range e.Variants {
+		variants = append(variants, v.Signature())
+	}
+	return "enum " + e.Name + " { " + strings.Join(variants, ", ") + " }"
+}
+
+// Variant 根据名称查找变体
+func (e *Enum) Variant(name string) (*VariantType, bool) {
+	for _, v := range e.Variants {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// 枚举的变体，有字段时调用它创建变体值，没有字段时Unit就是唯一的值
+type VariantType struct {
+	Enum   *Enum
+	Name   string
+	Fields []string
+	Unit   *Variant
+}
+
+func (vt *VariantType) Type() TypeObject { return VARIANT_TYPE_OBJ }
+func (vt *VariantType) Inspect() string {
+	return vt.Enum.Name + "." + vt.Signature()
+}
+
+// Signature 返回变体的声明形式，如 Rect(w, h)
+func (vt *VariantType) Signature() string {
+	if vt.Fields == nil {
+		return vt.Name
+	}
+	return vt.Name + "(" + strings.Join(vt.Fields, ", ") + ")"
+}
+
+// FieldIndex 返回字段的下标，不存在时返回-1
+func (vt *VariantType) FieldIndex(name string) int {
+	for i, field := range vt.Fields {
+		if field == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// 变体值，带有标签和字段值
+type Variant struct {
+	Def    *VariantType
+	Values []Object
+}
+
+func (v *Variant) Type() TypeObject { return VARIANT_OBJ }
+func (v *Variant) Inspect() string {
+	return inspect(v, nil)
+}
+
+func (v *Variant) format(element func(Object) string) string {
+	var out bytes.Buffer
+
+	out.WriteString(v.Def.Enum.Name)
+	out.WriteString(".")
+	out.WriteString(v.Def.Name)
+
+	if v.Def.Fields != nil {
+		var values []string
+		for _, val := range v.Values {
+			values = append(values, element(val))
+		}
+		out.WriteString("(")
+		out.WriteString(strings.Join(values, ", "))
+		out.WriteString(")")
+	}
+
+	return out.String()
+}
+
+// Tag 返回变体名
+func (v *Variant) Tag() string {
+	return v.Def.Name
+}
+
+// Get 获取字段的值
+func (v *Variant) Get(name string) (Object, bool) {
+	idx := v.Def.FieldIndex(name)
+	if idx < 0 {
+		return nil, false
+	}
+	return v.Values[idx], true
+}
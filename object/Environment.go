@@ -1,30 +1,179 @@
 package object
 
+import (
+	"TroInterpreter/ast"
+	"sync"
+)
+
 func NewEnclosedEnvironment(outer *Environment) *Environment {
-	env := NewEnvironment()
+	env := newEnvironment(outer.runtime)
 	env.outer = outer
+	env.frame = outer.frame
+	return env
+}
+
+// NewScopeEnvironment 创建静态作用域(函数体或catch块)的环境，变量存放在scope分配的槽中
+func NewScopeEnvironment(outer *Environment, scope *ast.Scope) *Environment {
+	env := &Environment{
+		slots:   make([]Object, len(scope.Names)),
+		scope:   scope,
+		outer:   outer,
+		frame:   outer.frame,
+		runtime: outer.runtime,
+	}
+	return env
+}
+
+// NewCallEnvironment 创建函数调用的环境，记录调用帧；scope为函数体的静态作用域，没有解析时为nil
+func NewCallEnvironment(outer *Environment, frame *Frame, scope *ast.Scope) *Environment {
+	var env *Environment
+	if scope != nil {
+		env = NewScopeEnvironment(outer, scope)
+	} else {
+		env = NewEnclosedEnvironment(outer)
+	}
+	env.frame = frame
+	return env
+}
+
+// NewModuleEnvironment 创建模块的顶层环境，与importer共享运行时，但看不到importer中的变量
+func NewModuleEnvironment(importer *Environment, file string) *Environment {
+	env := newEnvironment(importer.runtime)
+	env.file = file
+	env.imports = append(append([]string{}, importer.Imports()...), file)
 	return env
 }
 
+// NewEnvironment 创建一个新解释器的顶层环境，带有独立的运行时
+// 不同解释器的变量、模块缓存、限制和计数互不影响，可以在不同的goroutine中同时求值；
+// 同一个解释器同一时刻只能有一次求值，其中spawn的任务除外
 func NewEnvironment() *Environment {
+	return newEnvironment(NewRuntime())
+}
+
+func newEnvironment(runtime *Runtime) *Environment {
 	s := make(map[string]Object)
-	return &Environment{store: s, outer: nil}
+	return &Environment{store: s, outer: nil, runtime: runtime}
 }
 
 // 环境，存储变量
+// 顶层环境按名称存储变量；静态作用域的环境把变量存放在槽中，槽为nil表示变量还没有定义
+// spawn的任务与创建它的代码共享外层的环境，变量的读写都加锁
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	mu      sync.RWMutex
+	store   map[string]Object
+	slots   []Object
+	scope   *ast.Scope // 静态作用域，按名称存储时为nil
+	outer   *Environment
+	frame   *Frame   // 当前所在的函数调用，顶层为nil
+	file    string   // 所在的源文件，只记录在顶层环境上
+	imports []string // 从顶层到这个模块的导入链，只记录在模块的顶层环境上
+	runtime *Runtime // 所属解释器的运行时
+}
+
+// Frame 返回当前所在的函数调用
+func (e *Environment) Frame() *Frame {
+	return e.frame
+}
+
+// Runtime 返回所属解释器的运行时
+func (e *Environment) Runtime() *Runtime {
+	return e.runtime
+}
+
+// File 返回代码所在的源文件，交互式输入时为空
+func (e *Environment) File() string {
+	if e.file == "" && e.outer != nil {
+		return e.outer.File()
+	}
+	return e.file
+}
+
+// Imports 返回从顶层到所在模块的导入链，不在模块中时为空
+func (e *Environment) Imports() []string {
+	if e.imports == nil && e.outer != nil {
+		return e.outer.Imports()
+	}
+	return e.imports
+}
+
+// SetFile 设置顶层环境对应的源文件
+func (e *Environment) SetFile(file string) {
+	e.file = file
 }
 
+// Outer 返回外层的环境，顶层环境返回nil
+func (e *Environment) Outer() *Environment {
+	return e.outer
+}
+
+// Get 按名称逐层查找变量
 func (e *Environment) Get(name string) (Object, bool) {
-	obj, ok := e.store[name]
-	if !ok && e.outer != nil {
-		obj, ok = e.outer.Get(name)
+	for env := e; env != nil; env = env.outer {
+		if obj, ok := env.lookup(name); ok {
+			return obj, true
+		}
 	}
+	return nil, false
+}
+
+// 在当前环境中按名称查找变量
+func (e *Environment) lookup(name string) (Object, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.scope != nil {
+		if slot := e.scope.Slot(name); slot >= 0 && e.slots[slot] != nil {
+			return e.slots[slot], true
+		}
+	}
+	obj, ok := e.store[name]
 	return obj, ok
 }
+
 func (e *Environment) Set(name string, val Object) Object {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.scope != nil {
+		if slot := e.scope.Slot(name); slot >= 0 {
+			e.slots[slot] = val
+			return val
+		}
+	}
+	if e.store == nil {
+		e.store = make(map[string]Object)
+	}
 	e.store[name] = val
 	return val
 }
+
+// GetSlot 读取向外第depth层环境中第slot个槽，变量还没有定义时返回nil
+func (e *Environment) GetSlot(depth, slot int) (Object, *Environment) {
+	env := e
+	for ; depth > 0; depth-- {
+		env = env.outer
+	}
+	env.mu.RLock()
+	val := env.slots[slot]
+	env.mu.RUnlock()
+	return val, env
+}
+
+// SetSlot 给当前环境的第slot个槽赋值
+func (e *Environment) SetSlot(slot int, val Object) Object {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.slots[slot] = val
+	return val
+}
+
+// GetGlobal 在向外第depth层的顶层环境中按名称查找变量
+func (e *Environment) GetGlobal(depth int, name string) (Object, bool) {
+	env := e
+	for ; depth > 0; depth-- {
+		env = env.outer
+	}
+	env.mu.RLock()
+	defer env.mu.RUnlock()
+	obj, ok := env.store[name]
+	return obj, ok
+}
@@ -1,8 +1,40 @@
 package object
 
+import (
+	"bytes"
+	"fmt"
+)
+
+// 错误的类型，可以在catch中通过e.type读取
+const (
+	RUNTIME_ERROR    = "RuntimeError"    //其他运行时错误
+	TYPE_ERROR       = "TypeError"       //类型不匹配、操作符不支持
+	NAME_ERROR       = "NameError"       //标识符、属性、方法不存在
+	ARGUMENT_ERROR   = "ArgumentError"   //参数数量或类型错误
+	IMPORT_ERROR     = "ImportError"     //模块加载错误
+	ARITHMETIC_ERROR = "ArithmeticError" //除以0、整数溢出
+	RECURSION_ERROR  = "RecursionError"  //超出最大调用深度
+	MEMORY_ERROR     = "MemoryError"     //超出内存限制
+	THROWN_ERROR     = "Error"           //throw抛出的非结构体值
+	STOP_ITERATION   = "StopIteration"   //生成器已经结束
+	CHANNEL_CLOSED   = "ChannelClosed"   //通道已经关闭
+	DEADLOCK_ERROR   = "DeadlockError"   //所有任务都在等待，没有谁能唤醒它们
+
+	//以下错误用于中断求值，不能被catch捕获
+	CANCELLED_ERROR  = "CancelledError" //上下文被取消
+	TIMEOUT_ERROR    = "TimeoutError"   //超过截止时间
+	STEP_LIMIT_ERROR = "StepLimitError" //超出执行步数限制
+	GENERATOR_EXIT   = "GeneratorExit"  //不再使用的生成器被结束
+)
+
 // 错误
 type Error struct {
 	Message string
+	Kind    string // 错误的类型
+	Value   Object // throw抛出的值，求值器产生的错误为nil
+	Line    int    // 出错位置所在行，未知时为0
+	Column  int    // 出错位置所在列
+	Stack   *Frame // 出错时所在的函数调用
 }
 
 func (e *Error) Type() TypeObject {
@@ -11,3 +43,44 @@ func (e *Error) Type() TypeObject {
 func (e *Error) Inspect() string {
 	return "ERROR: " + e.Message
 }
+
+// Catchable 返回错误能否被catch捕获，中断求值的错误不能被捕获
+func (e *Error) Catchable() bool {
+	switch e.Kind {
+	case CANCELLED_ERROR, TIMEOUT_ERROR, STEP_LIMIT_ERROR, GENERATOR_EXIT:
+		return false
+	}
+	return true
+}
+
+// 调用栈过深时，Traceback在两端各保留的层数
+const tracebackFrames = 10
+
+// Traceback 返回带有出错位置和调用栈的错误信息，最近的调用在最后
+func (e *Error) Traceback() string {
+	var out bytes.Buffer
+
+	out.WriteString(e.Inspect())
+	if e.Line > 0 {
+		out.WriteString(fmt.Sprintf("\n\t位置: 第%d行第%d列", e.Line, e.Column))
+	}
+
+	var frames []*Frame
+	for f := e.Stack; f != nil; f = f.Caller {
+		frames = append(frames, f)
+	}
+	if len(frames) > 0 {
+		out.WriteString("\n\t调用栈(最近的调用在最后):")
+		for i := len(frames) - 1; i >= 0; i-- {
+			//调用栈太深时只输出最外层和最内层的几层
+			if len(frames) > 2*tracebackFrames && i == len(frames)-1-tracebackFrames {
+				out.WriteString(fmt.Sprintf("\n\t\t... 省略%d层 ...", len(frames)-2*tracebackFrames))
+				i = tracebackFrames - 1
+			}
+			out.WriteString(fmt.Sprintf("\n\t\t第%d行第%d列 调用 %s",
+				frames[i].Line, frames[i].Column, frames[i].Function))
+		}
+	}
+
+	return out.String()
+}
@@ -0,0 +1,14 @@
+package object
+
+// 调用帧，记录一次函数调用，通过Caller连成调用栈
+type Frame struct {
+	Function  string // 被调用的函数名
+	Line      int    // 调用处所在行
+	Column    int    // 调用处所在列
+	Caller    *Frame // 调用者的帧，最外层为nil
+	Depth     int    // 调用深度，最外层的调用为1
+	TailCalls int    // 这个位置上连续被尾调用替换的次数，不是尾调用时为0
+
+	Yield func(Object) bool // 生成器函数的调用中为交出值的函数，见Generator
+	Task  bool              // spawn创建的任务的最外层，任务中的yield不会交给创建任务的生成器
+}
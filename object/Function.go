@@ -10,23 +10,38 @@ import (
 type Function struct {
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
+	ReturnType *ast.TypeName // 返回类型注解，没有注解时为nil
+	Generator  bool          // gen fn，调用时返回生成器
 	Env        *Environment
+	Scope      *ast.Scope // 函数体的静态作用域，没有解析时为nil
 }
 
 func (f *Function) Type() TypeObject { return FUNCTION_OBJ }
 func (f *Function) Inspect() string {
+	return inspectFunction(f.Generator, f.Parameters, f.ReturnType, f.Body)
+}
+
+// 函数的字符串表示，求值器的函数与虚拟机的闭包相同
+func inspectFunction(generator bool, parameters []*ast.Identifier, returnType *ast.TypeName, body *ast.BlockStatement) string {
 	var out bytes.Buffer
 	var params []string
 
-	for _, p := range f.Parameters {
+	for _, p := range parameters {
 		params = append(params, p.String())
 	}
 
+	if generator {
+		out.WriteString("gen ")
+	}
 	out.WriteString("fn")
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
-	out.WriteString(") {\n")
-	out.WriteString(f.Body.String())
+	out.WriteString(") ")
+	if returnType != nil {
+		out.WriteString("-> " + returnType.String() + " ")
+	}
+	out.WriteString("{\n")
+	out.WriteString(body.String())
 	out.WriteString("\n}")
 
 	return out.String()
@@ -0,0 +1,163 @@
+package object
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// 生成器，调用gen函数得到，每次Next执行函数体直到下一个yield
+// 函数体在单独的goroutine中执行，与调用Next的一方通过channel轮流运行，同一时刻只有一方在执行，
+// 所以yield可以出现在任意嵌套的块、try和递归调用中，挂起时Go的调用栈原样保留
+type Generator struct {
+	Name string // 生成器函数名，用于显示
+	co   *coroutine
+}
+
+// 生成器函数体的执行状态，不引用Generator，Generator不再使用时可以被回收
+type coroutine struct {
+	body   func(yield func(Object) bool) Object
+	resume chan bool // 调用方通知函数体继续执行，false表示生成器不再使用，要求函数体结束
+	out    chan step // 函数体交出的值或结束的结果
+
+	mu       sync.Mutex
+	started  bool
+	running  bool
+	finished bool
+}
+
+// 函数体交给调用方的一步
+type step struct {
+	val      Object
+	done     bool        // 函数体执行结束，val为结果，出错时为错误
+	panicked interface{} // 函数体中发生的panic，在调用方重新panic
+}
+
+// NewGenerator 创建生成器，body在第一次Next时开始执行；body通过yield交出值，
+// yield返回false时生成器不再使用，body应当尽快结束
+func NewGenerator(name string, body func(yield func(Object) bool) Object) *Generator {
+	g := &Generator{Name: name, co: &coroutine{
+		body:   body,
+		resume: make(chan bool),
+		out:    make(chan step),
+	}}
+	//没有执行完就不再使用的生成器，回收时结束函数体，避免goroutine泄漏
+	//函数体引用了生成器本身时(如保存在函数体可以访问的变量中)不会被回收，需要调用Close
+	runtime.SetFinalizer(g, func(g *Generator) { go g.co.stop() })
+	return g
+}
+
+func (g *Generator) Type() TypeObject { return GENERATOR_OBJ }
+func (g *Generator) Inspect() string {
+	return "generator " + g.Name
+}
+
+// Next 执行函数体到下一个yield，返回交出的值；函数体出错时返回错误，已经结束时返回nil
+func (g *Generator) Next() Object {
+	co := g.co
+
+	co.mu.Lock()
+	if co.finished {
+		co.mu.Unlock()
+		return nil
+	}
+	if co.running {
+		co.mu.Unlock()
+		return g.runningError()
+	}
+	co.running = true
+	start := !co.started
+	co.started = true
+	co.mu.Unlock()
+
+	if start {
+		go co.run()
+	} else {
+		co.resume <- true
+	}
+	s := <-co.out
+
+	co.mu.Lock()
+	co.running = false
+	if s.done || s.panicked != nil {
+		co.finished = true
+	}
+	co.mu.Unlock()
+
+	if s.panicked != nil {
+		panic(s.panicked)
+	}
+	if s.done {
+		if err, ok := s.val.(*Error); ok {
+			return err
+		}
+		return nil
+	}
+	return s.val
+}
+
+// Close 结束生成器：挂起的函数体中yield返回false，函数体随之结束，其中的finally仍然会执行
+// 之后Next返回nil；函数体出错时返回错误，生成器正在运行时返回错误
+func (g *Generator) Close() *Error {
+	if g.co.isRunning() {
+		return g.runningError()
+	}
+	return g.co.stop()
+}
+
+func (g *Generator) runningError() *Error {
+	return &Error{Message: "生成器正在运行: " + g.Name, Kind: RUNTIME_ERROR}
+}
+
+func (co *coroutine) isRunning() bool {
+	co.mu.Lock()
+	defer co.mu.Unlock()
+	return co.running
+}
+
+// 在goroutine中执行函数体
+func (co *coroutine) run() {
+	defer func() {
+		if r := recover(); r != nil {
+			co.out <- step{panicked: r}
+		}
+	}()
+	result := co.body(co.yield)
+	co.out <- step{val: result, done: true}
+}
+
+// 交出值并等待调用方继续
+func (co *coroutine) yield(val Object) bool {
+	co.out <- step{val: val}
+	return <-co.resume
+}
+
+// 结束挂起的函数体：yield返回false，函数体中的finally可能再次yield，直到函数体执行结束
+// 返回函数体中除了GeneratorExit之外的错误；函数体中的panic转换为错误，回收时在单独的goroutine中调用也不会使进程退出
+func (co *coroutine) stop() *Error {
+	co.mu.Lock()
+	if co.running {
+		co.mu.Unlock()
+		return nil
+	}
+	suspended := co.started && !co.finished
+	co.finished = true
+	co.mu.Unlock()
+	if !suspended {
+		return nil
+	}
+
+	for {
+		co.resume <- false
+		s := <-co.out
+		if s.panicked != nil {
+			return &Error{Message: fmt.Sprintf("生成器异常: %v", s.panicked), Kind: RUNTIME_ERROR}
+		}
+		if s.done {
+			if err, ok := s.val.(*Error); ok && err.Kind != GENERATOR_EXIT {
+				return err
+			}
+			return nil
+		}
+	}
+}
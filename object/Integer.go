@@ -1,6 +1,9 @@
 package object
 
-import "fmt"
+import (
+	"fmt"
+	"math/big"
+)
 
 // 整数
 type Integer struct {
@@ -13,3 +16,16 @@ func (i *Integer) Type() TypeObject {
 func (i *Integer) Inspect() string {
 	return fmt.Sprintf("%d", i.Value)
 }
+
+// 大整数，超出int64范围的整数，类型与Integer相同
+// 运算结果回到int64范围内时会重新变为Integer，Value不会被修改
+type BigInteger struct {
+	Value *big.Int
+}
+
+func (i *BigInteger) Type() TypeObject {
+	return INTEGER_OBJ
+}
+func (i *BigInteger) Inspect() string {
+	return i.Value.String()
+}
@@ -0,0 +1,28 @@
+package object
+
+import "sort"
+
+// 模块，只包含导出的绑定
+type Module struct {
+	Name    string
+	Path    string
+	Exports map[string]Object
+}
+
+func (m *Module) Type() TypeObject { return MODULE_OBJ }
+func (m *Module) Inspect() string {
+	var names []string
+	for name := range m.Exports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := "module " + m.Name + " {"
+	for i, name := range names {
+		if i != 0 {
+			out += ","
+		}
+		out += " " + name
+	}
+	return out + " }"
+}
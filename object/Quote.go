@@ -0,0 +1,15 @@
+package object
+
+import "TroInterpreter/ast"
+
+// 引用，包裹一段未求值的代码
+type Quote struct {
+	Node ast.Node
+}
+
+func (q *Quote) Type() TypeObject {
+	return QUOTE_OBJ
+}
+func (q *Quote) Inspect() string {
+	return "QUOTE(" + q.Node.String() + ")"
+}
@@ -0,0 +1,364 @@
+package object
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 整数运算溢出时的处理方式
+type OverflowMode int
+
+const (
+	OVERFLOW_PROMOTE OverflowMode = iota //溢出时转为大整数，默认
+	OVERFLOW_ERROR                       //溢出时报错
+	OVERFLOW_WRAP                        //按补码回绕
+)
+
+// 默认的最大调用深度
+const DEFAULT_MAX_DEPTH = 10000
+
+// 默认的最大连续尾调用次数
+const DEFAULT_MAX_TAIL_CALLS = 1000000
+
+// Limits 限制一个解释器可以分配的内存，字段小于等于0时不限制
+type Limits struct {
+	MaxAllocation   int64 // 累计分配的总量：数组元素、结构体和变体字段的个数，加上字符串和大整数的字节数
+	MaxStringLength int   // 字符串的最大字节数
+	MaxArrayLength  int   // 数组的最大长度
+}
+
+// 运行时，由同一个解释器的所有环境共享，保存解释器级别的配置和状态
+// 配置字段在求值前设置；状态可以被spawn的任务同时访问
+type Runtime struct {
+	SearchPath   []string     // 模块搜索路径，相对路径先在导入者所在目录查找，再依次在这些目录中查找
+	Overflow     OverflowMode // 整数运算溢出时的处理方式
+	MaxDepth     int          // 最大调用深度，超过时报错，小于等于0时不限制
+	MaxTailCalls int          // 同一个调用帧上连续尾调用的最大次数，超过时报错，小于等于0时不限制
+	Limits       Limits       // 内存限制
+	Optimize     bool         // 是否在运行前优化模块的ast，见evaluator.Optimize
+
+	mu      sync.Mutex             // 保护modules和loading
+	modules map[string]*Module     // 已加载的模块，键为模块文件的绝对路径
+	loading map[string]*moduleLoad // 正在加载的模块，键与modules相同
+
+	limit     atomic.Pointer[limit] // 当前求值的上下文和步数限制，为nil时不限制
+	allocated atomic.Int64          // 累计分配的总量
+	sched     sched                 // spawn的任务和等待中的goroutine，用于检测死锁
+}
+
+// 一次求值的上下文和步数限制，求值中spawn的任务同样受它限制
+type limit struct {
+	ctx      context.Context // 为nil时不检查
+	cancel   context.CancelFunc
+	maxSteps int64          // 小于等于0时不限制
+	steps    atomic.Int64   // 已经执行的步数
+	tasks    sync.WaitGroup // 求值中spawn的还没有结束的任务
+}
+
+func NewRuntime() *Runtime {
+	return &Runtime{MaxDepth: DEFAULT_MAX_DEPTH, MaxTailCalls: DEFAULT_MAX_TAIL_CALLS, modules: make(map[string]*Module), loading: make(map[string]*moduleLoad)}
+}
+
+// Limit 设置之后求值的上下文和步数限制，返回恢复之前设置的函数
+// 恢复时取消求值中spawn的还在执行的任务，等待它们结束，任务不会在没有限制的情况下继续执行
+func (r *Runtime) Limit(ctx context.Context, maxSteps int64) (restore func()) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	l := &limit{maxSteps: maxSteps}
+	l.ctx, l.cancel = context.WithCancel(ctx)
+	previous := r.limit.Swap(l)
+	return func() {
+		l.cancel()
+		l.tasks.Wait()
+		r.limit.Store(previous)
+	}
+}
+
+// Go 在新的goroutine中执行任务，有Limit设置的限制时，恢复之前的限制前会等待它结束
+func (r *Runtime) Go(run func()) {
+	r.sched.start()
+	l := r.limit.Load()
+	if l != nil {
+		l.tasks.Add(1)
+	}
+	go func() {
+		defer r.sched.exit()
+		if l != nil {
+			defer l.tasks.Done()
+		}
+		run()
+	}()
+}
+
+// 开始等待通道或任务，返回确认死锁时关闭的channel，等待结束时调用done
+func (r *Runtime) wait() (deadlock <-chan struct{}, done func()) {
+	return r.sched.wait()
+}
+
+// 确认死锁前等待的时间，覆盖刚刚开始等待、还没有真正阻塞的goroutine
+const deadlockGrace = 10 * time.Millisecond
+
+// 任务的调度状态，用于检测死锁
+// 求值的goroutine和所有还在执行的任务都在等待通道或任务时，没有谁能唤醒它们，这时等待的一方都得到DeadlockError
+// 求值的goroutine总是被算作在执行，生成器的函数体与调用next的一方轮流执行，算作同一个
+type sched struct {
+	mu       sync.Mutex
+	running  int           // 还在执行的任务，不包括求值的goroutine
+	waiting  int           // 正在等待的goroutine
+	progress uint64        // 等待结束的次数，确认死锁期间有变化说明等待的goroutine被唤醒过
+	deadlock chan struct{} // 确认死锁时关闭，唤醒所有等待的goroutine
+	checking bool          // 是否正在确认死锁
+}
+
+func (s *sched) start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running++
+}
+
+func (s *sched) exit() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running--
+	s.check()
+}
+
+func (s *sched) wait() (<-chan struct{}, func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.deadlock == nil {
+		s.deadlock = make(chan struct{})
+	}
+	deadlock := s.deadlock
+	s.waiting++
+	s.check()
+	return deadlock, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.waiting--
+		s.progress++
+	}
+}
+
+// 所有goroutine都在等待时，过一段时间再确认，需要持有锁
+func (s *sched) check() {
+	if s.checking || s.waiting <= s.running {
+		return
+	}
+	s.checking = true
+	progress := s.progress
+	time.AfterFunc(deadlockGrace, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.checking = false
+		if s.progress != progress {
+			s.check()
+			return
+		}
+		if s.waiting > s.running {
+			close(s.deadlock)
+			s.deadlock = make(chan struct{})
+		}
+	})
+}
+
+// CheckDepth 检查调用帧是否超出最大调用深度或最大连续尾调用次数
+// 尾调用不增加调用深度，无限的尾递归由连续尾调用的次数限制
+func (r *Runtime) CheckDepth(frame *Frame) *Error {
+	if max := r.MaxDepth; max > 0 && frame.Depth > max {
+		return &Error{Message: fmt.Sprintf("超出最大递归深度 %d: %s", max, frame.Function), Kind: RECURSION_ERROR}
+	}
+	if max := r.MaxTailCalls; max > 0 && frame.TailCalls > max {
+		return &Error{Message: fmt.Sprintf("超出最大递归深度 %d: %s", max, frame.Function), Kind: RECURSION_ERROR}
+	}
+	return nil
+}
+
+// Step 记录执行了一步，上下文结束或超出步数限制时返回不能被捕获的错误
+func (r *Runtime) Step() *Error {
+	l := r.limit.Load()
+	if l == nil {
+		return nil
+	}
+	if steps := l.steps.Add(1); l.maxSteps > 0 && steps > l.maxSteps {
+		return &Error{Message: fmt.Sprintf("超出执行步数限制 %d", l.maxSteps), Kind: STEP_LIMIT_ERROR}
+	}
+	return r.Check()
+}
+
+// Check 检查上下文是否已经结束，结束时返回不能被捕获的错误
+func (r *Runtime) Check() *Error {
+	l := r.limit.Load()
+	if l == nil || l.ctx == nil {
+		return nil
+	}
+
+	select {
+	case <-l.ctx.Done():
+		if errors.Is(l.ctx.Err(), context.DeadlineExceeded) {
+			return &Error{Message: "执行超时", Kind: TIMEOUT_ERROR}
+		}
+		return &Error{Message: "执行被取消", Kind: CANCELLED_ERROR}
+	default:
+		return nil
+	}
+}
+
+// Done 返回当前求值的上下文结束时关闭的channel，没有上下文时为nil
+// 会阻塞的操作(通道、等待任务)同时等待它，上下文结束时通过Check得到错误
+func (r *Runtime) Done() <-chan struct{} {
+	l := r.limit.Load()
+	if l == nil || l.ctx == nil {
+		return nil
+	}
+	return l.ctx.Done()
+}
+
+// Allocate 记录新创建的对象，超出内存限制时返回错误
+func (r *Runtime) Allocate(obj Object) *Error {
+	var size int64
+	switch obj := obj.(type) {
+	case *String:
+		size = int64(len(obj.Value))
+		if max := r.Limits.MaxStringLength; max > 0 && len(obj.Value) > max {
+			return &Error{Message: fmt.Sprintf("字符串长度超出限制: %d > %d", len(obj.Value), max), Kind: MEMORY_ERROR}
+		}
+	case *Array:
+		size = int64(len(obj.Elements))
+		if max := r.Limits.MaxArrayLength; max > 0 && len(obj.Elements) > max {
+			return &Error{Message: fmt.Sprintf("数组长度超出限制: %d > %d", len(obj.Elements), max), Kind: MEMORY_ERROR}
+		}
+	case *BigInteger:
+		size = int64(len(obj.Value.Bits())) * 8
+	case *Struct:
+		size = int64(len(obj.Values))
+	case *Variant:
+		size = int64(len(obj.Values))
+	}
+
+	allocated := r.allocated.Add(size)
+	if max := r.Limits.MaxAllocation; max > 0 && allocated > max {
+		return &Error{Message: fmt.Sprintf("分配的内存超出限制 %d", max), Kind: MEMORY_ERROR}
+	}
+	return nil
+}
+
+// Allocated 返回累计分配的总量
+func (r *Runtime) Allocated() int64 {
+	return r.allocated.Load()
+}
+
+// Module 返回已加载的模块
+func (r *Runtime) Module(path string) (*Module, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m, ok := r.modules[path]
+	return m, ok
+}
+
+// 正在进行的模块加载
+type moduleLoad struct {
+	done     chan struct{} // 加载结束时关闭
+	importer string        // 导入它的模块，顶层导入时为空
+	waiting  string        // 加载它的任务正在导入的模块，用于检测不同任务之间的循环导入
+}
+
+// BeginLoading 开始加载模块，chain为导入者所在的导入链，在顶层导入时为空
+// 模块已经加载时返回模块；其他任务正在加载时等待它结束；会形成循环导入时返回包括path的循环导入链；
+// 都不是时返回的都为nil，由调用者加载模块，之后调用EndLoading
+func (r *Runtime) BeginLoading(path string, chain []string) (*Module, []string, *Error) {
+	var importer string
+	if len(chain) > 0 {
+		importer = chain[len(chain)-1]
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for {
+		if m, ok := r.modules[path]; ok {
+			return m, nil, nil
+		}
+		if cycle := r.cycle(path, chain); cycle != nil {
+			return nil, cycle, nil
+		}
+		r.setWaiting(importer, path)
+
+		load, ok := r.loading[path]
+		if !ok {
+			r.loading[path] = &moduleLoad{done: make(chan struct{}), importer: importer}
+			return nil, nil, nil
+		}
+
+		//加载失败时没有缓存，重新检查后由这个任务自己加载，得到同样的错误
+		r.mu.Unlock()
+		err := r.await(load.done)
+		r.mu.Lock()
+		r.setWaiting(importer, "")
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+// 从path开始沿着各个加载正在导入的模块查找，回到chain中的模块时形成循环导入，需要持有锁
+func (r *Runtime) cycle(path string, chain []string) []string {
+	via := []string{path}
+	for next := path; len(via) <= len(r.loading)+1; {
+		for i, loading := range chain {
+			if loading == next {
+				cycle := append([]string{}, chain[i:]...)
+				return append(cycle, via...)
+			}
+		}
+		load, ok := r.loading[next]
+		if !ok || load.waiting == "" {
+			return nil
+		}
+		next = load.waiting
+		via = append(via, next)
+	}
+	return nil
+}
+
+// 等待其他任务加载模块
+func (r *Runtime) await(done chan struct{}) *Error {
+	deadlock, finish := r.wait()
+	defer finish()
+	for {
+		select {
+		case <-done:
+			return nil
+		case <-deadlock:
+			return deadlockError()
+		case <-r.Done():
+			if err := r.Check(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// EndLoading 标记模块加载结束，加载成功时m不为nil，会被缓存；等待这个模块的任务继续执行
+func (r *Runtime) EndLoading(path string, m *Module) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if m != nil {
+		r.modules[path] = m
+	}
+	load := r.loading[path]
+	delete(r.loading, path)
+	r.setWaiting(load.importer, "")
+	close(load.done)
+}
+
+// 记录importer的加载正在导入path，importer已经加载完成(之后调用它导出的函数)时不需要记录，需要持有锁
+func (r *Runtime) setWaiting(importer, path string) {
+	if load, ok := r.loading[importer]; ok {
+		load.waiting = path
+	}
+}
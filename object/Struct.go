@@ -0,0 +1,109 @@
+package object
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+)
+
+// 结构体类型，调用它可以创建实例
+type StructType struct {
+	Name   string
+	Fields []string
+}
+
+func (st *StructType) Type() TypeObject { return STRUCT_TYPE_OBJ }
+func (st *StructType) Inspect() string {
+	return "struct " + st.Name + " { " + strings.Join(st.Fields, ", ") + " }"
+}
+
+// FieldIndex 返回字段的下标，不存在时返回-1
+func (st *StructType) FieldIndex(name string) int {
+	for i, field := range st.Fields {
+		if field == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// 结构体实例，字段值按声明顺序存放
+// 字段可以被spawn的任务同时读写，创建之后通过Get、Set和Field访问
+type Struct struct {
+	Def    *StructType
+	Values []Object
+
+	mu sync.RWMutex
+}
+
+func (s *Struct) Type() TypeObject { return STRUCT_OBJ }
+func (s *Struct) Inspect() string {
+	return inspect(s, nil)
+}
+
+// 显示结构体、数组和变体，结构体的字段可以指向自己
+// printing记录正在显示的结构体，再次遇到时显示为 名称{...}
+func inspect(obj Object, printing map[*Struct]bool) string {
+	switch obj := obj.(type) {
+	case *Struct:
+		if printing[obj] {
+			return obj.Def.Name + "{...}"
+		}
+		if printing == nil {
+			printing = map[*Struct]bool{}
+		}
+		printing[obj] = true
+		defer delete(printing, obj)
+		return obj.format(func(e Object) string { return inspect(e, printing) })
+	case *Array:
+		return obj.format(func(e Object) string { return inspect(e, printing) })
+	case *Variant:
+		return obj.format(func(e Object) string { return inspect(e, printing) })
+	default:
+		return obj.Inspect()
+	}
+}
+
+func (s *Struct) format(element func(Object) string) string {
+	var out bytes.Buffer
+
+	var fields []string
+	for i, field := range s.Def.Fields {
+		fields = append(fields, field+": "+element(s.Field(i)))
+	}
+
+	out.WriteString(s.Def.Name)
+	out.WriteString("{")
+	out.WriteString(strings.Join(fields, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// Get 获取字段的值
+func (s *Struct) Get(name string) (Object, bool) {
+	idx := s.Def.FieldIndex(name)
+	if idx < 0 {
+		return nil, false
+	}
+	return s.Field(idx), true
+}
+
+// Field 获取第i个字段的值
+func (s *Struct) Field(i int) Object {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Values[i]
+}
+
+// Set 修改字段的值，字段不存在时返回false
+func (s *Struct) Set(name string, val Object) bool {
+	idx := s.Def.FieldIndex(name)
+	if idx < 0 {
+		return false
+	}
+	s.mu.Lock()
+	s.Values[idx] = val
+	s.mu.Unlock()
+	return true
+}
@@ -0,0 +1,16 @@
+package object
+
+// 尾调用，函数体中处于尾部位置的调用不会立即执行，而是交给调用它的函数循环执行
+// 只在求值函数体时出现，不会作为值被看到
+type TailCall struct {
+	Function Object
+	Args     []Object
+	Frame    *Frame // 替换当前调用帧的新帧
+}
+
+func (tc *TailCall) Type() TypeObject {
+	return TAIL_CALL_OBJ
+}
+func (tc *TailCall) Inspect() string {
+	return "tail call " + tc.Frame.Function
+}
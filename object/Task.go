@@ -0,0 +1,63 @@
+package object
+
+import "fmt"
+
+// 任务，spawn调用函数得到，函数在单独的goroutine中执行，通过Wait等待结果
+type Task struct {
+	Name   string // 被调用的函数名，用于显示
+	done   chan struct{}
+	result Object
+}
+
+// NewTask 创建任务，立即通过runtime.Go在新的goroutine中执行run；run中的panic转换为错误，不会使进程退出
+func NewTask(name string, runtime *Runtime, run func() Object) *Task {
+	t := &Task{Name: name, done: make(chan struct{})}
+	runtime.Go(func() {
+		defer close(t.done)
+		defer func() {
+			if r := recover(); r != nil {
+				t.result = &Error{Message: fmt.Sprintf("任务异常: %v", r), Kind: RUNTIME_ERROR}
+			}
+		}()
+		t.result = run()
+	})
+	return t
+}
+
+func (t *Task) Type() TypeObject { return TASK_OBJ }
+func (t *Task) Inspect() string {
+	return "task " + t.Name
+}
+
+// Wait 等待任务结束，返回函数的结果，出错时为错误；所有任务都在等待时返回DeadlockError，
+// 等待时运行时的上下文结束则返回中断求值的错误
+func (t *Task) Wait(runtime *Runtime) Object {
+	if t.Done() {
+		return t.result
+	}
+
+	deadlock, done := runtime.wait()
+	defer done()
+	for {
+		select {
+		case <-t.done:
+			return t.result
+		case <-deadlock:
+			return deadlockError()
+		case <-runtime.Done():
+			if err := runtime.Check(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Done 返回任务是否已经结束
+func (t *Task) Done() bool {
+	select {
+	case <-t.done:
+		return true
+	default:
+		return false
+	}
+}
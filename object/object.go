@@ -12,6 +12,20 @@ const (
 	STRING_OBJ       = "STRING"
 	BUILTIN_OBJ      = "BUILTIN"
 	ARRAY_OBJ        = "ARRAY"
+	QUOTE_OBJ        = "QUOTE"
+	MACRO_OBJ        = "MACRO"
+	STRUCT_TYPE_OBJ  = "STRUCT_TYPE"
+	STRUCT_OBJ       = "STRUCT"
+	ENUM_OBJ         = "ENUM"
+	VARIANT_TYPE_OBJ = "VARIANT_TYPE"
+	VARIANT_OBJ      = "VARIANT"
+	MODULE_OBJ       = "MODULE"
+	TAIL_CALL_OBJ    = "TAIL_CALL"
+	GENERATOR_OBJ    = "GENERATOR"
+	CHANNEL_OBJ      = "CHANNEL"
+	TASK_OBJ         = "TASK"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
 )
 
 type Object interface {
@@ -9,6 +9,7 @@ import (
 const (
 	_ = iota
 	LOWEST
+	ASSIGN      // p.x = 1
 	EQUALS      // ==
 	LESSGREATER // > or <
 	SUM         // +
@@ -16,6 +17,7 @@ const (
 	PREFIX      // -X or !X
 	CALL        // myFunction(X)
 	INDEX       // array[index]
+	MEMBER      // value.method()
 )
 
 type (
@@ -24,6 +26,7 @@ type (
 )
 
 var precedences = map[token.TypeToken]int{
+	token.ASSIGN:   ASSIGN,
 	token.EQ:       EQUALS,
 	token.NOT_EQ:   EQUALS,
 	token.LT:       LESSGREATER,
@@ -34,6 +37,7 @@ var precedences = map[token.TypeToken]int{
 	token.ASTER:    PRODUCT,
 	token.LPAREN:   CALL,
 	token.LBRACKET: INDEX,
+	token.DOT:      MEMBER,
 }
 
 func New(l *lexer.Lexer) *Parser {
@@ -58,6 +62,11 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.FUNCTION, p.parseFunctionExpression)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
+	p.registerPrefix(token.GEN, p.parseGeneratorExpression)
+	p.registerPrefix(token.YIELD, p.parseYieldExpression)
+	p.registerPrefix(token.SPAWN, p.parseSpawnExpression)
 
 	//注册中缀解析函数
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
@@ -70,6 +79,8 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.GT, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallFunctionExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.DOT, p.parsePropertyExpression)
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
 
 	return p
 }
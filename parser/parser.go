@@ -4,7 +4,9 @@ import (
 	"TroInterpreter/ast"
 	"TroInterpreter/lexer"
 	"TroInterpreter/token"
+	"errors"
 	"fmt"
+	"math/big"
 	"strconv"
 )
 
@@ -16,6 +18,8 @@ type Parser struct {
 
 	errors []string //错误
 
+	generator bool //当前是否在生成器函数体中，yield只能出现在生成器函数及其中嵌套的函数中
+
 	prefixParseFns map[token.TypeToken]prefixParseFn //前缀解析函数映射
 	infixParseFns  map[token.TypeToken]infixParseFn  //中缀解析函数映射
 }
@@ -65,6 +69,14 @@ func (p *Parser) registerInfix(tokenType token.TypeToken, fn infixParseFn) {
 	p.infixParseFns[tokenType] = fn
 }
 
+// Precedence 获取中缀运算符的优先级，不是中缀运算符返回LOWEST
+func Precedence(t token.TypeToken) int {
+	if p, ok := precedences[t]; ok {
+		return p
+	}
+	return LOWEST
+}
+
 // 获取当前token优先级
 func (p *Parser) curPrecedence() int {
 	if p, ok := precedences[p.curToken.Type]; ok {
@@ -130,6 +142,16 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.STRUCT:
+		return p.parseStructStatement()
+	case token.ENUM:
+		return p.parseEnumStatement()
+	case token.IMPORT:
+		return p.parseImportStatement()
+	case token.EXPORT:
+		return p.parseExportStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -144,7 +166,14 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	}
 	//创建标识符节点
 	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal} //创建标识符节点
-	if !p.expectPeekAndNext(token.ASSIGN) {                                   //判断下一个token是否为ASSIGN
+	//可选的类型注解
+	if p.peekToken.Type == token.COLON {
+		p.nextToken()
+		if stmt.Name.Type = p.parseTypeName(); stmt.Name.Type == nil {
+			return nil
+		}
+	}
+	if !p.expectPeekAndNext(token.ASSIGN) { //判断下一个token是否为ASSIGN
 		return nil
 	}
 	//跳过=
@@ -173,6 +202,170 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
+// 分析throw语句
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	stmt := &ast.ThrowStatement{Token: p.curToken}
+	//跳过throw
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
+	//如果下一个token是分号，跳到分号
+	if p.peekToken.Type == token.SEMICOLON {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// 分析struct语句，struct 名称 { 字段, ... }
+func (p *Parser) parseStructStatement() ast.Statement {
+	stmt := &ast.StructStatement{Token: p.curToken}
+
+	if !p.expectPeekAndNext(token.IDENT) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeekAndNext(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Fields = p.parseIdentifierList(token.RBRACE)
+	if stmt.Fields == nil {
+		return nil
+	}
+
+	//如果下一个token是分号，跳到分号
+	if p.peekToken.Type == token.SEMICOLON {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// 分析enum语句，enum 名称 { 变体, 变体(字段, ...), ... }
+func (p *Parser) parseEnumStatement() ast.Statement {
+	stmt := &ast.EnumStatement{Token: p.curToken}
+
+	if !p.expectPeekAndNext(token.IDENT) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeekAndNext(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Variants = []*ast.EnumVariant{}
+	for p.peekToken.Type != token.RBRACE {
+		if len(stmt.Variants) > 0 && !p.expectPeekAndNext(token.COMMA) {
+			return nil
+		}
+		if !p.expectPeekAndNext(token.IDENT) {
+			return nil
+		}
+
+		variant := &ast.EnumVariant{
+			Token: p.curToken,
+			Name:  &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal},
+		}
+		//带有字段的变体
+		if p.peekToken.Type == token.LPAREN {
+			p.nextToken()
+			variant.Fields = p.parseIdentifierList(token.RPAREN)
+			if variant.Fields == nil {
+				return nil
+			}
+		}
+		stmt.Variants = append(stmt.Variants, variant)
+	}
+	p.nextToken()
+
+	//如果下一个token是分号，跳到分号
+	if p.peekToken.Type == token.SEMICOLON {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// 分析import语句，import "路径" as 名称，省略as时使用文件名
+func (p *Parser) parseImportStatement() ast.Statement {
+	stmt := &ast.ImportStatement{Token: p.curToken}
+
+	if !p.expectPeekAndNext(token.STRING) {
+		return nil
+	}
+	stmt.Path = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekToken.Type == token.AS {
+		p.nextToken()
+		if !p.expectPeekAndNext(token.IDENT) {
+			return nil
+		}
+		stmt.Alias = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
+	//如果下一个token是分号，跳到分号
+	if p.peekToken.Type == token.SEMICOLON {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// 分析export语句，只能导出let、struct和enum
+func (p *Parser) parseExportStatement() ast.Statement {
+	stmt := &ast.ExportStatement{Token: p.curToken}
+
+	p.nextToken()
+	switch p.curToken.Type {
+	case token.LET:
+		if let := p.parseLetStatement(); let != nil {
+			stmt.Statement = let
+		}
+	case token.STRUCT:
+		stmt.Statement = p.parseStructStatement()
+	case token.ENUM:
+		stmt.Statement = p.parseEnumStatement()
+	default:
+		msg := fmt.Sprintf("只能导出let、struct或enum，却是 %s", p.curToken.Type)
+		p.errors = append(p.errors, msg)
+	}
+
+	if stmt.Statement == nil {
+		return nil
+	}
+	return stmt
+}
+
+// 分析逗号分隔的标识符列表，直到end，出错时返回nil
+func (p *Parser) parseIdentifierList(end token.TypeToken) []*ast.Identifier {
+	identifiers := []*ast.Identifier{}
+
+	if p.peekToken.Type == end {
+		p.nextToken()
+		return identifiers
+	}
+
+	if !p.expectPeekAndNext(token.IDENT) {
+		return nil
+	}
+	identifiers = append(identifiers, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+
+	for p.peekToken.Type == token.COMMA {
+		p.nextToken()
+		if !p.expectPeekAndNext(token.IDENT) {
+			return nil
+		}
+		identifiers = append(identifiers, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+	}
+
+	if !p.expectPeekAndNext(end) {
+		return nil
+	}
+
+	return identifiers
+}
+
 // 分析表达式语句
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: p.curToken} //创建表达式语句节点
@@ -236,13 +429,19 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	p.nextToken()
 
 	//解析第一个参数
-	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	ident := p.parseParameter()
+	if ident == nil {
+		return nil
+	}
 	identifiers = append(identifiers, ident)
 
 	for p.peekToken.Type == token.COMMA {
 		p.nextToken()
 		p.nextToken()
-		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		ident := p.parseParameter()
+		if ident == nil {
+			return nil
+		}
 		identifiers = append(identifiers, ident)
 	}
 
@@ -253,10 +452,38 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	return identifiers
 }
 
+// 分析一个函数参数和可选的类型注解
+func (p *Parser) parseParameter() *ast.Identifier {
+	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if p.peekToken.Type == token.COLON {
+		p.nextToken()
+		if ident.Type = p.parseTypeName(); ident.Type == nil {
+			return nil
+		}
+	}
+	return ident
+}
+
+// 分析:或->之后的类型名，类型名是标识符或fn
+func (p *Parser) parseTypeName() *ast.TypeName {
+	if p.peekToken.Type != token.IDENT && p.peekToken.Type != token.FUNCTION {
+		p.peekError(token.IDENT)
+		return nil
+	}
+	p.nextToken()
+	return &ast.TypeName{Token: p.curToken, Name: p.curToken.Literal}
+}
+
 // 分析函数表达式
 func (p *Parser) parseFunctionExpression() ast.Expression {
+	return p.parseFunction(false)
+}
+
+// 分析fn之后的函数，generator表示是否为生成器函数
+func (p *Parser) parseFunction(generator bool) ast.Expression {
 	expression := &ast.FunctionExpression{
-		Token: p.curToken,
+		Token:     p.curToken,
+		Generator: generator,
 	}
 
 	//跳到(
@@ -266,17 +493,89 @@ func (p *Parser) parseFunctionExpression() ast.Expression {
 
 	expression.Parameters = p.parseFunctionParameters()
 
+	//可选的返回类型注解
+	if p.peekToken.Type == token.ARROW {
+		p.nextToken()
+		if expression.ReturnType = p.parseTypeName(); expression.ReturnType == nil {
+			return nil
+		}
+	}
+
 	//跳过{
 	if !p.expectPeekAndNext(token.LBRACE) {
 		return nil
 	}
 
-	//解析块语句
+	//解析块语句，生成器中嵌套的函数也可以yield，运行时交给调用链上最近的生成器
+	outer := p.generator
+	p.generator = outer || generator
 	expression.Body = p.parseBlockStatement()
+	p.generator = outer
 
 	return expression
 }
 
+// 分析生成器函数，gen fn(参数) { }
+func (p *Parser) parseGeneratorExpression() ast.Expression {
+	if !p.expectPeekAndNext(token.FUNCTION) {
+		return nil
+	}
+	return p.parseFunction(true)
+}
+
+// 分析yield表达式
+func (p *Parser) parseYieldExpression() ast.Expression {
+	expression := &ast.YieldExpression{Token: p.curToken}
+	if !p.generator {
+		p.errors = append(p.errors, "yield只能在生成器函数中使用")
+		return nil
+	}
+
+	p.nextToken()
+	if expression.Value = p.parseExpression(LOWEST); expression.Value == nil {
+		return nil
+	}
+	return expression
+}
+
+// 分析spawn表达式，spawn 函数(参数)
+func (p *Parser) parseSpawnExpression() ast.Expression {
+	expression := &ast.SpawnExpression{Token: p.curToken}
+	p.nextToken()
+	call, ok := p.parseExpression(PREFIX).(*ast.CallExpression)
+	if !ok {
+		p.errors = append(p.errors, "spawn后面需要函数调用")
+		return nil
+	}
+	expression.Call = call
+	return expression
+}
+
+// 分析宏字面量
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	macro := &ast.MacroLiteral{Token: p.curToken}
+
+	//跳到(
+	if !p.expectPeekAndNext(token.LPAREN) {
+		return nil
+	}
+
+	macro.Parameters = p.parseFunctionParameters()
+
+	//跳到{
+	if !p.expectPeekAndNext(token.LBRACE) {
+		return nil
+	}
+
+	//解析块语句
+	outer := p.generator
+	p.generator = false
+	macro.Body = p.parseBlockStatement()
+	p.generator = outer
+
+	return macro
+}
+
 // 分析调用函数表达式
 func (p *Parser) parseCallFunctionExpression(function ast.Expression) ast.Expression {
 	expression := &ast.CallExpression{
@@ -330,6 +629,50 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return exprssion
 }
 
+// 分析try表达式，try { } catch (e) { } finally { }，catch与finally至少有一个
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.curToken}
+
+	//跳到{
+	if !p.expectPeekAndNext(token.LBRACE) {
+		return nil
+	}
+	expression.Body = p.parseBlockStatement()
+
+	if p.peekToken.Type == token.CATCH {
+		p.nextToken()
+		if !p.expectPeekAndNext(token.LPAREN) {
+			return nil
+		}
+		if !p.expectPeekAndNext(token.IDENT) {
+			return nil
+		}
+		expression.Param = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if !p.expectPeekAndNext(token.RPAREN) {
+			return nil
+		}
+		if !p.expectPeekAndNext(token.LBRACE) {
+			return nil
+		}
+		expression.Catch = p.parseBlockStatement()
+	}
+
+	if p.peekToken.Type == token.FINALLY {
+		p.nextToken()
+		if !p.expectPeekAndNext(token.LBRACE) {
+			return nil
+		}
+		expression.Finally = p.parseBlockStatement()
+	}
+
+	if expression.Catch == nil && expression.Finally == nil {
+		p.errors = append(p.errors, "try后面需要catch或finally")
+		return nil
+	}
+
+	return expression
+}
+
 // 分析标识符
 func (p *Parser) parseIdentifier() ast.Expression {
 	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal} //创建标识符节点
@@ -339,6 +682,13 @@ func (p *Parser) parseIdentifier() ast.Expression {
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.curToken} //创建整数节点
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+	//超出int64范围的字面量使用大整数
+	if errors.Is(err, strconv.ErrRange) {
+		if n, ok := new(big.Int).SetString(p.curToken.Literal, 0); ok {
+			lit.Big = n
+			return lit
+		}
+	}
 	if err != nil {
 		msg := fmt.Sprintf("无法解析 %q 为整数", p.curToken.Literal)
 		p.errors = append(p.errors, msg)
@@ -421,3 +771,37 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 
 	return expression
 }
+
+// 分析属性表达式，value.name，后面跟括号时由调用表达式处理成方法调用
+func (p *Parser) parsePropertyExpression(left ast.Expression) ast.Expression {
+	expression := &ast.PropertyExpression{
+		Token:  p.curToken,
+		Object: left,
+	}
+
+	if !p.expectPeekAndNext(token.IDENT) {
+		return nil
+	}
+	expression.Property = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	return expression
+}
+
+// 分析赋值表达式，目前只能给属性赋值：value.name = 表达式
+func (p *Parser) parseAssignExpression(left ast.Expression) ast.Expression {
+	expression := &ast.AssignExpression{Token: p.curToken}
+
+	target, ok := left.(*ast.PropertyExpression)
+	if !ok {
+		msg := fmt.Sprintf("不能给 %s 赋值", left.String())
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+	expression.Target = target
+
+	//右结合
+	p.nextToken()
+	expression.Value = p.parseExpression(ASSIGN - 1)
+
+	return expression
+}
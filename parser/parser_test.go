@@ -4,6 +4,7 @@ import (
 	"TroInterpreter/ast"
 	"TroInterpreter/lexer"
 	"fmt"
+	"reflect"
 	"testing"
 )
 
@@ -43,6 +44,25 @@ func TestStringLiteralExpression(t *testing.T) {
 }
 
 // 测试let
+// 测试超出int64范围的整数字面量
+func TestBigIntegerLiteral(t *testing.T) {
+	p := New(lexer.New("99999999999999999999;"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.IntegerLiteral. got=%T", stmt.Expression)
+	}
+	if literal.Big == nil || literal.Big.String() != "99999999999999999999" {
+		t.Errorf("literal.Big wrong. got=%v", literal.Big)
+	}
+	if literal.String() != "99999999999999999999" {
+		t.Errorf("literal.String() wrong. got=%q", literal.String())
+	}
+}
+
 func TestLetStatements(t *testing.T) {
 	tests := []struct {
 		input              string
@@ -239,6 +259,119 @@ func TestFunctionParameterParsing(t *testing.T) {
 	}
 }
 
+// 测试类型注解
+func TestTypeAnnotations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let n: int = 1;", "let n: int = 1;"},
+		{"let f: fn = fn(a: int, b: string) -> bool { true };", "let f: fn = func(a: int, b: string) -> bool true;"},
+		{"fn(a, b: Point) { a }", "func(a, b: Point) a"},
+		{"fn() -> fn { fn(x) { x } }", "func() -> fn func(x) x"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("program wrong. expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	errorTests := []string{
+		"let n: = 1;",
+		"fn(a: 1) { a }",
+		"fn() -> { 1 }",
+	}
+
+	for _, input := range errorTests {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", input)
+		}
+	}
+}
+
+func TestGeneratorParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"gen fn(n) { yield n + 1; }", "gen func(n) yield (n + 1)"},
+		{"gen fn() -> generator { let x = yield 1; }", "gen func() -> generator let x = yield 1;"},
+		//生成器中嵌套的函数也可以yield
+		{"gen fn() { fn() { yield 1 } }", "gen func() func() yield 1"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("program wrong. expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	errorTests := []string{
+		"yield 1;",
+		"fn() { yield 1 }",
+		"gen fn() { macro() { yield 1 } }",
+		"gen 1",
+	}
+
+	for _, input := range errorTests {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", input)
+		}
+	}
+}
+
+func TestSpawnParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"spawn f(1, 2)", "spawn f(1, 2)"},
+		{"spawn ch.send(x + 1)", "spawn ch.send((x + 1))"},
+		{"let t = spawn fn(x) { x }(1);", "let t = spawn func(x) x(1);"},
+		{"wait(spawn f()) + 1", "(wait(spawn f()) + 1)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("program wrong. expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	errorTests := []string{
+		"spawn f",
+		"spawn 1 + 2",
+		"spawn f()[0]",
+	}
+
+	for _, input := range errorTests {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", input)
+		}
+	}
+}
+
 // 测试if表达式
 func TestIfExpression(t *testing.T) {
 	input := `if (x < y) { x } else {y}`
@@ -315,6 +448,18 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"a * [1, 2, 3, 4][a * c] * d",
 			"((a * ([1, 2, 3, 4][(a * c)])) * d)",
 		},
+		{
+			"-a.b",
+			"(-a.b)",
+		},
+		{
+			"a.b(c).d[0] + 1",
+			"((a.b(c).d[0]) + 1)",
+		},
+		{
+			"xs.push(1 + 2).len()",
+			"xs.push((1 + 2)).len()",
+		},
 	}
 
 	for _, tt := range tests {
@@ -415,6 +560,335 @@ func TestParsingInfixExpressions(t *testing.T) {
 	}
 }
 
+// 测试方法调用
+func TestMethodCallParsing(t *testing.T) {
+	input := "xs.push(1, 2);"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	call, ok := stmt.Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.CallExpression. got=%T", stmt.Expression)
+	}
+
+	property, ok := call.Function.(*ast.PropertyExpression)
+	if !ok {
+		t.Fatalf("call.Function is not ast.PropertyExpression. got=%T", call.Function)
+	}
+
+	if !testIdentifier(t, property.Object, "xs") {
+		return
+	}
+	if !testIdentifier(t, property.Property, "push") {
+		return
+	}
+
+	if len(call.Arguments) != 2 {
+		t.Fatalf("wrong length of arguments. got=%d", len(call.Arguments))
+	}
+	testLiteralExpression(t, call.Arguments[0], 1)
+	testLiteralExpression(t, call.Arguments[1], 2)
+}
+
+// 测试struct语句
+func TestStructStatement(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedName   string
+		expectedFields []string
+	}{
+		{"struct Point { x, y }", "Point", []string{"x", "y"}},
+		{"struct Empty {};", "Empty", []string{}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+				len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.StructStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.StructStatement. got=%T", program.Statements[0])
+		}
+		if stmt.Name.Value != tt.expectedName {
+			t.Errorf("stmt.Name.Value not %q. got=%q", tt.expectedName, stmt.Name.Value)
+		}
+		if len(stmt.Fields) != len(tt.expectedFields) {
+			t.Fatalf("wrong number of fields. want=%d, got=%d", len(tt.expectedFields), len(stmt.Fields))
+		}
+		for i, field := range tt.expectedFields {
+			testIdentifier(t, stmt.Fields[i], field)
+		}
+	}
+}
+
+// 测试enum语句
+func TestEnumStatement(t *testing.T) {
+	input := "enum Shape { Circle(r), Rect(w, h), Empty };"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+			len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.EnumStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.EnumStatement. got=%T", program.Statements[0])
+	}
+	if stmt.Name.Value != "Shape" {
+		t.Errorf("stmt.Name.Value not %q. got=%q", "Shape", stmt.Name.Value)
+	}
+
+	expected := []struct {
+		name   string
+		fields []string
+	}{
+		{"Circle", []string{"r"}},
+		{"Rect", []string{"w", "h"}},
+		{"Empty", nil},
+	}
+	if len(stmt.Variants) != len(expected) {
+		t.Fatalf("wrong number of variants. want=%d, got=%d", len(expected), len(stmt.Variants))
+	}
+	for i, tt := range expected {
+		variant := stmt.Variants[i]
+		testIdentifier(t, variant.Name, tt.name)
+		if tt.fields == nil {
+			if variant.Fields != nil {
+				t.Errorf("variant %s should have no fields. got=%v", tt.name, variant.Fields)
+			}
+			continue
+		}
+		if len(variant.Fields) != len(tt.fields) {
+			t.Fatalf("wrong number of fields in %s. want=%d, got=%d", tt.name, len(tt.fields), len(variant.Fields))
+		}
+		for j, field := range tt.fields {
+			testIdentifier(t, variant.Fields[j], field)
+		}
+	}
+}
+
+// 测试import与export语句
+func TestModuleStatements(t *testing.T) {
+	input := `
+import "lib/math.tro" as m;
+import "util.tro";
+export let x = 1;
+export struct Point { x, y }
+`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 4 {
+		t.Fatalf("program.Statements does not contain 4 statements. got=%d",
+			len(program.Statements))
+	}
+
+	imports := []struct {
+		path string
+		name string
+	}{
+		{"lib/math.tro", "m"},
+		{"util.tro", "util"},
+	}
+	for i, tt := range imports {
+		stmt, ok := program.Statements[i].(*ast.ImportStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.ImportStatement. got=%T", program.Statements[i])
+		}
+		if stmt.Path.Value != tt.path {
+			t.Errorf("stmt.Path.Value not %q. got=%q", tt.path, stmt.Path.Value)
+		}
+		if stmt.Name() != tt.name {
+			t.Errorf("stmt.Name() not %q. got=%q", tt.name, stmt.Name())
+		}
+	}
+
+	exports := []string{"x", "Point"}
+	for i, name := range exports {
+		stmt, ok := program.Statements[i+2].(*ast.ExportStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.ExportStatement. got=%T", program.Statements[i+2])
+		}
+		if names := stmt.Names(); len(names) != 1 || names[0] != name {
+			t.Errorf("stmt.Names() not [%s]. got=%v", name, names)
+		}
+	}
+
+	p = New(lexer.New("export return 1;"))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 || p.Errors()[0] != "只能导出let、struct或enum，却是 RETURN" {
+		t.Errorf("expected export error, got=%q", p.Errors())
+	}
+}
+
+// 测试try表达式与throw语句
+func TestTryExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`try { f() } catch (e) { e.message }`, "try f() catch (e) e.message"},
+		{`try { f() } finally { g() }`, "try f() finally g()"},
+		{`let x = try { 1 } catch (e) { 2 } finally { 3 };`, "let x = try 1 catch (e) 2 finally 3;"},
+		{`throw "boom";`, `throw boom;`},
+		{`throw Err(1 + 2)`, "throw Err((1 + 2));"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	p := New(lexer.New("try { 1 }"))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 || p.Errors()[0] != "try后面需要catch或finally" {
+		t.Errorf("expected try error, got=%q", p.Errors())
+	}
+}
+
+// 测试赋值表达式
+func TestAssignExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"p.x = 1 + 2", "(p.x = (1 + 2))"},
+		{"a.x = b.y = 3", "(a.x = (b.y = 3))"},
+		{"p.x = p.x == 1", "(p.x = (p.x == 1))"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	p := New(lexer.New("x = 1"))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 || p.Errors()[0] != "不能给 x 赋值" {
+		t.Errorf("expected assign error, got=%q", p.Errors())
+	}
+}
+
+// 测试宏字面量
+func TestMacroLiteralParsing(t *testing.T) {
+	input := `macro(x, y) { x + y; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("statement is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	macro, ok := stmt.Expression.(*ast.MacroLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MacroLiteral. got=%T",
+			stmt.Expression)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("macro literal parameters wrong. want 2, got=%d\n",
+			len(macro.Parameters))
+	}
+
+	testLiteralExpression(t, macro.Parameters[0], "x")
+	testLiteralExpression(t, macro.Parameters[1], "y")
+
+	if len(macro.Body.Statements) != 1 {
+		t.Fatalf("macro.Body.Statements has not 1 statements. got=%d\n",
+			len(macro.Body.Statements))
+	}
+
+	bodyStmt, ok := macro.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("macro body stmt is not ast.ExpressionStatement. got=%T",
+			macro.Body.Statements[0])
+	}
+
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+}
+
+// 测试ast的json编码能还原出相同的程序
+func TestJSONRoundTrip(t *testing.T) {
+	input := `
+let add = fn(a, b) { return a + b; };
+let xs = [1, "two", true];
+if (!(xs[0] < 2)) { add(1, -2) } else { xs };
+let m = macro(x) { quote(unquote(x)) };
+fn() {};
+struct Point { x, y }
+let p = Point(1, 2);
+p.x = p.y.len();
+enum Option { Some(value), None }
+import "lib.tro" as lib;
+export let y = lib.x;
+let r = try { throw "e"; } catch (e) { e.message } finally { 1 };
+let big = 99999999999999999999 + 1;
+let typed: fn = fn(a: int, b) -> Point { Point(a, b) };
+let g = gen fn(n) -> generator { yield n + 1; };
+let t = spawn ch.send(1);
+`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	data, err := ast.EncodeJSON(program)
+	if err != nil {
+		t.Fatalf("EncodeJSON returned error: %s", err)
+	}
+
+	decoded, err := ast.DecodeJSON(data)
+	if err != nil {
+		t.Fatalf("DecodeJSON returned error: %s", err)
+	}
+
+	if !reflect.DeepEqual(decoded, program) {
+		t.Fatalf("decoded program not equal.\nwant=%s\ngot= %s", program, decoded)
+	}
+}
+
 // 辅助函数
 func checkParserErrors(t *testing.T, p *Parser) {
 	errors := p.errors
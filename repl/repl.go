@@ -1,17 +1,24 @@
 package repl
 
 import (
+	"TroInterpreter/ast"
+	"TroInterpreter/compiler"
 	"TroInterpreter/evaluator"
 	"TroInterpreter/lexer"
 	"TroInterpreter/object"
 	"TroInterpreter/parser"
+	"TroInterpreter/vm"
 	"bufio"
 	"fmt"
 	"io"
+	"strings"
 )
 
 const PROMPT = ">> "
 
+// 输入不完整时的续行提示符
+const CONTINUE_PROMPT = ".. "
+
 func printParserError(out io.Writer, err []string) {
 	io.WriteString(out, "解析错误:\n")
 	for _, msg := range err {
@@ -19,20 +26,95 @@ func printParserError(out io.Writer, err []string) {
 	}
 }
 
+// Start 启动交互式环境，使用求值器
 func Start(in io.Reader, out io.Writer) {
+	start(in, out, newEvaluatorBackend())
+}
+
+// StartVM 启动交互式环境，把每次输入编译为字节码在虚拟机中执行
+func StartVM(in io.Reader, out io.Writer) {
+	start(in, out, newVMBackend())
+}
+
+// 执行宏展开后的程序，每次输入共用之前的状态
+type backend interface {
+	run(program *ast.Program) (object.Object, error)
+}
+
+// 求值器
+type evaluatorBackend struct {
+	env *object.Environment
+}
+
+func newEvaluatorBackend() *evaluatorBackend {
+	env := object.NewEnvironment()
+	env.Runtime().SearchPath = evaluator.DefaultSearchPath()
+	return &evaluatorBackend{env: env}
+}
+
+func (b *evaluatorBackend) run(program *ast.Program) (object.Object, error) {
+	return evaluator.Eval(evaluator.Resolve(program), b.env), nil
+}
+
+// 字节码虚拟机，符号表、常量池和全局变量在每次输入之间保留
+type vmBackend struct {
+	env         *object.Environment
+	symbolTable *compiler.SymbolTable
+	constants   []object.Object
+	globals     *vm.Globals
+}
+
+func newVMBackend() *vmBackend {
+	env := object.NewEnvironment()
+	env.Runtime().SearchPath = evaluator.DefaultSearchPath()
+	return &vmBackend{
+		env:         env,
+		symbolTable: compiler.NewSymbolTable(),
+		constants:   []object.Object{},
+		globals:     vm.NewGlobals(),
+	}
+}
+
+func (b *vmBackend) run(program *ast.Program) (object.Object, error) {
+	c := compiler.NewWithState(b.symbolTable, b.constants)
+	err := c.Compile(program)
+	bytecode := c.Bytecode()
+	b.constants = bytecode.Constants
+	if err != nil {
+		return nil, err
+	}
+
+	machine := vm.NewWithGlobals(bytecode, b.env, b.globals)
+	result := machine.Run()
+	b.globals = machine.Globals()
+	return result, nil
+}
+
+func start(in io.Reader, out io.Writer, backend backend) {
 	//创建输入输出流
 	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
+	macroEnv := object.NewEnvironment()
+	var input string
 	for {
-		fmt.Fprintf(out, PROMPT)
+		if input == "" {
+			fmt.Fprintf(out, PROMPT)
+		} else {
+			fmt.Fprintf(out, CONTINUE_PROMPT)
+		}
 		//读取输入
 		scanned := scanner.Scan()
 		if !scanned {
 			return
 		}
 
-		//解析输入
-		line := scanner.Text()
+		//拼接多行输入，直到语句完整
+		input += scanner.Text() + "\n"
+		if !isComplete(input) {
+			continue
+		}
+		line := input
+		input = ""
+
 		//创建词法分析器
 		l := lexer.New(line)
 		//创建语法分析器
@@ -45,11 +127,55 @@ func Start(in io.Reader, out io.Writer) {
 			continue
 		}
 
-		//求值器
-		evaluated := evaluator.Eval(program, env)
+		//宏展开
+		evaluator.DefineMacros(program, macroEnv)
+		expanded, err := evaluator.ExpandMacros(program, macroEnv)
+		if err != nil {
+			io.WriteString(out, "宏错误: "+err.Error()+"\n")
+			continue
+		}
+
+		//执行
+		evaluated, err := backend.run(expanded.(*ast.Program))
+		if err != nil {
+			io.WriteString(out, "编译错误: "+err.Error()+"\n")
+			continue
+		}
+		if err, ok := evaluated.(*object.Error); ok {
+			io.WriteString(out, err.Traceback())
+			io.WriteString(out, "\n")
+			continue
+		}
 		if evaluated != nil {
 			io.WriteString(out, evaluated.Inspect())
 			io.WriteString(out, "\n")
 		}
 	}
 }
+
+// 判断输入是否完整：括号都已闭合，字符串也已结束
+// 多出来的右括号视为完整，交给语法分析器报错
+func isComplete(input string) bool {
+	depth := 0
+	for i := 0; i < len(input); i++ {
+		switch ch := input[i]; {
+		case ch == '"':
+			end := strings.IndexByte(input[i+1:], '"')
+			if end < 0 {
+				return false
+			}
+			i += end + 1
+		case ch == '/' && i+1 < len(input) && input[i+1] == '/':
+			end := strings.IndexByte(input[i:], '\n')
+			if end < 0 {
+				return depth <= 0
+			}
+			i += end
+		case ch == '(' || ch == '[' || ch == '{':
+			depth++
+		case ch == ')' || ch == ']' || ch == '}':
+			depth--
+		}
+	}
+	return depth <= 0
+}
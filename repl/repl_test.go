@@ -0,0 +1,55 @@
+package repl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestIsComplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"let x = 1;\n", true},
+		{"let f = fn(x) {\n", false},
+		{"let f = fn(x) {\nx\n}\n", true},
+		{"add(1,\n", false},
+		{"[1, 2,\n", false},
+		{"let s = \"abc\n", false},
+		{"let s = \"a{c\";\n", true},
+		{"let s = \"a\nb\";\n", true},
+		{"let x = 1; // {\n", true},
+		{"}\n", true},
+	}
+
+	for _, tt := range tests {
+		if got := isComplete(tt.input); got != tt.expected {
+			t.Errorf("isComplete(%q) wrong. want=%t, got=%t", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestStartMultiLine(t *testing.T) {
+	input := "let add = fn(a, b) {\n  a + b\n};\nadd(1,\n2)\n"
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	expected := PROMPT + CONTINUE_PROMPT + CONTINUE_PROMPT + PROMPT + CONTINUE_PROMPT + "3\n" + PROMPT
+	if out.String() != expected {
+		t.Errorf("wrong output.\nwant=%q\ngot= %q", expected, out.String())
+	}
+}
+
+func TestStartVMMatchesStart(t *testing.T) {
+	input := "let f = fn() { g() };\nlet g = fn() {\n  42\n};\nf()\nmissing\nlet x = 1;\nx + 1\n"
+
+	var want, got bytes.Buffer
+	Start(strings.NewReader(input), &want)
+	StartVM(strings.NewReader(input), &got)
+
+	if got.String() != want.String() {
+		t.Errorf("wrong output.\nwant=%q\ngot= %q", want.String(), got.String())
+	}
+}
@@ -5,16 +5,31 @@ type TypeToken string
 type Token struct {
 	Type    TypeToken //token类型
 	Literal string    //token字面量
+	Line    int       //所在行，从1开始
+	Column  int       //所在列，从1开始
 }
 
 var keywords = map[string]TypeToken{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
+	"fn":      FUNCTION,
+	"let":     LET,
+	"true":    TRUE,
+	"false":   FALSE,
+	"if":      IF,
+	"else":    ELSE,
+	"return":  RETURN,
+	"macro":   MACRO,
+	"struct":  STRUCT,
+	"enum":    ENUM,
+	"import":  IMPORT,
+	"export":  EXPORT,
+	"as":      AS,
+	"try":     TRY,
+	"catch":   CATCH,
+	"finally": FINALLY,
+	"throw":   THROW,
+	"gen":     GEN,
+	"yield":   YIELD,
+	"spawn":   SPAWN,
 }
 
 func LookupIdent(ident string) TypeToken {
@@ -29,6 +44,7 @@ const (
 	// 特殊标记
 	ILLEGAL = "ILLEGAL" //非法字符，表示遇到未知的词法单元
 	EOF     = "EOF"     //文件结束，通知语法分析器停机
+	COMMENT = "COMMENT" //注释，语法分析器不会看到
 	// 运算符
 	ASSIGN = "="  //赋值
 	PLUS   = "+"  //加法
@@ -40,8 +56,11 @@ const (
 	GT     = ">"  //大于
 	EQ     = "==" //等于
 	NOT_EQ = "!=" //不等于
+	ARROW  = "->" //返回类型
 	// 分隔符
 	COMMA     = "," //逗号
+	DOT       = "." //点
+	COLON     = ":" //冒号，类型注解
 	SEMICOLON = ";" //分号
 	LPAREN    = "(" //左括号
 	RPAREN    = ")" //右括号
@@ -59,6 +78,19 @@ const (
 	IF       = "IF"       //if
 	ELSE     = "ELSE"     //else
 	RETURN   = "RETURN"   //return
+	MACRO    = "MACRO"    //宏
+	STRUCT   = "STRUCT"   //结构体
+	ENUM     = "ENUM"     //枚举
+	IMPORT   = "IMPORT"   //导入模块
+	EXPORT   = "EXPORT"   //导出
+	AS       = "AS"       //别名
+	TRY      = "TRY"      //try
+	CATCH    = "CATCH"    //catch
+	FINALLY  = "FINALLY"  //finally
+	THROW    = "THROW"    //抛出异常
+	GEN      = "GEN"      //生成器函数
+	YIELD    = "YIELD"    //生成器交出值
+	SPAWN    = "SPAWN"    //在新的任务中调用函数
 	NUMBER   = "NUMBER"   //数字
 	STRING   = "STRING"   //字符串
 )
@@ -0,0 +1,546 @@
+package typecheck
+
+import (
+	"TroInterpreter/ast"
+	"TroInterpreter/evaluator"
+	"TroInterpreter/object"
+	"fmt"
+	"sort"
+)
+
+// Error 类型检查发现的一个错误
+type Error struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e Error) String() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+// 静态类型，name与evaluator.TypeOf的结果相同，为空表示未知
+// annotated表示类型来自注解(变量、参数的注解或带返回类型的函数的调用结果)，只有它参与运算时才报告运算的类型错误
+type typ struct {
+	name      string
+	annotated bool
+	fn        *signature // 已知签名的函数
+	construct string     // 结构体类型和有字段的变体，调用得到的值的类型
+	enum      string     // 枚举，通过属性得到其中的变体
+}
+
+// 函数签名，result为返回类型注解，没有注解时为空；内置函数的返回类型不是注解
+type signature struct {
+	params  []*ast.Identifier
+	result  string
+	builtin bool
+}
+
+// 内置函数返回值的类型
+var builtinResults = map[string]string{
+	"len":     "int",
+	"push":    "array",
+	"is":      "bool",
+	"tag":     "string",
+	"help":    "string",
+	"channel": "channel",
+	"select":  "array",
+}
+
+// 用来推断运算结果类型的样本值，运算的结果只与操作数的类型有关
+var samples = map[string]func() object.Object{
+	"int":    func() object.Object { return &object.Integer{Value: 1} },
+	"string": func() object.Object { return &object.String{Value: "a"} },
+	"bool":   func() object.Object { return evaluator.TRUE },
+	"null":   func() object.Object { return evaluator.NULL },
+	"array":  func() object.Object { return &object.Array{} },
+}
+
+// 作用域中的变量
+type binding struct {
+	declared string // 类型注解，没有注解时为空
+	typ      typ    // 当前的类型
+	lets     int    // 作用域中let的次数，只有一次且不在分支中时才根据初始值推断类型
+}
+
+// 静态作用域，与求值器一致：程序顶层、函数体和catch块各是一个作用域，块不产生新的作用域
+type scope struct {
+	outer    *scope
+	bindings map[string]*binding
+}
+
+func (s *scope) lookup(name string) *binding {
+	for ; s != nil; s = s.outer {
+		if b, ok := s.bindings[name]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+// 检查器
+type checker struct {
+	scope   *scope
+	returns []string                      // 从外到内所在函数的返回类型注解
+	types   map[string]bool               // 程序中声明的结构体和枚举
+	enums   map[string]*ast.EnumStatement // 程序中声明的枚举
+	imports bool                          // 程序导入了模块，其中可能声明了结构体和枚举
+	runtime *object.Runtime               // 计算样本值时使用的运行时
+	errors  []Error
+}
+
+// Check 检查宏展开之后的程序，按位置顺序返回发现的类型错误
+// 检查是渐进的：没有注解的值类型未知，与任何类型都相容；字面量、运算、内置函数和带返回类型的函数调用的类型可以推断，
+// 只报告与注解不符的值(let的初始值、调用的实参、函数的返回值)，以及注解类型的值参与的运算一定会出错的情况，
+// 所以没有注解的程序不会报告错误
+func Check(program *ast.Program) []Error {
+	c := &checker{
+		types:   map[string]bool{},
+		enums:   map[string]*ast.EnumStatement{},
+		runtime: object.NewRuntime(),
+	}
+	c.declarations(program)
+
+	c.enterScope()
+	c.hoist(program, false)
+	c.statements(program.Statements)
+	c.scope = c.scope.outer
+
+	sort.SliceStable(c.errors, func(i, j int) bool {
+		a, b := c.errors[i], c.errors[j]
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	return c.errors
+}
+
+func (c *checker) report(node ast.Node, format string, a ...interface{}) {
+	line, column := ast.Position(node)
+	c.errors = append(c.errors, Error{Line: line, Column: column, Message: fmt.Sprintf(format, a...)})
+}
+
+// 收集程序中声明的结构体和枚举，类型注解可以使用它们的名称
+func (c *checker) declarations(program *ast.Program) {
+	ast.Modify(program, func(node ast.Node) ast.Node {
+		switch node := node.(type) {
+		case *ast.StructStatement:
+			c.types[node.Name.Value] = true
+		case *ast.EnumStatement:
+			c.types[node.Name.Value] = true
+			c.enums[node.Name.Value] = node
+		case *ast.ImportStatement:
+			c.imports = true
+		}
+		return node
+	})
+}
+
+// 注解的类型，没有注解或为any时为空
+func annotation(t *ast.TypeName) string {
+	if t == nil || t.Name == "any" {
+		return ""
+	}
+	return t.Name
+}
+
+// 检查类型注解中的名称，返回注解的类型，未知的类型当作any
+func (c *checker) typeName(t *ast.TypeName) string {
+	if t != nil && !evaluator.IsBuiltinType(t.Name) && !c.types[t.Name] && !c.imports {
+		c.report(t, "未知的类型 %s", t.Name)
+		return ""
+	}
+	return annotation(t)
+}
+
+// 判断值的类型是否符合注解，任何一方未知时都相容
+func compatible(expected string, actual typ) bool {
+	return expected == "" || actual.name == "" || expected == actual.name
+}
+
+func (c *checker) enterScope() {
+	c.scope = &scope{outer: c.scope, bindings: map[string]*binding{}}
+}
+
+// 在当前作用域中声明变量，已经声明过时返回原来的变量
+func (c *checker) declare(name string) *binding {
+	b, ok := c.scope.bindings[name]
+	if !ok {
+		b = &binding{}
+		c.scope.bindings[name] = b
+	}
+	return b
+}
+
+// 提前声明node中属于当前作用域的变量，不进入函数、catch块和quote
+// branch表示在if或try的分支中，其中的let不一定执行，不据此推断类型
+func (c *checker) hoist(node ast.Node, branch bool) {
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, statement := range node.Statements {
+			c.hoist(statement, branch)
+		}
+	case *ast.BlockStatement:
+		for _, statement := range node.Statements {
+			c.hoist(statement, branch)
+		}
+	case *ast.ExpressionStatement:
+		c.hoist(node.Expression, branch)
+	case *ast.LetStatement:
+		c.hoist(node.Value, branch)
+		b := c.declare(node.Name.Value)
+		b.lets++
+		if branch {
+			b.lets++
+		}
+		if b.declared == "" {
+			b.declared = annotation(node.Name.Type)
+		}
+	case *ast.ReturnStatement:
+		c.hoist(node.ReturnValue, branch)
+	case *ast.ThrowStatement:
+		c.hoist(node.Value, branch)
+	case *ast.YieldExpression:
+		c.hoist(node.Value, branch)
+	case *ast.SpawnExpression:
+		c.hoist(node.Call, branch)
+	case *ast.StructStatement:
+		b := c.declare(node.Name.Value)
+		b.typ = typ{name: "struct_type", construct: node.Name.Value}
+	case *ast.EnumStatement:
+		b := c.declare(node.Name.Value)
+		b.typ = typ{name: "enum", enum: node.Name.Value}
+	case *ast.ImportStatement:
+		c.declare(node.Name())
+	case *ast.ExportStatement:
+		c.hoist(node.Statement, branch)
+	case *ast.PrefixExpression:
+		c.hoist(node.Right, branch)
+	case *ast.InfixExpression:
+		c.hoist(node.Left, branch)
+		c.hoist(node.Right, branch)
+	case *ast.IndexExpression:
+		c.hoist(node.Left, branch)
+		c.hoist(node.Index, branch)
+	case *ast.PropertyExpression:
+		c.hoist(node.Object, branch)
+	case *ast.AssignExpression:
+		c.hoist(node.Target.Object, branch)
+		c.hoist(node.Value, branch)
+	case *ast.ArrayLiteral:
+		for _, element := range node.Elements {
+			c.hoist(element, branch)
+		}
+	case *ast.IfExpression:
+		c.hoist(node.Condition, branch)
+		c.hoist(node.Consequence, true)
+		if node.Alternative != nil {
+			c.hoist(node.Alternative, true)
+		}
+	case *ast.TryExpression:
+		c.hoist(node.Body, true)
+		if node.Finally != nil {
+			c.hoist(node.Finally, branch)
+		}
+	case *ast.CallExpression:
+		if isQuote(node) {
+			return
+		}
+		c.hoist(node.Function, branch)
+		for _, argument := range node.Arguments {
+			c.hoist(argument, branch)
+		}
+	}
+}
+
+func (c *checker) statements(statements []ast.Statement) {
+	for _, statement := range statements {
+		c.statement(statement)
+	}
+}
+
+func (c *checker) statement(statement ast.Statement) {
+	switch node := statement.(type) {
+	case *ast.ExpressionStatement:
+		c.expression(node.Expression)
+	case *ast.LetStatement:
+		c.let(node)
+	case *ast.ReturnStatement:
+		t := c.expression(node.ReturnValue)
+		if n := len(c.returns); n > 0 {
+			c.checkResult(node.ReturnValue, c.returns[n-1], t)
+		}
+	case *ast.ThrowStatement:
+		c.expression(node.Value)
+	case *ast.ExportStatement:
+		c.statement(node.Statement)
+	}
+}
+
+func (c *checker) let(node *ast.LetStatement) {
+	t := c.expression(node.Value)
+	b := c.scope.bindings[node.Name.Value]
+	if b == nil {
+		return
+	}
+
+	//同名变量的注解对作用域中所有的let都有效
+	expected := b.declared
+	if node.Name.Type != nil {
+		expected = c.typeName(node.Name.Type)
+	}
+	if expected == "" {
+		if b.declared == "" && b.lets == 1 {
+			b.typ = t
+		}
+		return
+	}
+
+	if !compatible(expected, t) {
+		c.report(node.Value, "变量 %s 类型错误，期望=%s，实际=%s", node.Name.Value, expected, t.name)
+	}
+	if t.name == expected {
+		b.typ = t
+	} else {
+		b.typ = typ{name: expected}
+	}
+	b.typ.annotated = true
+}
+
+func (c *checker) checkResult(node ast.Node, expected string, actual typ) {
+	if !compatible(expected, actual) {
+		c.report(node, "返回值类型错误，期望=%s，实际=%s", expected, actual.name)
+	}
+}
+
+// 检查块，返回块的值的类型；result为函数的返回类型注解，块的值是函数的返回值时不为空
+func (c *checker) block(block *ast.BlockStatement, result string) typ {
+	if block == nil || len(block.Statements) == 0 {
+		return typ{}
+	}
+	c.statements(block.Statements[:len(block.Statements)-1])
+
+	last, ok := block.Statements[len(block.Statements)-1].(*ast.ExpressionStatement)
+	if !ok {
+		c.statement(block.Statements[len(block.Statements)-1])
+		return typ{}
+	}
+	//if的每个分支分别检查返回值
+	if ie, ok := last.Expression.(*ast.IfExpression); ok && result != "" {
+		return c.ifExpression(ie, result)
+	}
+	t := c.expression(last.Expression)
+	if result != "" {
+		c.checkResult(last.Expression, result, t)
+	}
+	return t
+}
+
+func (c *checker) ifExpression(node *ast.IfExpression, result string) typ {
+	c.expression(node.Condition)
+	consequence := c.block(node.Consequence, result)
+	if node.Alternative == nil {
+		return typ{}
+	}
+	alternative := c.block(node.Alternative, result)
+	if consequence.name != alternative.name {
+		return typ{}
+	}
+	return typ{name: consequence.name, annotated: consequence.annotated && alternative.annotated}
+}
+
+func (c *checker) expression(expression ast.Expression) typ {
+	switch node := expression.(type) {
+	case *ast.IntegerLiteral:
+		return typ{name: "int"}
+	case *ast.StringLiteral:
+		return typ{name: "string"}
+	case *ast.Boolean:
+		return typ{name: "bool"}
+
+	case *ast.Identifier:
+		if b := c.scope.lookup(node.Value); b != nil {
+			return b.typ
+		}
+		if evaluator.Builtin(node.Value) != nil {
+			return typ{name: "fn", fn: &signature{result: builtinResults[node.Value], builtin: true}}
+		}
+
+	case *ast.ArrayLiteral:
+		for _, element := range node.Elements {
+			c.expression(element)
+		}
+		return typ{name: "array"}
+
+	case *ast.PrefixExpression:
+		right := c.expression(node.Right)
+		if sample, ok := samples[right.name]; ok {
+			return c.operation(node, evaluator.Prefix(node.Operator, sample(), c.runtime), right.annotated)
+		}
+
+	case *ast.InfixExpression:
+		left, right := c.expression(node.Left), c.expression(node.Right)
+		leftSample, ok := samples[left.name]
+		rightSample, ok2 := samples[right.name]
+		if ok && ok2 {
+			return c.operation(node, evaluator.Infix(node.Operator, leftSample(), rightSample(), c.runtime), left.annotated || right.annotated)
+		}
+
+	case *ast.IndexExpression:
+		c.expression(node.Left)
+		c.expression(node.Index)
+
+	case *ast.PropertyExpression:
+		return c.property(node)
+
+	case *ast.AssignExpression:
+		c.expression(node.Target.Object)
+		return c.expression(node.Value)
+
+	case *ast.IfExpression:
+		return c.ifExpression(node, "")
+
+	case *ast.TryExpression:
+		c.block(node.Body, "")
+		if node.Catch != nil {
+			c.enterScope()
+			c.declare(node.Param.Value).lets = 2
+			c.hoist(node.Catch, false)
+			c.block(node.Catch, "")
+			c.scope = c.scope.outer
+		}
+		c.block(node.Finally, "")
+
+	case *ast.FunctionExpression:
+		if node.Generator {
+			return c.generator(node)
+		}
+		return c.function(node.Parameters, node.ReturnType, node.Body)
+
+	case *ast.MacroLiteral:
+		c.function(node.Parameters, nil, node.Body)
+
+	case *ast.YieldExpression:
+		//恢复后yield的值总是null
+		c.expression(node.Value)
+		return typ{name: "null"}
+
+	case *ast.SpawnExpression:
+		//函数的结果要通过wait获取
+		c.call(node.Call)
+		return typ{name: "task"}
+
+	case *ast.CallExpression:
+		return c.call(node)
+	}
+	return typ{}
+}
+
+// 运算的结果类型，样本值运算出错时类型未知，有注解类型的操作数时报告错误
+func (c *checker) operation(node ast.Node, result object.Object, annotated bool) typ {
+	if err, ok := result.(*object.Error); ok {
+		if annotated {
+			c.report(node, "%s", err.Message)
+		}
+		return typ{}
+	}
+	return typ{name: evaluator.TypeOf(result), annotated: annotated}
+}
+
+func (c *checker) property(node *ast.PropertyExpression) typ {
+	return c.variant(c.expression(node.Object), node.Property.Value)
+}
+
+// 枚举的变体：有字段时是构造函数，否则是枚举的值；不是枚举时类型未知
+func (c *checker) variant(object typ, name string) typ {
+	enum, ok := c.enums[object.enum]
+	if !ok {
+		return typ{}
+	}
+	for _, variant := range enum.Variants {
+		if variant.Name.Value != name {
+			continue
+		}
+		if variant.Fields != nil {
+			return typ{name: "variant_type", construct: enum.Name.Value}
+		}
+		return typ{name: enum.Name.Value}
+	}
+	return typ{}
+}
+
+func (c *checker) function(parameters []*ast.Identifier, returnType *ast.TypeName, body *ast.BlockStatement) typ {
+	c.enterScope()
+	for _, param := range parameters {
+		b := c.declare(param.Value)
+		b.lets++
+		if param.Type != nil {
+			b.declared = c.typeName(param.Type)
+			b.typ = typ{name: b.declared, annotated: true}
+		}
+	}
+	c.hoist(body, false)
+
+	result := c.typeName(returnType)
+	c.returns = append(c.returns, result)
+	c.block(body, result)
+	c.returns = c.returns[:len(c.returns)-1]
+	c.scope = c.scope.outer
+
+	return typ{name: "fn", fn: &signature{params: parameters, result: result}}
+}
+
+// 生成器函数：调用得到生成器，返回类型注解检查的是生成器本身，函数体中的return不检查
+func (c *checker) generator(node *ast.FunctionExpression) typ {
+	result := c.typeName(node.ReturnType)
+	if result != "" && !compatible(result, typ{name: "generator"}) {
+		c.report(node.ReturnType, "返回值类型错误，期望=%s，实际=generator", result)
+	}
+
+	t := c.function(node.Parameters, nil, node.Body)
+	t.fn.result = "generator"
+	return t
+}
+
+func (c *checker) call(node *ast.CallExpression) typ {
+	//quote的参数不求值，只有unquote的参数在当前作用域中求值
+	if isQuote(node) {
+		for _, argument := range evaluator.UnquoteArguments(node) {
+			c.expression(argument)
+		}
+		return typ{}
+	}
+
+	//方法调用的目标在运行时才能确定，只有枚举的变体是已知的
+	var function typ
+	if property, ok := node.Function.(*ast.PropertyExpression); ok {
+		function = c.variant(c.expression(property.Object), property.Property.Value)
+	} else {
+		function = c.expression(node.Function)
+	}
+
+	args := make([]typ, len(node.Arguments))
+	for i, argument := range node.Arguments {
+		args[i] = c.expression(argument)
+	}
+
+	switch {
+	case function.fn != nil:
+		for i, param := range function.fn.params {
+			if param.Type == nil || i >= len(args) {
+				continue
+			}
+			if expected := param.Type.Name; expected != "any" && !compatible(expected, args[i]) {
+				c.report(node.Arguments[i], "参数 %s 类型错误，期望=%s，实际=%s", param.Value, expected, args[i].name)
+			}
+		}
+		if function.fn.result != "" {
+			return typ{name: function.fn.result, annotated: !function.fn.builtin}
+		}
+	case function.construct != "":
+		return typ{name: function.construct}
+	}
+	return typ{}
+}
+
+func isQuote(node *ast.CallExpression) bool {
+	return node.Function.TokenLiteral() == "quote"
+}
@@ -0,0 +1,82 @@
+package typecheck
+
+import (
+	"TroInterpreter/lexer"
+	"TroInterpreter/parser"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		//没有注解的程序不报告错误
+		{`let x = 1; x + "a"; try { 1 + "a" } catch (e) { e }`, nil},
+		{`let n: int = 1; let s: string = "a"; let b: bool = n > 0; let xs: array = [n, s]`, nil},
+		{`let n: int = "a"`, []string{"1:14: 变量 n 类型错误，期望=int，实际=string"}},
+		{`let n: any = "a"; let f: fn = len; let p: null = 1`, []string{"1:50: 变量 p 类型错误，期望=null，实际=int"}},
+		{`let f = fn(a: int, b: string) -> bool { a > 0 }; f("x", 1); let r: string = f(1, "a")`, []string{
+			"1:52: 参数 a 类型错误，期望=int，实际=string",
+			"1:57: 参数 b 类型错误，期望=string，实际=int",
+			"1:78: 变量 r 类型错误，期望=string，实际=bool",
+		}},
+		{`let f = fn(n: int) -> int { if (n > 0) { "pos" } else { return true; } }`, []string{
+			"1:42: 返回值类型错误，期望=int，实际=string",
+			"1:64: 返回值类型错误，期望=int，实际=bool",
+		}},
+		{`let f = fn(n: int) { n + "a" }; let g = fn(s: string) { -s }`, []string{
+			"1:24: 类型不匹配: INTEGER + STRING",
+			"1:57: 错误操作符: -STRING",
+		}},
+		//推断的类型
+		{`let x = 1; let f = fn(a: string) { a }; f(x); f(len("a")); f(x + 1)`, []string{
+			"1:43: 参数 a 类型错误，期望=string，实际=int",
+			"1:52: 参数 a 类型错误，期望=string，实际=int",
+			"1:64: 参数 a 类型错误，期望=string，实际=int",
+		}},
+		//在分支中或多次声明的变量类型未知
+		{`let x = 1; if (true) { let x = "s"; } let f = fn(a: int) { a }; f(x)`, nil},
+		{`let f = fn(a: int) { a }; let g = fn(b) { f(b) }; f(g(1))`, nil},
+		{`struct Point { x, y } let p: Point = Point(1, 2); let q: Point = 1; let r: Pointt = 1`, []string{
+			"1:66: 变量 q 类型错误，期望=Point，实际=int",
+			"1:76: 未知的类型 Pointt",
+		}},
+		{`enum Shape { Circle(r), Empty } let s: Shape = Shape.Circle(1); let e: int = Shape.Empty; let c: fn = Shape.Circle`, []string{
+			"1:83: 变量 e 类型错误，期望=int，实际=Shape",
+			"1:108: 变量 c 类型错误，期望=fn，实际=variant_type",
+		}},
+		{`import "lib/geo.tro"; let p: Point = geo.origin()`, nil},
+		{`let f = fn() -> int { let g = fn() -> string { "s" }; g() }`, []string{"1:56: 返回值类型错误，期望=int，实际=string"}},
+		//生成器函数的返回类型是生成器本身，yield的值为null
+		{`let f = gen fn(n: int) -> generator { yield n; return "s"; }; let g: generator = f(1); let h = gen fn() -> int { let x: int = yield 1; }`, []string{
+			"1:108: 返回值类型错误，期望=int，实际=generator",
+			"1:127: 变量 x 类型错误，期望=int，实际=null",
+		}},
+		{`let f = gen fn() { yield 1; }; let n: int = f()`, []string{"1:46: 变量 n 类型错误，期望=int，实际=generator"}},
+		//spawn的值是任务，函数的参数照常检查
+		{`let f = fn(n: int) -> int { n }; let t: task = spawn f("s"); let n: int = spawn f(1); let c: channel = channel()`, []string{
+			"1:56: 参数 n 类型错误，期望=int，实际=string",
+			"1:75: 变量 n 类型错误，期望=int，实际=task",
+		}},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("%q: parser errors: %v", tt.input, p.Errors())
+		}
+
+		errors := Check(program)
+		if len(errors) != len(tt.expected) {
+			t.Errorf("%q: wrong errors. want=%q, got=%v", tt.input, tt.expected, errors)
+			continue
+		}
+		for i, err := range errors {
+			if err.String() != tt.expected[i] {
+				t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected[i], err.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,385 @@
+package vet
+
+import (
+	"TroInterpreter/ast"
+	"TroInterpreter/evaluator"
+	"TroInterpreter/typecheck"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Diagnostic 检查发现的一个问题
+type Diagnostic struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s", d.Line, d.Column, d.Message)
+}
+
+// 声明的种类，只有let和参数会报告未使用
+type kind int
+
+const (
+	letBinding kind = iota
+	parameter
+	other
+)
+
+// 作用域中声明的变量
+type binding struct {
+	ident *ast.Identifier
+	kind  kind
+	used  bool
+}
+
+// 静态作用域，与求值器一致：程序顶层、函数体(包括宏)和catch块各是一个作用域，块不产生新的作用域
+type scope struct {
+	outer    *scope
+	bindings map[string]*binding
+	order    []*binding
+}
+
+func (s *scope) declare(ident *ast.Identifier, k kind) {
+	if _, ok := s.bindings[ident.Value]; ok {
+		return
+	}
+	b := &binding{ident: ident, kind: k}
+	s.bindings[ident.Value] = b
+	s.order = append(s.order, b)
+}
+
+func (s *scope) lookup(name string) *binding {
+	for ; s != nil; s = s.outer {
+		if b, ok := s.bindings[name]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+// 检查器
+type checker struct {
+	scope       *scope
+	diagnostics []Diagnostic
+}
+
+// Check 静态检查宏展开之前的程序，按位置顺序返回发现的问题：
+// 未定义的标识符、未使用的局部变量和参数、遮蔽内置函数的声明、return之后不会执行的代码、调用内置函数时参数数量错误，
+// 以及typecheck.Check发现的类型错误
+// 以_开头的变量和参数不报告未使用；quote的参数是代码，只检查其中unquote的参数
+func Check(program *ast.Program) []Diagnostic {
+	c := &checker{}
+	c.enterScope()
+	c.hoist(program)
+	c.statements(program.Statements)
+	//顶层的变量可能被导入者或之后的输入使用，不报告未使用
+	c.scope = c.scope.outer
+
+	for _, err := range typecheck.Check(program) {
+		c.diagnostics = append(c.diagnostics, Diagnostic(err))
+	}
+
+	sort.SliceStable(c.diagnostics, func(i, j int) bool {
+		a, b := c.diagnostics[i], c.diagnostics[j]
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	return c.diagnostics
+}
+
+func (c *checker) report(node ast.Node, format string, a ...interface{}) {
+	line, column := ast.Position(node)
+	c.diagnostics = append(c.diagnostics, Diagnostic{Line: line, Column: column, Message: fmt.Sprintf(format, a...)})
+}
+
+func (c *checker) enterScope() {
+	c.scope = &scope{outer: c.scope, bindings: map[string]*binding{}}
+}
+
+// 离开作用域，报告其中没有使用的let和参数
+func (c *checker) leaveScope() {
+	for _, b := range c.scope.order {
+		if b.used || strings.HasPrefix(b.ident.Value, "_") {
+			continue
+		}
+		switch b.kind {
+		case letBinding:
+			c.report(b.ident, "未使用的变量 %s", b.ident.Value)
+		case parameter:
+			c.report(b.ident, "未使用的参数 %s", b.ident.Value)
+		}
+	}
+	c.scope = c.scope.outer
+}
+
+// 声明变量，与内置函数同名时报告
+func (c *checker) declare(ident *ast.Identifier) {
+	if evaluator.Builtin(ident.Value) != nil {
+		c.report(ident, "%s 遮蔽了内置函数", ident.Value)
+	}
+}
+
+// 提前声明node中属于当前作用域的变量，函数中可以引用之后才定义的变量
+func (c *checker) hoist(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, statement := range node.Statements {
+			c.hoist(statement)
+		}
+	case *ast.BlockStatement:
+		for _, statement := range node.Statements {
+			c.hoist(statement)
+		}
+	case *ast.ExpressionStatement:
+		c.hoist(node.Expression)
+	case *ast.LetStatement:
+		c.hoist(node.Value)
+		c.scope.declare(node.Name, letBinding)
+	case *ast.ReturnStatement:
+		c.hoist(node.ReturnValue)
+	case *ast.ThrowStatement:
+		c.hoist(node.Value)
+	case *ast.YieldExpression:
+		c.hoist(node.Value)
+	case *ast.SpawnExpression:
+		c.hoist(node.Call)
+	case *ast.StructStatement:
+		c.scope.declare(node.Name, other)
+	case *ast.EnumStatement:
+		c.scope.declare(node.Name, other)
+	case *ast.ImportStatement:
+		c.scope.declare(importName(node), other)
+	case *ast.ExportStatement:
+		c.hoist(node.Statement)
+	case *ast.PrefixExpression:
+		c.hoist(node.Right)
+	case *ast.InfixExpression:
+		c.hoist(node.Left)
+		c.hoist(node.Right)
+	case *ast.IndexExpression:
+		c.hoist(node.Left)
+		c.hoist(node.Index)
+	case *ast.PropertyExpression:
+		c.hoist(node.Object)
+	case *ast.AssignExpression:
+		c.hoist(node.Target.Object)
+		c.hoist(node.Value)
+	case *ast.ArrayLiteral:
+		for _, element := range node.Elements {
+			c.hoist(element)
+		}
+	case *ast.IfExpression:
+		c.hoist(node.Condition)
+		c.hoist(node.Consequence)
+		if node.Alternative != nil {
+			c.hoist(node.Alternative)
+		}
+	case *ast.TryExpression:
+		c.hoist(node.Body)
+		if node.Finally != nil {
+			c.hoist(node.Finally)
+		}
+	case *ast.CallExpression:
+		if isQuote(node) {
+			return
+		}
+		c.hoist(node.Function)
+		for _, argument := range node.Arguments {
+			c.hoist(argument)
+		}
+	}
+}
+
+// 检查语句序列，return之后的第一条语句报告不会执行
+func (c *checker) statements(statements []ast.Statement) {
+	for i, statement := range statements {
+		c.statement(statement)
+		if _, ok := statement.(*ast.ReturnStatement); ok && i+1 < len(statements) {
+			c.report(statements[i+1], "return之后的代码不会执行")
+		}
+	}
+}
+
+func (c *checker) statement(statement ast.Statement) {
+	switch node := statement.(type) {
+	case *ast.ExpressionStatement:
+		c.expression(node.Expression)
+	case *ast.LetStatement:
+		c.expression(node.Value)
+		c.declare(node.Name)
+	case *ast.ReturnStatement:
+		c.expression(node.ReturnValue)
+	case *ast.ThrowStatement:
+		c.expression(node.Value)
+	case *ast.StructStatement:
+		c.declare(node.Name)
+	case *ast.EnumStatement:
+		c.declare(node.Name)
+	case *ast.ImportStatement:
+		c.declare(importName(node))
+	case *ast.ExportStatement:
+		c.statement(node.Statement)
+		for _, name := range node.Names() {
+			c.use(name)
+		}
+	}
+}
+
+func (c *checker) block(block *ast.BlockStatement) {
+	if block != nil {
+		c.statements(block.Statements)
+	}
+}
+
+func (c *checker) expression(expression ast.Expression) {
+	switch node := expression.(type) {
+	case *ast.Identifier:
+		if !c.use(node.Value) && evaluator.Builtin(node.Value) == nil {
+			c.report(node, "标识符未定义: %s", node.Value)
+		}
+
+	case *ast.PrefixExpression:
+		c.expression(node.Right)
+
+	case *ast.YieldExpression:
+		c.expression(node.Value)
+
+	case *ast.SpawnExpression:
+		c.call(node.Call)
+
+	case *ast.InfixExpression:
+		c.expression(node.Left)
+		c.expression(node.Right)
+
+	case *ast.IndexExpression:
+		c.expression(node.Left)
+		c.expression(node.Index)
+
+	case *ast.PropertyExpression:
+		c.expression(node.Object)
+
+	case *ast.AssignExpression:
+		c.expression(node.Target.Object)
+		c.expression(node.Value)
+
+	case *ast.ArrayLiteral:
+		for _, element := range node.Elements {
+			c.expression(element)
+		}
+
+	case *ast.IfExpression:
+		c.expression(node.Condition)
+		c.block(node.Consequence)
+		c.block(node.Alternative)
+
+	case *ast.TryExpression:
+		c.block(node.Body)
+		if node.Catch != nil {
+			c.enterScope()
+			c.scope.declare(node.Param, other)
+			c.declare(node.Param)
+			c.hoist(node.Catch)
+			c.block(node.Catch)
+			c.leaveScope()
+		}
+		c.block(node.Finally)
+
+	case *ast.FunctionExpression:
+		c.function(node.Parameters, node.Body)
+
+	case *ast.MacroLiteral:
+		c.function(node.Parameters, node.Body)
+
+	case *ast.CallExpression:
+		c.call(node)
+	}
+}
+
+func (c *checker) function(parameters []*ast.Identifier, body *ast.BlockStatement) {
+	c.enterScope()
+	for _, param := range parameters {
+		c.scope.declare(param, parameter)
+		c.declare(param)
+	}
+	c.hoist(body)
+	c.block(body)
+	c.leaveScope()
+}
+
+func (c *checker) call(node *ast.CallExpression) {
+	//quote的参数不求值，只有unquote的参数在当前作用域中求值
+	if isQuote(node) {
+		for _, argument := range evaluator.UnquoteArguments(node) {
+			c.expression(argument)
+		}
+		return
+	}
+
+	//方法调用：方法名可能是调用处的变量或内置函数
+	if property, ok := node.Function.(*ast.PropertyExpression); ok {
+		c.expression(property.Object)
+		c.use(property.Property.Value)
+	} else {
+		c.expression(node.Function)
+		c.checkArguments(node)
+	}
+
+	for _, argument := range node.Arguments {
+		c.expression(argument)
+	}
+}
+
+// 检查内置函数的参数数量，被同名变量遮蔽时不检查
+func (c *checker) checkArguments(node *ast.CallExpression) {
+	ident, ok := node.Function.(*ast.Identifier)
+	if !ok || c.scope.lookup(ident.Value) != nil {
+		return
+	}
+	builtin := evaluator.Builtin(ident.Value)
+	if builtin == nil {
+		return
+	}
+
+	n := len(node.Arguments)
+	if n >= builtin.MinArgs && (builtin.MaxArgs < 0 || n <= builtin.MaxArgs) {
+		return
+	}
+
+	var expected string
+	switch {
+	case builtin.MinArgs == builtin.MaxArgs:
+		expected = fmt.Sprintf("=%d", builtin.MinArgs)
+	case builtin.MaxArgs < 0:
+		expected = fmt.Sprintf(">=%d", builtin.MinArgs)
+	case builtin.MinArgs == 0:
+		expected = fmt.Sprintf("<=%d", builtin.MaxArgs)
+	default:
+		expected = fmt.Sprintf("%d~%d", builtin.MinArgs, builtin.MaxArgs)
+	}
+	c.report(ident, "%s 参数数量错误，期望%s，实际=%d", ident.Value, expected, n)
+}
+
+// 使用变量，返回是否找到了声明
+func (c *checker) use(name string) bool {
+	b := c.scope.lookup(name)
+	if b == nil {
+		return false
+	}
+	b.used = true
+	return true
+}
+
+func isQuote(node *ast.CallExpression) bool {
+	return node.Function.TokenLiteral() == "quote"
+}
+
+// import绑定的名称，省略as时位置为import语句
+func importName(node *ast.ImportStatement) *ast.Identifier {
+	if node.Alias != nil {
+		return node.Alias
+	}
+	return &ast.Identifier{Token: node.Token, Value: node.Name()}
+}
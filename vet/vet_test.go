@@ -0,0 +1,55 @@
+package vet
+
+import (
+	"TroInterpreter/lexer"
+	"TroInterpreter/parser"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`let x = 1; x + y`, []string{"1:16: 标识符未定义: y"}},
+		{`let f = fn() { g() }; let g = fn() { 1 }; f()`, nil},
+		{`let f = fn(a, b) { let c = 1; a }`, []string{"1:15: 未使用的参数 b", "1:24: 未使用的变量 c"}},
+		{`let f = fn(_a) { let _b = 1; 2 }`, nil},
+		{`let unused = 1; export let y = 2;`, nil},
+		{`let len = 1; let f = fn(first) { first }`, []string{"1:5: len 遮蔽了内置函数", "1:25: first 遮蔽了内置函数"}},
+		{`let f = fn() { return 1; 2; 3 }`, []string{"1:26: return之后的代码不会执行"}},
+		{`len(1, 2); push([1]); help(); help(1, 2)`, []string{
+			"1:1: len 参数数量错误，期望=1，实际=2",
+			"1:12: push 参数数量错误，期望=2，实际=1",
+			"1:31: help 参数数量错误，期望<=1，实际=2",
+		}},
+		{`let f = fn() { let len = fn(a, b) { a + b }; len(1, 2) }`, []string{"1:20: len 遮蔽了内置函数"}},
+		{`let double = fn(x) { x * 2 }; let f = fn() { 21.double() }`, nil},
+		{`try { 1 } catch (e) { missing }`, []string{"1:23: 标识符未定义: missing"}},
+		{`let f = fn(n) { if (n > 0) { let x = n; } x }`, nil},
+		{`let unless = macro(cond, a) { quote(if (!(unquote(cond))) { unquote(a) }) }; unless(false, 1)`, nil},
+		{`let f = fn(a: int) -> int { a }; let s: string = f(1)`, []string{"1:51: 变量 s 类型错误，期望=string，实际=int"}},
+		{`let f = gen fn(n) { let x = yield n; yield missing; }`, []string{"1:25: 未使用的变量 x", "1:44: 标识符未定义: missing"}},
+		{`let ch = channel(); spawn ch.send(1); spawn missing(send(ch))`, []string{"1:45: 标识符未定义: missing", "1:53: send 参数数量错误，期望=2，实际=1"}},
+		{`struct Point { x, y } enum Shape { Circle(r) } import "lib/math.tro"; [Point(1, 2), Shape.Circle(1), math.pi]`, nil},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("%q: parser errors: %v", tt.input, p.Errors())
+		}
+
+		diagnostics := Check(program)
+		if len(diagnostics) != len(tt.expected) {
+			t.Errorf("%q: wrong diagnostics. want=%q, got=%v", tt.input, tt.expected, diagnostics)
+			continue
+		}
+		for i, d := range diagnostics {
+			if d.String() != tt.expected[i] {
+				t.Errorf("%q: wrong diagnostic. want=%q, got=%q", tt.input, tt.expected[i], d.String())
+			}
+		}
+	}
+}
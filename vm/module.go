@@ -0,0 +1,32 @@
+package vm
+
+import (
+	"TroInterpreter/ast"
+	"TroInterpreter/compiler"
+	"TroInterpreter/object"
+	"fmt"
+)
+
+// 用虚拟机执行模块，模块有自己的符号表和全局变量
+func runModule(program *ast.Program, env *object.Environment, names []string) (map[string]object.Object, *object.Error) {
+	symbolTable := compiler.NewSymbolTable()
+	c := compiler.NewWithState(symbolTable, []object.Object{})
+	if err := c.Compile(program); err != nil {
+		return nil, &object.Error{Message: fmt.Sprintf("模块 %s 编译错误: %s", env.File(), err), Kind: object.IMPORT_ERROR}
+	}
+
+	machine := New(c.Bytecode(), env)
+	if err, ok := machine.Run().(*object.Error); ok {
+		return nil, err
+	}
+
+	exports := map[string]object.Object{}
+	globals := machine.Globals()
+	for _, name := range names {
+		symbol, ok := symbolTable.Resolve(name)
+		if ok && symbol.Scope == compiler.GlobalScope && globals.Get(symbol.Index) != nil {
+			exports[name] = globals.Get(symbol.Index)
+		}
+	}
+	return exports, nil
+}
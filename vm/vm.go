@@ -0,0 +1,717 @@
+package vm
+
+import (
+	"TroInterpreter/ast"
+	"TroInterpreter/code"
+	"TroInterpreter/compiler"
+	"TroInterpreter/evaluator"
+	"TroInterpreter/object"
+	"context"
+	"fmt"
+)
+
+// 栈的初始大小，不够时自动扩大
+const StackSize = 2048
+
+// 中缀运算的操作码对应的运算符
+var infixOperators = [...]string{
+	code.OpAdd:         "+",
+	code.OpSub:         "-",
+	code.OpMul:         "*",
+	code.OpDiv:         "/",
+	code.OpEqual:       "==",
+	code.OpNotEqual:    "!=",
+	code.OpLessThan:    "<",
+	code.OpGreaterThan: ">",
+}
+
+// 一段指令执行结束的方式
+type outcome int
+
+const (
+	finished outcome = iota //执行到OpEndTry
+	returned                //从函数或顶层程序返回
+	failed                  //出错
+)
+
+// 一次函数调用
+type frame struct {
+	cl     *object.Closure
+	ip     int            // 下一条指令的位置
+	locals *object.Locals // 局部变量
+	base   int            // 调用前被调用的函数在栈上的位置，返回值放在这里
+	info   *object.Frame  // 调用帧，顶层程序为nil
+	origin *object.Frame  // 发起这次调用(不是尾调用)的调用帧，尾调用准备时出错报告在这里
+
+	returnTypes []*ast.TypeName // 尾调用替换掉的函数的返回类型，最终的返回值也要符合
+}
+
+// 栈式虚拟机，与求值器共享运行时和各种运算，结果与求值器一致
+type VM struct {
+	env     *object.Environment // 提供运行时和源文件，用于导入模块
+	runtime *object.Runtime
+	yield   func(object.Object) bool // 生成器的虚拟机中为交出值的函数，见newGenerator
+
+	stack []object.Object
+	sp    int // 栈顶的下一个位置
+
+	frames      []frame
+	framesIndex int // 当前调用在frames中的下标
+}
+
+// 全局变量，同一个程序的闭包共享，见object.Unit
+type Globals = object.Globals
+
+// NewGlobals 创建全局变量，前面是内置函数，与compiler.NewSymbolTable一致
+func NewGlobals() *Globals {
+	names := evaluator.BuiltinNames()
+	values := make([]object.Object, len(names))
+	for i, name := range names {
+		values[i] = evaluator.Builtin(name)
+	}
+	return object.NewGlobals(values)
+}
+
+// New 创建执行bytecode的虚拟机，bytecode只会被读取，可以被不同goroutine中的多个虚拟机同时执行
+func New(bytecode *compiler.Bytecode, env *object.Environment) *VM {
+	return NewWithGlobals(bytecode, env, NewGlobals())
+}
+
+// NewWithGlobals 使用已有的全局变量创建虚拟机，交互式环境中每次输入共用全局变量
+func NewWithGlobals(bytecode *compiler.Bytecode, env *object.Environment, globals *Globals) *VM {
+	unit := &object.Unit{Constants: bytecode.Constants, Globals: globals}
+	main := &object.Closure{Fn: bytecode.Main, Unit: unit}
+	frames := make([]frame, 1, 64)
+	frames[0] = frame{cl: main, locals: &object.Locals{Values: make([]object.Object, main.Fn.NumLocals)}}
+
+	return &VM{
+		env:     env,
+		runtime: env.Runtime(),
+		stack:   make([]object.Object, StackSize),
+		frames:  frames,
+	}
+}
+
+// Globals 返回全局变量
+func (vm *VM) Globals() *Globals {
+	return vm.frames[0].cl.Unit.Globals
+}
+
+// Run 执行程序，返回程序的值，出错时返回错误
+func (vm *VM) Run() object.Object {
+	result, _ := vm.run(0)
+	return result
+}
+
+// RunContext 在上下文中执行程序，与evaluator.EvalContext相同
+func (vm *VM) RunContext(ctx context.Context, budget evaluator.Budget) object.Object {
+	if !budget.Deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, budget.Deadline)
+		defer cancel()
+	}
+
+	restore := vm.runtime.Limit(ctx, budget.Steps)
+	defer restore()
+
+	if err := vm.runtime.Check(); err != nil {
+		return err
+	}
+	return vm.Run()
+}
+
+// 从当前调用的ip开始执行，直到下标为base的调用返回、执行到它的OpEndTry或出错
+// try的各个部分通过递归调用run执行
+func (vm *VM) run(base int) (object.Object, outcome) {
+	for {
+		f := &vm.frames[vm.framesIndex]
+		ins := f.cl.Fn.Instructions
+		ip := f.ip
+		op := code.Opcode(ins[ip])
+		f.ip++
+
+		var err *object.Error
+		switch op {
+		case code.OpConstant:
+			idx := code.ReadUint16(ins[ip+1:])
+			f.ip += 2
+			vm.push(f.cl.Unit.Constants[idx])
+
+		case code.OpPop:
+			vm.pop()
+
+		case code.OpNull:
+			vm.push(evaluator.NULL)
+
+		case code.OpNone:
+			vm.push(nil)
+
+		case code.OpTrue:
+			vm.push(evaluator.TRUE)
+
+		case code.OpFalse:
+			vm.push(evaluator.FALSE)
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
+			code.OpEqual, code.OpNotEqual, code.OpLessThan, code.OpGreaterThan:
+			right := vm.pop()
+			left := vm.pop()
+			err = vm.pushResult(evaluator.Infix(infixOperators[op], left, right, vm.runtime))
+
+		case code.OpMinus:
+			err = vm.pushResult(evaluator.Prefix("-", vm.pop(), vm.runtime))
+
+		case code.OpBang:
+			err = vm.pushResult(evaluator.Prefix("!", vm.pop(), vm.runtime))
+
+		case code.OpJump:
+			f.ip = int(code.ReadUint16(ins[ip+1:]))
+
+		case code.OpJumpNotTruthy:
+			f.ip += 2
+			if !evaluator.IsTruthy(vm.pop()) {
+				f.ip = int(code.ReadUint16(ins[ip+1:]))
+			}
+
+		case code.OpGetGlobal:
+			idx := int(code.ReadUint16(ins[ip+1:]))
+			f.ip += 2
+			if val := f.cl.Unit.Globals.Get(idx); val != nil {
+				vm.push(val)
+			} else {
+				err = vm.undefined(f, ip)
+			}
+
+		case code.OpLookupGlobal:
+			idx := int(code.ReadUint16(ins[ip+1:]))
+			f.ip += 2
+			vm.push(f.cl.Unit.Globals.Get(idx))
+
+		case code.OpSetGlobal:
+			idx := int(code.ReadUint16(ins[ip+1:]))
+			f.ip += 2
+			f.cl.Unit.Globals.Set(idx, vm.pop())
+
+		case code.OpGetLocal:
+			idx := code.ReadUint16(ins[ip+1:])
+			f.ip += 2
+			if val := f.locals.Values[idx]; val != nil {
+				vm.push(val)
+			} else {
+				err = vm.undefined(f, ip)
+			}
+
+		case code.OpSetLocal:
+			idx := code.ReadUint16(ins[ip+1:])
+			f.ip += 2
+			f.locals.Set(int(idx), vm.pop())
+
+		case code.OpGetOuter:
+			depth := int(code.ReadUint8(ins[ip+1:]))
+			idx := code.ReadUint16(ins[ip+2:])
+			f.ip += 3
+			locals := f.locals
+			for ; depth > 0; depth-- {
+				locals = locals.Outer
+			}
+			if val := locals.Get(int(idx)); val != nil {
+				vm.push(val)
+			} else {
+				err = vm.undefined(f, ip)
+			}
+
+		case code.OpLookupLocal:
+			idx := code.ReadUint16(ins[ip+1:])
+			f.ip += 2
+			vm.push(f.locals.Get(int(idx)))
+
+		case code.OpLookupOuter:
+			depth := int(code.ReadUint8(ins[ip+1:]))
+			idx := code.ReadUint16(ins[ip+2:])
+			f.ip += 3
+			locals := f.locals
+			for ; depth > 0; depth-- {
+				locals = locals.Outer
+			}
+			vm.push(locals.Get(int(idx)))
+
+		case code.OpJumpNotNil:
+			f.ip += 2
+			if vm.stack[vm.sp-1] != nil {
+				f.ip = int(code.ReadUint16(ins[ip+1:]))
+			} else {
+				vm.pop()
+			}
+
+		case code.OpArray:
+			n := int(code.ReadUint16(ins[ip+1:]))
+			f.ip += 2
+			elements := make([]object.Object, n)
+			copy(elements, vm.stack[vm.sp-n:vm.sp])
+			vm.sp -= n
+			err = vm.pushResult(evaluator.NewArray(elements, vm.runtime))
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			err = vm.pushResult(evaluator.Index(left, index, vm.runtime))
+
+		case code.OpGetProperty:
+			name := f.cl.Unit.Constants[code.ReadUint16(ins[ip+1:])].(*object.String).Value
+			f.ip += 2
+			err = vm.pushResult(evaluator.GetProperty(vm.pop(), name))
+
+		case code.OpSetProperty:
+			name := f.cl.Unit.Constants[code.ReadUint16(ins[ip+1:])].(*object.String).Value
+			f.ip += 2
+			val := vm.pop()
+			receiver := vm.pop()
+			err = vm.pushResult(evaluator.SetProperty(receiver, name, val))
+
+		case code.OpClosure:
+			fn := f.cl.Unit.Constants[code.ReadUint16(ins[ip+1:])].(*object.CompiledFunction)
+			f.ip += 2
+			vm.push(&object.Closure{Fn: fn, Env: f.locals, Unit: f.cl.Unit})
+
+		case code.OpCall:
+			argc := int(code.ReadUint8(ins[ip+1:]))
+			f.ip++
+			fnPos := vm.sp - 1 - argc
+			err = vm.call(vm.stack[fnPos], vm.stack[fnPos+1:vm.sp], fnPos, ip)
+
+		case code.OpMethodCall:
+			name := f.cl.Unit.Constants[code.ReadUint16(ins[ip+1:])].(*object.String).Value
+			argc := int(code.ReadUint8(ins[ip+3:]))
+			f.ip += 3
+			fallback := vm.pop()
+			receiverPos := vm.sp - 1 - argc
+			args := make([]object.Object, argc)
+			copy(args, vm.stack[receiverPos+1:vm.sp])
+
+			fn, args, resolveErr := evaluator.ResolveMethod(vm.stack[receiverPos], name, args, fallback)
+			if resolveErr != nil {
+				err = resolveErr
+				break
+			}
+			err = vm.call(fn, args, receiverPos, ip)
+
+		case code.OpSpawn:
+			nameIdx := int(code.ReadUint16(ins[ip+1:]))
+			argc := int(code.ReadUint8(ins[ip+3:]))
+			f.ip += 3
+			if nameIdx == code.NoOffset {
+				fnPos := vm.sp - 1 - argc
+				fn, args := vm.stack[fnPos], copyArgs(vm.stack[fnPos+1:vm.sp])
+				vm.sp = fnPos
+				vm.push(vm.spawn(fn, args, ip))
+				break
+			}
+
+			name := f.cl.Unit.Constants[nameIdx].(*object.String).Value
+			fallback := vm.pop()
+			receiverPos := vm.sp - 1 - argc
+			args := copyArgs(vm.stack[receiverPos+1 : vm.sp])
+			fn, args, resolveErr := evaluator.ResolveMethod(vm.stack[receiverPos], name, args, fallback)
+			if resolveErr != nil {
+				err = resolveErr
+				break
+			}
+			vm.sp = receiverPos
+			vm.push(vm.spawn(fn, args, ip))
+
+		case code.OpTailCall:
+			argc := int(code.ReadUint8(ins[ip+1:]))
+			f.ip++
+			fnPos := vm.sp - 1 - argc
+			result, done, tailErr := vm.tailCall(vm.stack[fnPos], vm.stack[fnPos+1:vm.sp], ip)
+			if tailErr != nil {
+				err = tailErr
+				break
+			}
+			if done {
+				//调用的不是函数，结果就是当前调用的返回值
+				val, stop, returnErr := vm.returnValue(result, base)
+				if stop {
+					return val, returned
+				}
+				err = returnErr
+			}
+
+		case code.OpReturnValue:
+			val, stop, returnErr := vm.returnValue(vm.pop(), base)
+			if stop {
+				return val, returned
+			}
+			err = returnErr
+
+		case code.OpThrow:
+			err = evaluator.ThrowValue(vm.pop())
+
+		case code.OpYield:
+			err = vm.yieldValue(vm.pop())
+
+		case code.OpTry:
+			catchPos := int(code.ReadUint16(ins[ip+1:]))
+			finallyPos := int(code.ReadUint16(ins[ip+3:]))
+			endPos := int(code.ReadUint16(ins[ip+5:]))
+			f.ip += 6
+
+			result, how := vm.runTry(catchPos, finallyPos, endPos)
+			switch how {
+			case failed:
+				return result, failed
+			case returned:
+				val, stop, returnErr := vm.returnValue(result, base)
+				if stop {
+					return val, returned
+				}
+				err = returnErr
+			default:
+				vm.push(result)
+			}
+
+		case code.OpEndTry:
+			return vm.pop(), finished
+
+		case code.OpDeclare:
+			declaration := f.cl.Unit.Constants[code.ReadUint16(ins[ip+1:])].(*object.Quote).Node
+			f.ip += 2
+			switch node := declaration.(type) {
+			case *ast.StructStatement:
+				err = vm.pushResult(evaluator.DefineStruct(node))
+			case *ast.EnumStatement:
+				err = vm.pushResult(evaluator.DefineEnum(node))
+			}
+
+		case code.OpImport:
+			path := f.cl.Unit.Constants[code.ReadUint16(ins[ip+1:])].(*object.String).Value
+			f.ip += 2
+			err = vm.pushResult(evaluator.ImportModule(path, vm.env, runModule))
+
+		case code.OpQuote:
+			call := f.cl.Unit.Constants[code.ReadUint16(ins[ip+1:])].(*object.Quote).Node.(*ast.CallExpression)
+			n := int(code.ReadUint8(ins[ip+3:]))
+			f.ip += 3
+			values := make([]object.Object, n)
+			copy(values, vm.stack[vm.sp-n:vm.sp])
+			vm.sp -= n
+			err = vm.pushResult(evaluator.Quote(call, values))
+
+		default:
+			err = &object.Error{Message: fmt.Sprintf("未知的操作码 %d", op), Kind: object.RUNTIME_ERROR}
+		}
+
+		if err != nil {
+			//frames可能已经扩容，重新取当前的调用
+			vm.stamp(err, &vm.frames[vm.framesIndex], ip)
+			return err, failed
+		}
+	}
+}
+
+// 执行try：主体出错时执行catch，finally总会执行，只有在其中出错或返回时才会覆盖结果
+// 返回try的值，或者需要继续传播的返回值、错误
+func (vm *VM) runTry(catchPos, finallyPos, endPos int) (object.Object, outcome) {
+	sp, index := vm.sp, vm.framesIndex
+	restore := func() {
+		vm.sp, vm.framesIndex = sp, index
+	}
+
+	result, how := vm.run(index)
+	restore()
+
+	if err, ok := result.(*object.Error); ok && how == failed && err.Catchable() && catchPos != code.NoOffset {
+		vm.push(evaluator.ErrorValue(err))
+		vm.frames[index].ip = catchPos
+		result, how = vm.run(index)
+		restore()
+	}
+
+	if finallyPos != code.NoOffset {
+		vm.frames[index].ip = finallyPos
+		finally, finallyHow := vm.run(index)
+		restore()
+		if finallyHow != finished {
+			result, how = finally, finallyHow
+		}
+	}
+
+	vm.frames[index].ip = endPos
+	if result == nil {
+		return evaluator.NULL, how
+	}
+	return result, how
+}
+
+// 调用函数，ip为调用指令的位置，返回值放在栈上base的位置
+func (vm *VM) call(fn object.Object, args []object.Object, base, ip int) *object.Error {
+	caller := &vm.frames[vm.framesIndex]
+	src := caller.cl.Fn.Sources[ip]
+	info := &object.Frame{Function: src.Name, Line: src.Line, Column: src.Column, Caller: caller.info, Depth: 1}
+	if caller.info != nil {
+		info.Depth = caller.info.Depth + 1
+	}
+
+	closure, ok := fn.(*object.Closure)
+	if !ok {
+		result := evaluator.Call(fn, copyArgs(args), vm.runtime)
+		vm.sp = base
+		return vm.pushResult(result)
+	}
+
+	if err := vm.enter(closure, info); err != nil {
+		return err
+	}
+	if err := evaluator.CheckArguments(closure.Fn.Parameters, args); err != nil {
+		return err
+	}
+	if closure.Fn.Generator {
+		//生成器函数的返回类型注解检查的是生成器本身
+		generator := vm.newGenerator(closure, args, info)
+		if err := evaluator.CheckResult(closure.Fn.ReturnType, generator); err != nil {
+			return err
+		}
+		vm.sp = base
+		vm.push(generator)
+		return nil
+	}
+
+	locals := newLocals(closure, args)
+	vm.framesIndex++
+	if vm.framesIndex == len(vm.frames) {
+		vm.frames = append(vm.frames, frame{})
+	}
+	vm.frames[vm.framesIndex] = frame{cl: closure, locals: locals, base: base, info: info, origin: info}
+	vm.sp = base
+	return nil
+}
+
+// 尾调用，被调用的函数替换当前的调用
+// 调用的不是函数时直接得到结果，done为true，由调用者作为当前调用的返回值
+func (vm *VM) tailCall(fn object.Object, args []object.Object, ip int) (result object.Object, done bool, err *object.Error) {
+	current := &vm.frames[vm.framesIndex]
+	src := current.cl.Fn.Sources[ip]
+	info := &object.Frame{Function: src.Name, Line: src.Line, Column: src.Column, Caller: current.info.Caller, Depth: current.info.Depth, TailCalls: current.info.TailCalls + 1}
+
+	closure, ok := fn.(*object.Closure)
+	if !ok {
+		result = evaluator.Call(fn, copyArgs(args), vm.runtime)
+		if err, ok := result.(*object.Error); ok {
+			//没有经过调用处的指令，在这里记录位置
+			if err.Line == 0 && err.Stack == nil {
+				err.Line, err.Column, err.Stack = info.Line, info.Column, info.Caller
+			}
+			return nil, false, err
+		}
+		return result, true, nil
+	}
+
+	if err := vm.enter(closure, info); err != nil {
+		//与求值器一致，报告在发起调用的位置
+		err.Line, err.Column, err.Stack = current.origin.Line, current.origin.Column, current.origin.Caller
+		return nil, false, err
+	}
+	if err := evaluator.CheckArguments(closure.Fn.Parameters, args); err != nil {
+		err.Line, err.Column, err.Stack = info.Line, info.Column, info.Caller
+		return nil, false, err
+	}
+	if closure.Fn.Generator {
+		//生成器就是当前调用的返回值
+		generator := vm.newGenerator(closure, args, info)
+		if err := evaluator.CheckResult(closure.Fn.ReturnType, generator); err != nil {
+			err.Line, err.Column, err.Stack = current.origin.Line, current.origin.Column, current.origin.Caller
+			return nil, false, err
+		}
+		return generator, true, nil
+	}
+
+	current.returnTypes = evaluator.AddReturnType(current.returnTypes, current.cl.Fn.ReturnType)
+	current.cl = closure
+	current.locals = newLocals(closure, args)
+	current.ip = 0
+	current.info = info
+	vm.sp = current.base
+	return nil, false, nil
+}
+
+// 生成器的虚拟机的栈的初始大小
+const generatorStackSize = 64
+
+// 调用生成器函数得到生成器，函数体在第一次next时才开始执行
+// 函数体在单独的虚拟机中执行，与当前虚拟机共享运行时，常量池和全局变量来自闭包；
+// 挂起时这个虚拟机的栈和调用(包括try的递归执行)原样保留
+func (vm *VM) newGenerator(closure *object.Closure, args []object.Object, info *object.Frame) *object.Generator {
+	child := vm.child(closure, args, info, generatorStackSize)
+	return object.NewGenerator(info.Function, func(yield func(object.Object) bool) object.Object {
+		child.yield = yield
+		result, _ := child.run(0)
+		return result
+	})
+}
+
+// 创建执行closure的虚拟机，与当前虚拟机共享运行时
+func (vm *VM) child(closure *object.Closure, args []object.Object, info *object.Frame, stackSize int) *VM {
+	child := &VM{
+		env:     vm.env,
+		runtime: vm.runtime,
+		stack:   make([]object.Object, stackSize),
+		frames:  make([]frame, 1, 8),
+	}
+	child.frames[0] = frame{cl: closure, locals: newLocals(closure, args), info: info, origin: info}
+	return child
+}
+
+// spawn的任务的虚拟机的栈的初始大小
+const taskStackSize = 256
+
+// 在新的任务中调用函数，ip为spawn指令的位置，调用帧与求值器一致：被调用的函数之外是标记任务边界的spawn帧
+func (vm *VM) spawn(fn object.Object, args []object.Object, ip int) *object.Task {
+	caller := &vm.frames[vm.framesIndex]
+	src := caller.cl.Fn.Sources[ip]
+	task := &object.Frame{Function: "spawn", Line: src.Line, Column: src.Column, Caller: caller.info, Depth: 1, Task: true}
+	if caller.info != nil {
+		task.Depth = caller.info.Depth + 1
+	}
+	info := &object.Frame{Function: src.Name, Line: src.Line, Column: src.Column, Caller: task, Depth: task.Depth + 1}
+
+	return object.NewTask(info.Function, vm.runtime, func() object.Object {
+		result := vm.runTask(fn, args, info)
+		//函数体之外的错误(参数、返回类型)记录在spawn的调用处
+		if err, ok := result.(*object.Error); ok && err.Line == 0 && err.Stack == nil {
+			err.Line, err.Column, err.Stack = info.Line, info.Column, info.Caller
+		}
+		return result
+	})
+}
+
+// 在任务的goroutine中调用函数，函数体在单独的虚拟机中执行
+func (vm *VM) runTask(fn object.Object, args []object.Object, info *object.Frame) object.Object {
+	closure, ok := fn.(*object.Closure)
+	if !ok {
+		return evaluator.Call(fn, args, vm.runtime)
+	}
+	if err := vm.enter(closure, info); err != nil {
+		return err
+	}
+	if err := evaluator.CheckArguments(closure.Fn.Parameters, args); err != nil {
+		return err
+	}
+	if closure.Fn.Generator {
+		generator := vm.newGenerator(closure, args, info)
+		if err := evaluator.CheckResult(closure.Fn.ReturnType, generator); err != nil {
+			return err
+		}
+		return generator
+	}
+
+	child := vm.child(closure, args, info, taskStackSize)
+	result, how := child.run(0)
+	if how == failed {
+		return result
+	}
+	//最外层的调用返回时run不检查返回类型
+	first := &child.frames[0]
+	for _, t := range evaluator.AddReturnType(first.returnTypes, first.cl.Fn.ReturnType) {
+		if err := evaluator.CheckResult(t, result); err != nil {
+			return err
+		}
+	}
+	return result
+}
+
+// 执行yield，把值交给执行当前虚拟机的生成器
+func (vm *VM) yieldValue(val object.Object) *object.Error {
+	if vm.yield == nil {
+		return &object.Error{Message: "yield不在生成器中", Kind: object.RUNTIME_ERROR}
+	}
+	//生成器不再使用，结束函数体，finally仍然会执行
+	if !vm.yield(val) {
+		return &object.Error{Message: "生成器已经结束", Kind: object.GENERATOR_EXIT}
+	}
+	vm.push(evaluator.NULL)
+	return nil
+}
+
+// 进入函数前检查上下文、步数和调用深度
+func (vm *VM) enter(closure *object.Closure, info *object.Frame) *object.Error {
+	if err := vm.runtime.Step(); err != nil {
+		return err
+	}
+	return vm.runtime.CheckDepth(info)
+}
+
+// 从当前调用返回val，当前调用是run的base时返回true，由run返回
+// 返回值不符合返回类型时，与求值器一致，在调用处报错
+func (vm *VM) returnValue(val object.Object, base int) (object.Object, bool, *object.Error) {
+	if vm.framesIndex == base {
+		return val, true, nil
+	}
+
+	f := &vm.frames[vm.framesIndex]
+	vm.sp = f.base
+	vm.framesIndex--
+	for _, t := range evaluator.AddReturnType(f.returnTypes, f.cl.Fn.ReturnType) {
+		if err := evaluator.CheckResult(t, val); err != nil {
+			err.Line, err.Column, err.Stack = f.origin.Line, f.origin.Column, f.origin.Caller
+			return nil, false, err
+		}
+	}
+	vm.push(val)
+	return nil, false, nil
+}
+
+// 创建调用的局部变量，参数放在前面的槽中，多余的参数被忽略
+func newLocals(closure *object.Closure, args []object.Object) *object.Locals {
+	values := make([]object.Object, closure.Fn.NumLocals)
+	n := len(args)
+	if n > closure.Fn.NumParameters {
+		n = closure.Fn.NumParameters
+	}
+	copy(values, args[:n])
+	return &object.Locals{Values: values, Outer: closure.Env}
+}
+
+// 内置函数可能保留参数，不能直接使用栈上的切片
+func copyArgs(args []object.Object) []object.Object {
+	copied := make([]object.Object, len(args))
+	copy(copied, args)
+	return copied
+}
+
+// 读取没有定义的变量
+func (vm *VM) undefined(f *frame, ip int) *object.Error {
+	return &object.Error{Message: "标识符未定义: " + f.cl.Fn.Sources[ip].Name, Kind: object.NAME_ERROR}
+}
+
+// 记录出错的位置和调用栈，与求值器相同，只记录在最先遇到错误的指令上
+func (vm *VM) stamp(err *object.Error, f *frame, ip int) {
+	if err.Line == 0 && err.Stack == nil {
+		err.Stack = f.info
+	}
+	if err.Line == 0 && err.Stack == f.info {
+		src := f.cl.Fn.Sources[ip]
+		err.Line, err.Column = src.Line, src.Column
+	}
+}
+
+// 把运算的结果入栈，出错时返回错误
+func (vm *VM) pushResult(result object.Object) *object.Error {
+	if err, ok := result.(*object.Error); ok {
+		return err
+	}
+	vm.push(result)
+	return nil
+}
+
+func (vm *VM) push(o object.Object) {
+	if vm.sp == len(vm.stack) {
+		vm.stack = append(vm.stack, make([]object.Object, len(vm.stack))...)
+	}
+	vm.stack[vm.sp] = o
+	vm.sp++
+}
+
+func (vm *VM) pop() object.Object {
+	vm.sp--
+	return vm.stack[vm.sp]
+}
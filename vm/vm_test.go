@@ -0,0 +1,363 @@
+package vm
+
+import (
+	"TroInterpreter/ast"
+	"TroInterpreter/compiler"
+	"TroInterpreter/evaltest"
+	"TroInterpreter/evaluator"
+	"TroInterpreter/lexer"
+	"TroInterpreter/object"
+	"TroInterpreter/parser"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// vm/vm_test.go
+
+// 虚拟机与求值器对同一个程序的结果应当一致，包括错误的类型、信息、位置和调用栈
+func TestMatchesEvaluator(t *testing.T) {
+	tests := []string{
+		`1 + 2 * 3 - 4 / 2`,
+		`-5; !true; !!0`,
+		`"a" + "b" == "ab"`,
+		`9223372036854775807 + 1`,
+		`10 / 0`,
+		`let x = 1; let y = x + 1;`,
+		`let x = 1; let x = x + 1; x`,
+		`if (1 < 2) { 10 }`,
+		`if (1 > 2) { 10 }`,
+		`if (false) { 1 } else { }`,
+		`[1, 2, 3][1] + [1, 2, 3][-1]`,
+		`"hello"[1]`,
+		`[1][5]`,
+		`missing + 1`,
+		`let add = fn(a, b) { a + b }; add(1, 2)`,
+		`let counter = fn() { let n = 0; fn() { n + 1 } }; counter()()`,
+		`let f = fn() { g() }; let g = fn() { 42 }; f()`,
+		`let f = fn() { let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } }; let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } }; even(10) }; f()`,
+		`let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }; fib(15)`,
+		`let loop = fn(n, acc) { if (n == 0) { return acc; } loop(n - 1, acc + n) }; loop(100000, 0)`,
+		`let f = fn() { return 1; 2 }; f()`,
+		`let f = fn(n) { f(n + 1) + 1 }; f(0)`,
+		"let f = fn() {\n  throw \"boom\";\n};\nlet g = fn() { f() };\ng();",
+		`let f = fn(x) { x + true }; let g = fn(x) { f(x) }; g(1)`,
+		`len("abc") + len([1, 2])`,
+		`len(1, 2)`,
+		`[1, 2, 3].len()`,
+		`let double = fn(x) { x * 2 }; 21.double()`,
+		`1.nothing()`,
+		`struct Point { x, y } let p = Point(1, 2); p.x = 5; p.x + p.y`,
+		`struct Point { x, y } Point(1, 2).z`,
+		`enum Shape { Circle(r), Empty } Shape.Circle(2)`,
+		`try { 1 } catch (e) { 2 }`,
+		`try { throw "boom"; 1 } catch (e) { e.message }`,
+		`try { 1 + "a" } catch (e) { e.type }`,
+		`struct Oops { code } try { throw Oops(7) } catch (e) { e.value.code }`,
+		`try { try { throw "inner" } catch (e) { throw e } } catch (e) { e.message }`,
+		`let f = fn() { try { return 1; } finally { 2 } }; f()`,
+		`let f = fn() { try { 1 } finally { return 2; } }; f()`,
+		`let e = 1; try { throw 2 } catch (e) { e.value }; e`,
+		`try { throw "a" } finally { 1 }`,
+		`quote(5 + 8)`,
+		`let x = 3; quote(unquote(x) + unquote(1 + 1))`,
+		`fn(a, b) { a + b }`,
+		`fn(a: int, b) -> bool { a > b }`,
+		`let f = fn(a: int, b: string) -> string { b }; f(1, "x")`,
+		`let f = fn(a: int) { a }; let g = fn() { f("x") }; g()`,
+		`let f = fn() -> int { return "s"; }; f()`,
+		`let f = fn() -> bool { try { return 1; } catch (e) { false } }; try { f() } catch (e) { e.type }`,
+		`let g = fn() { "s" }; let f = fn() -> int { g() }; f()`,
+		`let g = fn(a: string) { a }; let f = fn() { g(1) }; f()`,
+		`let g = fn(a: string) { a }; let f = fn() { g(1); 2 }; f()`,
+		`let f = fn() -> string { len("abc") }; f()`,
+		`let f = fn(n: int, acc: int) -> int { if (n == 0) { return acc; } f(n - 1, acc + n) }; f(1000, 0)`,
+		`struct Point { x, y } let f = fn(p: Point) -> int { p.x }; [f(Point(3, 4)), try { f(1) } catch (e) { e.message }]`,
+		`gen fn(a) { yield a; }`,
+		`let f = gen fn(n) { let loop = fn(i) { if (i < n) { try { yield i; } finally { 0 } loop(i + 1) } }; loop(0); yield "done"; }; let g = f(2); [next(g), g.next(), next(g), next(g, "end"), g]`,
+		`let nat = gen fn() { let loop = fn(n) { yield n; loop(n + 1) }; loop(0) }; let g = nat(); [next(g), next(g), next(g)]`,
+		`let f = gen fn() { yield later; }; let g = f(); let later = 1; next(g)`,
+		`let f = gen fn() { yield 1; }; let g = f(); next(g); next(g)`,
+		`let f = gen fn() { yield 1; throw "boom"; }; let g = f(); next(g); next(g)`,
+		`let f = gen fn() { next(g) }; let g = f(); next(g)`,
+		`struct Box { log } let b = Box([]); let f = gen fn() { try { yield 1; } finally { b.log = push(b.log, "finally") } }; let g = f(); [next(g), g.close(), b.log]`,
+		`let f = gen fn() -> int { yield 1; }; let h = fn() { f() }; h()`,
+		`let f = gen fn() -> int { yield 1; }; let h = fn() { f(); }; h()`,
+		`let sq = fn(x) { x * x }; let t = spawn sq(7); [t, wait(t), t.wait()]`,
+		`let ch = channel(); let produce = fn(n) { if (n > 0) { send(ch, n); produce(n - 1) } else { close(ch) } }; let sum = fn(acc) { let v = receive(ch, -1); if (v < 0) { acc } else { sum(acc + v) } }; spawn produce(50); sum(0)`,
+		`let run = fn() { let ch = channel(1); let total = 3; let f = fn() { send(ch, total * 2) }; spawn f(); receive(ch) }; run()`,
+		`let ch = channel(); spawn ch.send(1); ch.receive()`,
+		`struct Box { n } let b = Box(0); let ch = channel(); let worker = fn(i) { b.n = i; send(ch, i) }; let start = fn(i) { if (i > 0) { spawn worker(i); start(i - 1) } }; start(20); let collect = fn(i, acc) { if (i == 0) { acc } else { collect(i - 1, acc + receive(ch)) } }; collect(20, 0)`,
+		`let ch = channel(); close(ch); receive(ch)`,
+		"let f = fn() {\n  throw \"boom\";\n};\nlet g = fn() { f() };\nwait(spawn g());",
+		`let f = fn(a: int) { a }; let h = fn() { wait(spawn f("x")) }; h()`,
+		`let f = fn() -> int { "s" }; wait(spawn f())`,
+		`let f = fn(n) -> int { if (n == 0) { return "s"; } f(n - 1) }; wait(spawn f(3))`,
+		`wait(spawn len(1, 2))`,
+		`1.nothing(); spawn 1.nothing()`,
+		`spawn 1.nothing()`,
+		`let g = gen fn() { let f = fn() { yield 1 }; yield wait(spawn f()); }; next(g())`,
+		`receive(channel())`,
+		`let f = fn(c) { if (c) { let x = 2; } x }; let x = 1; [f(true), f(false)]`,
+		`let g = fn(c) { let h = fn(d) { if (d) { let x = 4; } x }; if (c) { let x = 3; } h }; let x = 1; [g(true)(true), g(true)(false), g(false)(false)]`,
+		`let f = fn() { try { throw 1; let y = 2; } catch (e) { y } }; f()`,
+		`let f = fn() { let g = fn() { z }; let a = try { g() } catch (e) { e.type }; let z = 5; [a, g()] }; let z = 0; f()`,
+		`quote(unquote(fn(x) { x }))`,
+		`quote(unquote(nope))`,
+		`struct N { x, y } let a = N(0, 1); let b = N(0, 1); a.x = a; b.x = b; [a == b, a]`,
+		`let ch = channel(); let t = spawn receive(ch); try { wait(t) } catch (e) { e.type }`,
+		`let s = "abc"; let f = fn(n) { s[0]; s[1]; s[-1]; f(n + 1) }; f(0)`,
+	}
+
+	for _, input := range tests {
+		program, ok := expand(input)
+		if !ok {
+			continue
+		}
+		want := evalResult(program)
+		got := vmResult(program)
+		if want != got {
+			t.Errorf("%q: results differ.\nevaluator=%s\nvm=%s", input, want, got)
+		}
+	}
+}
+
+// 求值器与虚拟机共用的测试程序，虚拟机的结果应当与期望的结果一致
+func TestPrograms(t *testing.T) {
+	programs, err := evaltest.Programs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range programs {
+		program, ok := expand(p.Input)
+		if !ok {
+			t.Errorf("%s: cannot parse %q", p.Name, p.Input)
+			continue
+		}
+		if got := vmResult(program); got != p.Expected {
+			t.Errorf("%s: %q wrong result.\nwant=%s\ngot= %s", p.Name, p.Input, p.Expected, got)
+		}
+	}
+}
+
+func TestModules(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		filepath.Join(dir, "math.tro"): `
+let secret = 40;
+export let add = fn(a, b) { a + b };
+export let answer = add(secret, 2);
+export let pub = fn() { 7 };
+export let reveal = fn() { secret };`,
+		filepath.Join(dir, "a.tro"): `import "b.tro"; export let x = 1;`,
+		filepath.Join(dir, "b.tro"): `import "a.tro"; export let y = 2;`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "math.tro" as m; m.add(m.answer, 1)`, "43"},
+		{`import "math.tro" as m; m.secret`, "模块 math 没有属性 secret"},
+		{`let x = "main"; import "math.tro" as m; m.pub()`, "7"},
+		{`let x = "main"; import "math.tro" as m; m.reveal()`, "40"},
+		{`import "math.tro" as m; let f = fn(g) { g() }; f(m.reveal) + f(m.pub)`, "47"},
+		{`import "a.tro"`, "循环导入: " + filepath.Join(dir, "a.tro") + " -> " +
+			filepath.Join(dir, "b.tro") + " -> " + filepath.Join(dir, "a.tro")},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		env.SetFile(filepath.Join(dir, "main.tro"))
+		result := New(compile(t, tt.input), env).Run()
+
+		got := result.Inspect()
+		if err, ok := result.(*object.Error); ok {
+			got = err.Message
+		}
+		if got != tt.expected {
+			t.Errorf("%q: want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestRunContextStepLimit(t *testing.T) {
+	input := `let loop = fn(n) { loop(n + 1) }; loop(0)`
+	result := New(compile(t, input), object.NewEnvironment()).
+		RunContext(context.Background(), evaluator.Budget{Steps: 1000})
+
+	err, ok := result.(*object.Error)
+	if !ok || err.Kind != object.STEP_LIMIT_ERROR {
+		t.Fatalf("expected StepLimitError. got=%s", result.Inspect())
+	}
+
+	//超出步数限制的错误不能被catch捕获
+	input = `let loop = fn(n) { loop(n + 1) }; try { loop(0) } catch (e) { 1 }`
+	result = New(compile(t, input), object.NewEnvironment()).
+		RunContext(context.Background(), evaluator.Budget{Steps: 1000})
+	if err, ok := result.(*object.Error); !ok || err.Kind != object.STEP_LIMIT_ERROR {
+		t.Fatalf("expected StepLimitError. got=%s", result.Inspect())
+	}
+
+	//返回前取消spawn的任务并等待它们结束
+	input = `let loop = fn(n) { loop(n + 1) }; spawn loop(0)`
+	env := object.NewEnvironment()
+	result = New(compile(t, input), env).RunContext(context.Background(), evaluator.Budget{Steps: 1000000})
+	task, ok := result.(*object.Task)
+	if !ok || !task.Done() {
+		t.Fatalf("expected finished task. got=%s", result.Inspect())
+	}
+	if err, ok := task.Wait(env.Runtime()).(*object.Error); !ok || err.Kind != object.CANCELLED_ERROR {
+		t.Fatalf("expected CancelledError. got=%s", task.Wait(env.Runtime()).Inspect())
+	}
+}
+
+// 无限的尾递归与求值器一样受连续尾调用次数限制
+func TestTailCallLimit(t *testing.T) {
+	input := "let f = fn(x) {\n  f(x)\n};\nf(1)"
+	program, _ := expand(input)
+	result := New(compile(t, input), object.NewEnvironment()).Run()
+	expected := fmt.Sprintf("超出最大递归深度 %d: f", object.DEFAULT_MAX_TAIL_CALLS)
+	if err, ok := result.(*object.Error); !ok || err.Kind != object.RECURSION_ERROR || err.Message != expected {
+		t.Fatalf("expected RecursionError %q. got=%s", expected, result.Inspect())
+	}
+	if want, got := evaltest.Describe(evaluator.Eval(program, object.NewEnvironment())), evaltest.Describe(result); want != got {
+		t.Errorf("results differ.\nevaluator=%s\nvm=%s", want, got)
+	}
+
+	input = `let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } };
+let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } };
+[even(100), try { even(101) } catch (e) { e.message }]`
+	env := object.NewEnvironment()
+	env.Runtime().MaxTailCalls = 100
+	result = New(compile(t, input), env).Run()
+	if result.Inspect() != "[true, 超出最大递归深度 100: odd]" {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+}
+
+func TestConcurrentVMs(t *testing.T) {
+	input := `struct Point { x, y }
+	let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) };
+	let nat = gen fn() { let loop = fn(n) { yield n; loop(n + 1) }; loop(0) };
+	let g = nat();
+	let p = Point(fib(15), 2);
+	let double = fn(x) { x * 2 };
+	let t = spawn double(p.x);
+	let caught = try { 1 + "a" } catch (e) { e.type };
+	[p.x, wait(t), next(g), next(g), caught, quote(1 + unquote(p.y)), 9223372036854775807 + 1]`
+
+	//编译的结果可以被多个虚拟机同时执行，每个虚拟机有自己的全局变量和运行时
+	bytecode := compile(t, input)
+	const workers = 24
+	results := make([]object.Object, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			env := object.NewEnvironment()
+			switch i % 3 {
+			case 1:
+				env.Runtime().Overflow = object.OVERFLOW_WRAP
+			case 2:
+				results[i] = New(bytecode, env).RunContext(context.Background(), evaluator.Budget{Steps: 100})
+				return
+			}
+			results[i] = New(bytecode, env).Run()
+		}(i)
+	}
+	wg.Wait()
+
+	expected := []string{
+		"[610, 1220, 0, 1, TypeError, QUOTE((1 + 2)), 9223372036854775808]",
+		"[610, 1220, 0, 1, TypeError, QUOTE((1 + 2)), -9223372036854775808]",
+		"ERROR: 超出执行步数限制 100",
+	}
+	for i, result := range results {
+		if got := result.Inspect(); got != expected[i%3] {
+			t.Errorf("worker %d: wrong result. want=%s, got=%s", i, expected[i%3], got)
+		}
+	}
+}
+
+func TestGlobalsAcrossPrograms(t *testing.T) {
+	symbolTable := compiler.NewSymbolTable()
+	var constants []object.Object
+	globals := NewGlobals()
+	env := object.NewEnvironment()
+
+	var result object.Object
+	for _, input := range []string{`let f = fn() { g() };`, `let g = fn() { 42 };`, `f()`} {
+		c := compiler.NewWithState(symbolTable, constants)
+		if err := c.Compile(parse(input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		bytecode := c.Bytecode()
+		constants = bytecode.Constants
+		machine := NewWithGlobals(bytecode, env, globals)
+		result = machine.Run()
+		globals = machine.Globals()
+	}
+
+	if result.Inspect() != "42" {
+		t.Errorf("wrong result. want=42, got=%s", result.Inspect())
+	}
+}
+
+func parse(input string) *ast.Program {
+	return parser.New(lexer.New(input)).ParseProgram()
+}
+
+func compile(t *testing.T, input string) *compiler.Bytecode {
+	t.Helper()
+	c := compiler.New()
+	if err := c.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return c.Bytecode()
+}
+
+// 与tro run一样解析并展开宏，有语法或宏错误的程序返回false，它们不会执行
+func expand(input string) (*ast.Program, bool) {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, false
+	}
+	macroEnv := object.NewEnvironment()
+	evaluator.DefineMacros(program, macroEnv)
+	expanded, err := evaluator.ExpandMacros(program, macroEnv)
+	if err != nil {
+		return nil, false
+	}
+	return expanded.(*ast.Program), true
+}
+
+// 比较时两边使用同样的限制，不会结束的程序在同一个位置停下
+var testBudget = evaluator.Budget{Steps: evaltest.MaxSteps}
+
+func evalResult(program *ast.Program) string {
+	env := object.NewEnvironment()
+	env.Runtime().Limits = evaltest.Limits
+	return evaltest.Describe(evaluator.EvalContext(context.Background(), evaluator.Resolve(program), env, testBudget))
+}
+
+func vmResult(program *ast.Program) string {
+	c := compiler.New()
+	if err := c.Compile(program); err != nil {
+		return "compiler error: " + err.Error()
+	}
+	env := object.NewEnvironment()
+	env.Runtime().Limits = evaltest.Limits
+	return evaltest.Describe(New(c.Bytecode(), env).RunContext(context.Background(), testBudget))
+}
+